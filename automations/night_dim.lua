@@ -0,0 +1,16 @@
+-- night_dim.lua: Turns the brightness down when the strip is switched on late at night.
+-- @name Night Dimmer
+-- @restart on-failure
+local util = require("util")
+
+local NIGHT_START = 23 * 60 -- minutes since midnight
+local NIGHT_END = 6 * 60
+local NIGHT_BRIGHTNESS = 20
+
+on("power_changed", function(is_on)
+  if not is_on or not util.in_range(util.now(), NIGHT_START, NIGHT_END) then return end
+  if get_state().brightness > NIGHT_BRIGHTNESS then
+    print("Late night: dimming to " .. NIGHT_BRIGHTNESS .. "%")
+    set_brightness(NIGHT_BRIGHTNESS)
+  end
+end)
@@ -2,13 +2,18 @@
 package main
 
 import (
-	"log"
+	"crypto/tls"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"bledom-controller/internal/agent"
 	"bledom-controller/internal/config"
+	"bledom-controller/internal/logging"
+	"bledom-controller/internal/patterntest"
 )
 
 // These variables are populated during the build process using -ldflags.
@@ -18,34 +23,110 @@ var (
 	date    = "unknown"
 )
 
-func main() {
-	log.Printf("[Main] Starting BLEDOM Controller (Version: %s, Commit: %s, Built: %s)", version, commit, date)
+var logger = logging.Logger("main")
 
+func main() {
 	configPath := "./config.json"
+
+	// "healthcheck" probes a running agent's /readyz and exits non-zero if it is not ready.
+	// The container image has no shell or curl, so HEALTHCHECK runs the binary itself.
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(runHealthcheck(configPath))
+	}
+
+	// "pattern test" runs patterns headless against their golden timelines.
+	if len(os.Args) > 1 && os.Args[1] == "pattern" {
+		os.Exit(runPatternCommand(configPath, os.Args[2:]))
+	}
+
 	cfg, err := config.Load(configPath)
 	if err != nil {
-		log.Fatalf("[Main] FATAL: Failed to load configuration: %v", err)
+		logger.Error("Failed to load configuration", "path", configPath, "err", err)
+		os.Exit(1)
+	}
+	if err := logging.Setup(os.Stderr, cfg.Logging.Format, cfg.Logging.Level, cfg.Logging.Components); err != nil {
+		logger.Error("Failed to configure logging", "err", err)
+		os.Exit(1)
 	}
 
-	log.Printf("[Main] Configuration loaded successfully (Port=%s, WebDir=%s)",
-		cfg.Server.Port,
-		cfg.Server.WebFilesDir,
+	logger.Info("Starting BLEDOM Controller", "version", version, "commit", commit, "built", date)
+	logger.Info("Configuration loaded",
+		"port", cfg.Server.Port,
+		"web_dir", cfg.Server.WebFilesDir,
+		"log_format", cfg.Logging.Format,
+		"log_level", cfg.Logging.Level,
 	)
 
 	a, err := agent.NewAgent(cfg)
 	if err != nil {
-		log.Fatalf("[Main] FATAL: Failed to initialize agent: %v", err)
+		logger.Error("Failed to initialize agent", "err", err)
+		os.Exit(1)
 	}
 
 	// Start the agent orchestration in a separate goroutine
 	go a.Run()
 
-	// Wait for termination signals for a graceful shutdown
+	// Wait for termination signals for a graceful shutdown; SIGHUP reloads TLS certificates
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range quit {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		logger.Info("SIGHUP received, reloading TLS certificates")
+		a.ReloadCertificates()
+	}
 
-	log.Println("[Main] Shutdown signal received, stopping agent...")
+	logger.Info("Shutdown signal received, stopping agent")
 	a.Shutdown()
-	log.Println("[Main] Graceful shutdown complete.")
+	logger.Info("Graceful shutdown complete")
+}
+
+// runHealthcheck queries the local agent's readiness endpoint and returns the process exit code.
+func runHealthcheck(configPath string) int {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "healthcheck: %v\n", err)
+		return 1
+	}
+
+	scheme := "http"
+	if cfg.Server.TLS.Enabled {
+		scheme = "https"
+	}
+	client := &http.Client{
+		Timeout: 3 * time.Second,
+		Transport: &http.Transport{
+			// The probe targets loopback, where the certificate (often self-signed) won't match anyway.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	resp, err := client.Get(fmt.Sprintf("%s://127.0.0.1:%s/readyz", scheme, cfg.Server.Port))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "healthcheck: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "healthcheck: agent not ready (HTTP %d)\n", resp.StatusCode)
+		return 1
+	}
+	return 0
+}
+
+// runPatternCommand runs a "pattern" subcommand with the configured patterns directory and
+// Lua settings. Only warnings and errors are logged, so the report stays readable.
+func runPatternCommand(configPath string, args []string) int {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pattern: %v\n", err)
+		return 1
+	}
+	if err := logging.Setup(os.Stderr, "text", "warn", nil); err != nil {
+		fmt.Fprintf(os.Stderr, "pattern: %v\n", err)
+		return 1
+	}
+	return patterntest.Main(args, cfg.PatternsDir, cfg.Lua, os.Stdout, os.Stderr)
 }
@@ -3,21 +3,29 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"bledom-controller/internal/ble"
 	"bledom-controller/internal/config"
 	"bledom-controller/internal/core"
+	"bledom-controller/internal/health"
+	"bledom-controller/internal/logging"
 	"bledom-controller/internal/lua"
+	"bledom-controller/internal/metrics"
 	"bledom-controller/internal/mqtt"
 	"bledom-controller/internal/scheduler"
 	"bledom-controller/internal/server"
 )
 
+var logger = logging.Logger("agent")
+
 // Agent represents the main orchestration unit that coordinates BLE, Lua, MQTT, and Server components.
 type Agent struct {
 	ctx    context.Context
@@ -31,9 +39,11 @@ type Agent struct {
 
 	bleController *ble.Controller
 	luaEngine     *lua.Engine
+	automations   *lua.Automations
 	scheduler     *scheduler.Scheduler
 	server        *server.Server
 	mqttClient    *mqtt.Client
+	health        *health.Checker
 }
 
 // NewAgent creates and initializes a new Agent with the provided configuration.
@@ -48,6 +58,9 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 		eventBus:       core.NewEventBus(),
 		commandChannel: make(core.CommandChannel, 20),
 	}
+	a.eventBus.OnDrop = func(subscriber string) {
+		metrics.EventBusDrops.WithLabelValues(subscriber).Inc()
+	}
 
 	// Bluetooth configuration
 	bleScanTimeout, _ := time.ParseDuration(cfg.BLE.ScanTimeout)
@@ -67,7 +80,8 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 		cfg.BLE.RateBurst,
 	)
 
-	a.luaEngine = lua.NewEngine(a.bleController, cfg.PatternsDir, a.eventBus)
+	a.luaEngine = lua.NewEngine(a.bleController, cfg.PatternsDir, cfg.PlaylistsFile, cfg.HistoryDir, cfg.HistoryLimit, a.eventBus, a.state, cfg.Lua)
+	a.automations = lua.NewAutomations(a.luaEngine, cfg.AutomationsDir, a.commandChannel)
 
 	// Create Scheduler (before server so we can pass it in)
 	a.scheduler = scheduler.NewScheduler(a.commandChannel, cfg.SchedulesFile)
@@ -75,6 +89,7 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 	// Create Server
 	srv, err := server.NewServer(
 		a.luaEngine,
+		a.automations,
 		a.eventBus,
 		a.state,
 		a.scheduler,
@@ -83,6 +98,8 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 		cfg.Server.WebFilesDir,
 		cfg.Server.AllowedOrigins,
 		cfg.Server.EnablePprof,
+		cfg.Server.EnableMetrics,
+		cfg.Server.TLS,
 	)
 	if err != nil {
 		return nil, err
@@ -96,11 +113,61 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 	})
 
 	// Create MQTT Client (optional)
-	a.mqttClient = mqtt.NewClient(cfg, a.eventBus, a.state, a.commandChannel, a.luaEngine.GetPatternList)
+	a.mqttClient = mqtt.NewClient(cfg, a.eventBus, a.state, a.commandChannel, a.luaEngine.GetPatternList, a.luaEngine.GetPlaylistList)
+
+	a.registerHealthChecks()
 
 	return a, nil
 }
 
+// registerHealthChecks wires component checks into the /healthz and /readyz endpoints.
+func (a *Agent) registerHealthChecks() {
+	a.health = health.NewChecker()
+
+	a.health.Register("http", true, a.server.Health)
+	a.health.Register("lua_engine", true, a.luaEngine.Health)
+	a.health.Register("scheduler", true, func() error {
+		if !a.scheduler.Running() {
+			return errors.New("not running")
+		}
+		return nil
+	})
+	a.health.Register("ble_controller", true, func() error {
+		if !a.bleController.Alive() {
+			return errors.New("connection loop not running")
+		}
+		return nil
+	})
+
+	grace, err := time.ParseDuration(a.config.Health.BLEGracePeriod)
+	if err != nil {
+		// config.Load rejects invalid durations; a config built in code may still carry one.
+		logger.Warn("Invalid health.ble_grace_period, using no grace period", "value", a.config.Health.BLEGracePeriod, "err", err)
+	}
+	a.health.Register("ble_connection", a.config.Health.RequireBLEConnection, func() error {
+		connected, since, lastErr := a.bleController.ConnectionStatus()
+		if connected {
+			return nil
+		}
+		down := time.Since(since)
+		if a.config.Health.RequireBLEConnection && down < grace {
+			return nil
+		}
+		if lastErr != nil {
+			return fmt.Errorf("disconnected for %s: %w", down.Round(time.Second), lastErr)
+		}
+		return fmt.Errorf("disconnected for %s", down.Round(time.Second))
+	})
+
+	if a.mqttClient != nil {
+		a.health.Register("mqtt", true, a.mqttClient.Health)
+	}
+
+	a.server.Handle("/healthz", a.health.LivenessHandler())
+	a.server.Handle("/readyz", a.health.ReadinessHandler())
+	a.server.Handle("/api/v1/log-levels", logging.Handler())
+}
+
 // Run starts the agent orchestration loop and all sub-components.
 func (a *Agent) Run() {
 	// Hook up event subscriptions to maintain the central state and handle resync logic
@@ -109,7 +176,7 @@ func (a *Agent) Run() {
 	if a.mqttClient != nil {
 		go func() {
 			if err := a.mqttClient.Connect(); err != nil {
-				log.Printf("[Agent] MQTT Setup Error: %v", err)
+				logger.Error("MQTT setup failed", "err", err)
 			}
 		}()
 	}
@@ -121,22 +188,31 @@ func (a *Agent) Run() {
 	}()
 
 	a.scheduler.Start()
+	a.automations.Start(a.ctx)
+
+	if err := a.luaEngine.WatchPatterns(a.ctx, a.patternsChanged); err != nil {
+		logger.Warn("Not watching patterns for changes", "dir", a.config.PatternsDir, "err", err)
+	}
 
-	log.Printf("[Agent] API running on http://localhost:%s", a.config.Server.Port)
+	scheme := "http"
+	if a.server.TLSEnabled() {
+		scheme = "https"
+	}
+	logger.Info("API running", "url", fmt.Sprintf("%s://localhost:%s", scheme, a.config.Server.Port))
 	go func() {
-		if err := a.server.ListenAndServe(); err != nil {
-			log.Printf("[Agent] Server error: %v", err)
+		if err := a.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Server failed", "err", err)
 		}
 	}()
 
 	a.publishInitialState()
 
 	// Orchestrator Central Command Loop
-	log.Println("[Agent] Orchestrator ready.")
+	logger.Info("Orchestrator ready")
 	for {
 		select {
 		case <-a.ctx.Done():
-			log.Println("[Agent] Orchestrator shutting down...")
+			logger.Info("Orchestrator shutting down")
 			return
 		case cmd := <-a.commandChannel:
 			a.handleCommand(cmd)
@@ -145,7 +221,7 @@ func (a *Agent) Run() {
 }
 
 func (a *Agent) listenEvents() {
-	sub := a.eventBus.Subscribe(core.DeviceConnectedEvent, core.PatternChangedEvent)
+	sub := a.eventBus.SubscribeAs("agent", core.DeviceConnectedEvent, core.PatternChangedEvent)
 
 	for {
 		select {
@@ -162,12 +238,17 @@ func (a *Agent) listenEvents() {
 							a.state.SetConnection(connected, rssi)
 
 							if !wasConnected && connected {
-								log.Println("[Agent] Device connected, checking for a pattern to resume.")
-								patternToResume := a.state.Clone().RunningPattern
-
-								if patternToResume != "" {
-									log.Printf("[Agent] Resuming pattern: %s", patternToResume)
-									a.luaEngine.RunPattern(patternToResume)
+								logger.Info("Device connected, checking for a pattern to resume")
+								st := a.state.Clone()
+
+								if name, ok := st.RunningPlaylist["name"].(string); ok {
+									index, _ := st.RunningPlaylist["index"].(int)
+									order, _ := st.RunningPlaylist["order"].([]int)
+									logger.Info("Resuming playlist", "playlist", name, "index", index)
+									a.luaEngine.RunPlaylistAt(name, index, order)
+								} else if st.RunningPattern != "" {
+									logger.Info("Resuming pattern", "pattern", st.RunningPattern)
+									a.luaEngine.ResumePattern(st.RunningPattern, st.RunningParams, st.RunningTimer)
 								}
 							}
 						}
@@ -176,10 +257,13 @@ func (a *Agent) listenEvents() {
 			case core.PatternChangedEvent:
 				if payload, ok := event.Payload.(map[string]interface{}); ok {
 					if pattern, ok := payload["running"].(string); ok {
-						a.state.SetRunningPattern(pattern)
+						params, _ := payload["params"].(map[string]interface{})
+						playlist, _ := payload["playlist"].(map[string]interface{})
+						timer, _ := payload["timer"].(map[string]interface{})
+						a.state.SetRunningPattern(pattern, params, playlist, timer)
 
 						if pattern == "" {
-							log.Println("[Agent] Pattern finished. Syncing final state.")
+							logger.Debug("Pattern finished, syncing final state")
 							a.syncState()
 						}
 					}
@@ -190,7 +274,7 @@ func (a *Agent) listenEvents() {
 }
 
 func (a *Agent) handleCommand(cmd core.Command) {
-	log.Printf("[Agent] Handling command: %s with payload: %v", cmd.Type, cmd.Payload)
+	logger.Debug("Handling command", "type", cmd.Type, "payload", cmd.Payload)
 
 	currentState := a.state.Clone()
 
@@ -202,10 +286,12 @@ func (a *Agent) handleCommand(cmd core.Command) {
 		}
 
 		if currentState.Power == isOn {
-			log.Printf("[Agent] Power already %v, skipping pattern stop.", isOn)
+			logger.Debug("Power unchanged, keeping pattern", "on", isOn)
+		} else if a.luaEngine.HandlesEvent("power_changed") {
+			logger.Debug("Power changing, pattern handles it", "on", isOn)
 		} else {
-			log.Printf("[Agent] Power changing to %v, stopping pattern.", isOn)
-			a.luaEngine.StopCurrentPattern()
+			logger.Debug("Power changing, stopping pattern", "on", isOn)
+			a.luaEngine.InterruptCurrentPattern()
 		}
 
 		a.state.SetPower(isOn)
@@ -227,13 +313,16 @@ func (a *Agent) handleCommand(cmd core.Command) {
 		}
 
 		if currentState.ColorR == r && currentState.ColorG == g && currentState.ColorB == b {
-			log.Printf("[Agent] Color already #%02X%02X%02X, skipping pattern stop.", r, g, b)
+			logger.Debug("Color unchanged, keeping pattern", "color", fmt.Sprintf("#%02X%02X%02X", r, g, b))
+		} else if a.luaEngine.HandlesEvent("color_changed") {
+			logger.Debug("Color changing, pattern handles it", "color", fmt.Sprintf("#%02X%02X%02X", r, g, b))
 		} else {
-			log.Printf("[Agent] Color changing to #%02X%02X%02X, stopping pattern.", r, g, b)
-			a.luaEngine.StopCurrentPattern()
+			logger.Debug("Color changing, stopping pattern", "color", fmt.Sprintf("#%02X%02X%02X", r, g, b))
+			a.luaEngine.InterruptCurrentPattern()
 		}
 
 		a.state.SetColor(r, g, b)
+		a.state.SetUserColor(r, g, b)
 		a.bleController.SetColor(r, g, b)
 
 		hex := fmt.Sprintf("#%02X%02X%02X", r, g, b)
@@ -268,9 +357,9 @@ func (a *Agent) handleCommand(cmd core.Command) {
 			id = int(v)
 		}
 		if currentState.RunningPattern != "" {
-			log.Printf("[Agent] Hardware pattern requested while Lua pattern '%s' is running. Stopping Lua pattern.", currentState.RunningPattern)
+			logger.Info("Hardware pattern requested, stopping Lua pattern", "pattern", currentState.RunningPattern)
 		}
-		a.luaEngine.StopCurrentPattern()
+		a.luaEngine.InterruptCurrentPattern()
 		a.bleController.SetHardwarePattern(id)
 
 	case core.CmdSyncTime:
@@ -318,11 +407,43 @@ func (a *Agent) handleCommand(cmd core.Command) {
 		if v, ok := cmd.Payload["name"].(string); ok {
 			name = v
 		}
-		a.luaEngine.RunPattern(name)
+		params, _ := cmd.Payload["params"].(map[string]interface{})
+		var limit lua.RunLimit
+		if err := decodePayload(cmd.Payload, &limit); err != nil {
+			logger.Warn("Invalid pattern run limit", "pattern", name, "err", err)
+			return
+		}
+		// Invalid parameters and limits are reported by the engine as a pattern_error.
+		a.luaEngine.RunPattern(name, params, limit)
 
 	case core.CmdStopPattern:
 		a.luaEngine.StopCurrentPattern()
 
+	case core.CmdRunPlaylist:
+		if name, ok := cmd.Payload["name"].(string); ok {
+			// Unknown playlists are reported by the engine as a pattern_error.
+			a.luaEngine.RunPlaylist(name)
+		}
+
+	case core.CmdPlaylistNext:
+		a.luaEngine.NextPlaylistItem()
+
+	case core.CmdPlaylistPrevious:
+		a.luaEngine.PreviousPlaylistItem()
+
+	case core.CmdSavePlaylist:
+		name, _ := cmd.Payload["name"].(string)
+		var pl lua.Playlist
+		err := decodePayload(cmd.Payload["playlist"], &pl)
+		if err == nil {
+			err = a.luaEngine.SavePlaylist(name, pl)
+		}
+		a.playlistChanged(name, err)
+
+	case core.CmdDeletePlaylist:
+		name, _ := cmd.Payload["name"].(string)
+		a.playlistChanged(name, a.luaEngine.DeletePlaylist(name))
+
 	case core.CmdAddSchedule:
 		spec, command := "", ""
 		if v, ok := cmd.Payload["spec"].(string); ok {
@@ -373,7 +494,7 @@ func (a *Agent) handleCommand(cmd core.Command) {
 					a.server.Hub.Broadcast(server.NewMessage("pattern_code", map[string]string{"name": name, "code": content}))
 				}
 			} else {
-				log.Printf("[Agent] Error getting pattern code for '%s': %v", name, err)
+				logger.Warn("Failed to read pattern code", "pattern", name, "err", err)
 			}
 		}
 
@@ -381,30 +502,96 @@ func (a *Agent) handleCommand(cmd core.Command) {
 		name, nameOk := cmd.Payload["name"].(string)
 		code, codeOk := cmd.Payload["code"].(string)
 		if nameOk && codeOk {
-			if err := a.luaEngine.SavePatternCode(name, code); err != nil {
-				log.Printf("[Agent] Error saving pattern '%s': %v", name, err)
-			} else {
-				patterns, _ := a.luaEngine.GetPatternList()
-				if a.server != nil && a.server.Hub != nil {
-					a.server.Hub.Broadcast(server.NewMessage("pattern_list", patterns))
-				}
+			author := commandAuthor(cmd)
+			diags, err := a.luaEngine.SavePatternCode(name, code, author)
+			result := map[string]interface{}{"name": name, "saved": err == nil, "diagnostics": diags}
+			if err != nil {
+				logger.Warn("Failed to save pattern", "pattern", name, "err", err)
+				result["error"] = err.Error()
+			}
+			if a.server != nil && a.server.Hub != nil {
+				a.server.Hub.Broadcast(server.NewMessage("pattern_saved", result))
+			}
+			if err == nil {
+				a.broadcastPatternLists()
 			}
 		}
 
 	case core.CmdDeletePattern:
 		if name, ok := cmd.Payload["name"].(string); ok {
-			if err := a.luaEngine.DeletePattern(name); err != nil {
-				log.Printf("[Agent] Error deleting pattern '%s': %v", name, err)
+			author := commandAuthor(cmd)
+			if err := a.luaEngine.DeletePattern(name, author); err != nil {
+				logger.Error("Failed to delete pattern", "pattern", name, "err", err)
 			} else {
-				patterns, _ := a.luaEngine.GetPatternList()
-				if a.server != nil && a.server.Hub != nil {
-					a.server.Hub.Broadcast(server.NewMessage("pattern_list", patterns))
-				}
+				a.broadcastPatternLists()
 			}
 		}
 
+	case core.CmdGetPatternHistory:
+		if name, ok := cmd.Payload["name"].(string); ok {
+			revisions, err := a.luaEngine.PatternHistory(name)
+			if err != nil {
+				logger.Warn("Failed to read pattern history", "pattern", name, "err", err)
+				return
+			}
+			a.reply(cmd, "pattern_history", map[string]interface{}{"name": name, "revisions": revisions})
+		}
+
+	case core.CmdDiffPatternRevs:
+		name, _ := cmd.Payload["name"].(string)
+		from, _ := cmd.Payload["from"].(float64)
+		to, _ := cmd.Payload["to"].(float64)
+		result := map[string]interface{}{"name": name, "from": int(from), "to": int(to)}
+		if diff, err := a.luaEngine.DiffPatternRevisions(name, int(from), int(to)); err != nil {
+			logger.Warn("Failed to diff pattern revisions", "pattern", name, "err", err)
+			result["error"] = err.Error()
+		} else {
+			result["diff"] = diff
+		}
+		a.reply(cmd, "pattern_diff", result)
+
+	case core.CmdRestorePatternRev:
+		name, _ := cmd.Payload["name"].(string)
+		id, _ := cmd.Payload["id"].(float64)
+		author := commandAuthor(cmd)
+		if err := a.luaEngine.RestorePatternRevision(name, int(id), author); err != nil {
+			logger.Error("Failed to restore pattern revision", "pattern", name, "revision", int(id), "err", err)
+			return
+		}
+		a.broadcastRestoredPattern(name)
+
+	case core.CmdUndeletePattern:
+		name, _ := cmd.Payload["name"].(string)
+		author := commandAuthor(cmd)
+		if err := a.luaEngine.UndeletePattern(name, author); err != nil {
+			logger.Error("Failed to undelete pattern", "pattern", name, "err", err)
+			return
+		}
+		a.broadcastRestoredPattern(name)
+
+	case core.CmdStartAutomation:
+		if name, ok := cmd.Payload["name"].(string); ok {
+			if err := a.automations.StartAutomation(name); err != nil {
+				logger.Warn("Failed to start automation", "automation", name, "err", err)
+			}
+		}
+
+	case core.CmdStopAutomation:
+		if name, ok := cmd.Payload["name"].(string); ok {
+			a.automations.StopAutomation(name)
+		}
+
+	case core.CmdSetLogLevel:
+		component, _ := cmd.Payload["component"].(string)
+		level, _ := cmd.Payload["level"].(string)
+		if err := logging.SetLevel(component, level); err != nil {
+			logger.Warn("Failed to change log level", "target", component, "level", level, "err", err)
+		} else {
+			logger.Info("Log level changed", "target", component, "level", level)
+		}
+
 	default:
-		log.Printf("[Agent] Unknown command type: %s", cmd.Type)
+		logger.Warn("Unknown command type", "type", cmd.Type)
 	}
 }
 
@@ -420,6 +607,119 @@ func parseScheduleID(payload map[string]interface{}) (int, bool) {
 	return 0, false
 }
 
+// broadcast sends a message to all clients, if the server runs.
+func (a *Agent) broadcast(msgType string, payload interface{}) {
+	if a.server != nil && a.server.Hub != nil {
+		a.server.Hub.Broadcast(server.NewMessage(msgType, payload))
+	}
+}
+
+// reply sends a message to the client that sent cmd, or to all clients if it cannot be
+// answered directly.
+func (a *Agent) reply(cmd core.Command, msgType string, payload interface{}) {
+	if cmd.Reply != nil {
+		cmd.Reply(msgType, payload)
+		return
+	}
+	a.broadcast(msgType, payload)
+}
+
+// commandAuthor returns the author recorded with a pattern change: the one the command
+// names, or else who sent it.
+func commandAuthor(cmd core.Command) string {
+	if author, _ := cmd.Payload["author"].(string); author != "" {
+		return author
+	}
+	return cmd.Source
+}
+
+// broadcastRestoredPattern sends the code and history of a restored or undeleted pattern, so
+// editors showing it reload, and the updated pattern lists.
+func (a *Agent) broadcastRestoredPattern(name string) {
+	if code, err := a.luaEngine.GetPatternCode(name); err == nil {
+		a.broadcast("pattern_code", map[string]string{"name": name, "code": code})
+	}
+	if revisions, err := a.luaEngine.PatternHistory(name); err == nil {
+		a.broadcast("pattern_history", map[string]interface{}{"name": name, "revisions": revisions})
+	}
+	a.broadcastPatternLists()
+}
+
+// broadcastPatternLists sends the runnable patterns, the library modules and the deleted
+// patterns to all clients.
+func (a *Agent) broadcastPatternLists() {
+	if a.server == nil || a.server.Hub == nil {
+		return
+	}
+	if patterns, err := a.luaEngine.GetPatternList(); err == nil {
+		a.server.Hub.Broadcast(server.NewMessage("pattern_list", patterns))
+	}
+	if modules, err := a.luaEngine.GetLibraryList(); err == nil {
+		a.server.Hub.Broadcast(server.NewMessage("library_list", modules))
+	}
+	if deleted, err := a.luaEngine.DeletedPatterns(); err == nil {
+		a.server.Hub.Broadcast(server.NewMessage("deleted_patterns", deleted))
+	} else {
+		logger.Warn("Failed to list deleted patterns", "err", err)
+	}
+}
+
+// patternsChanged follows pattern files changed on disk: clients get the new lists, Home
+// Assistant the new effect list, and with reload_running the running pattern is restarted
+// when its file or a shared module changed.
+func (a *Agent) patternsChanged(changed []string) {
+	logger.Info("Pattern files changed on disk", "files", changed)
+	a.broadcastPatternLists()
+	if a.mqttClient != nil && a.config.MQTT.HADiscoveryEnabled {
+		go a.mqttClient.PublishHADiscovery()
+	}
+
+	if !a.config.Lua.ReloadRunning {
+		return
+	}
+	st := a.state.Clone()
+	if _, ok := st.RunningPlaylist["name"].(string); ok || st.RunningPattern == "" {
+		return
+	}
+	for _, name := range changed {
+		if name != st.RunningPattern && name != "lib" && !strings.HasPrefix(name, "lib/") {
+			continue
+		}
+		if _, err := a.luaEngine.GetPatternCode(st.RunningPattern); err != nil {
+			logger.Warn("Running pattern was removed, keeping it running", "pattern", st.RunningPattern)
+			return
+		}
+		logger.Info("Restarting pattern with its new code", "pattern", st.RunningPattern, "changed", name)
+		a.luaEngine.ResumePattern(st.RunningPattern, st.RunningParams, st.RunningTimer)
+		return
+	}
+}
+
+// playlistChanged reports a failed playlist change to the clients, or sends them the updated
+// playlists.
+func (a *Agent) playlistChanged(name string, err error) {
+	if err != nil {
+		logger.Warn("Failed to change playlist", "playlist", name, "err", err)
+	}
+	if a.server == nil || a.server.Hub == nil {
+		return
+	}
+	if err != nil {
+		a.server.Hub.Broadcast(server.NewMessage("playlist_error", map[string]string{"name": name, "error": err.Error()}))
+		return
+	}
+	a.server.Hub.Broadcast(server.NewMessage("playlist_list", a.luaEngine.GetPlaylistList()))
+}
+
+// decodePayload converts a decoded JSON value from a command payload into v.
+func decodePayload(value interface{}, v interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
 // syncState reads the latest state from the BLE controller and synchronizes it with the central state and event bus.
 func (a *Agent) syncState() {
 	bs := a.bleController.GetState()
@@ -466,9 +766,17 @@ func (a *Agent) publishInitialState() {
 	})
 }
 
+// ReloadCertificates re-reads the server's TLS certificate from disk.
+func (a *Agent) ReloadCertificates() {
+	if err := a.server.ReloadTLS(); err != nil {
+		logger.Error("TLS certificate reload failed", "err", err)
+	}
+}
+
 // Shutdown gracefully stops all agent components and wait groups.
 func (a *Agent) Shutdown() {
 	a.scheduler.Stop()
+	a.automations.Stop()
 	_ = a.server.Shutdown(context.Background())
 	if a.mqttClient != nil {
 		a.mqttClient.Disconnect()
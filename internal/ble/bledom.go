@@ -4,17 +4,22 @@ package ble
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"bledom-controller/internal/core"
+	"bledom-controller/internal/logging"
+	"bledom-controller/internal/metrics"
 
 	"golang.org/x/time/rate"
 	"tinygo.org/x/bluetooth"
 )
 
+var logger = logging.Logger("ble")
+
 var (
 	adapter = bluetooth.DefaultAdapter
 
@@ -58,6 +63,13 @@ type Controller struct {
 	state   State
 	stateMu sync.RWMutex
 
+	// --- Health ---
+	running       atomic.Bool
+	healthMu      sync.RWMutex
+	connected     bool
+	connChangedAt time.Time
+	lastErr       error
+
 	unsupportedWriteOnce         sync.Once
 	unsupportedHeartbeatReadOnce sync.Once
 	unsupportedDisconnectOnce    sync.Once
@@ -103,44 +115,71 @@ func (c *Controller) GetState() State {
 	return c.state
 }
 
+// Alive reports whether the connection management loop is running.
+func (c *Controller) Alive() bool {
+	return c.running.Load()
+}
+
+// ConnectionStatus returns whether the device is connected, when that last changed, and the most recent BLE error.
+func (c *Controller) ConnectionStatus() (connected bool, since time.Time, lastErr error) {
+	c.healthMu.RLock()
+	defer c.healthMu.RUnlock()
+	return c.connected, c.connChangedAt, c.lastErr
+}
+
+// recordError remembers the most recent BLE error for health reporting.
+func (c *Controller) recordError(err error) {
+	c.healthMu.Lock()
+	c.lastErr = err
+	c.healthMu.Unlock()
+}
+
 // Write enqueues a raw byte command to be sent to the device.
 func (c *Controller) Write(payload []byte) {
 	select {
 	case c.commandChan <- payload:
 	default:
-		log.Printf("[BLE] Warning: Command queue full, dropping command: %x", payload)
+		metrics.BLEFramesDropped.WithLabelValues("queue_full").Inc()
+		logger.Warn("Command queue full, dropping command", "payload", fmt.Sprintf("%x", payload))
 	}
 }
 
 // commandWriterLoop is a background worker that processes and writes commands to the BLE characteristic.
 func (c *Controller) commandWriterLoop(ctx context.Context) {
-	log.Println("[BLE] Command writer loop started.")
+	logger.Debug("Command writer loop started")
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case payload := <-c.commandChan:
+			waitStart := time.Now()
 			if err := c.bleCommandLimiter.Wait(ctx); err != nil {
 				return
 			}
+			metrics.BLELimiterWait.Observe(time.Since(waitStart).Seconds())
 
 			if c.characteristic.UUID() == (bluetooth.UUID{}) {
+				metrics.BLEFramesDropped.WithLabelValues("not_connected").Inc()
 				continue
 			}
 
 			_, err := c.characteristic.WriteWithoutResponse(payload)
 			if err != nil {
+				metrics.BLEFramesDropped.WithLabelValues("write_error").Inc()
+				c.recordError(err)
 				if isUnsupportedWrite(err) {
 					c.unsupportedWriteOnce.Do(func() {
-						log.Printf("[BLE] Characteristic write is not supported by this device/backend. Temporarily disabling writes and forcing reconnect: %v", err)
+						logger.Warn("Characteristic write is not supported by this device/backend; disabling writes and forcing reconnect", "err", err)
 					})
 					c.characteristic = bluetooth.DeviceCharacteristic{}
 					c.signalDisconnect()
 					continue
 				}
-				log.Printf("[BLE] Failed to write to device (assuming disconnected): %v", err)
+				logger.Warn("Failed to write to device, assuming disconnected", "err", err)
 				c.signalDisconnect()
+				continue
 			}
+			metrics.BLEFramesWritten.Inc()
 		}
 	}
 }
@@ -196,11 +235,11 @@ func (c *Controller) safeDisconnect(device bluetooth.Device) {
 	if err := device.Disconnect(); err != nil {
 		if isUnsupportedDisconnect(err) {
 			c.unsupportedDisconnectOnce.Do(func() {
-				log.Printf("[BLE] Disconnect method unsupported by backend. Ignoring: %v", err)
+				logger.Debug("Disconnect method unsupported by backend, ignoring", "err", err)
 			})
 			return
 		}
-		log.Printf("[BLE] Disconnect warning: %v", err)
+		logger.Warn("Disconnect failed", "err", err)
 	}
 }
 
@@ -210,7 +249,7 @@ func (c *Controller) stopScanAndWait(scanDone <-chan struct{}) {
 	select {
 	case <-scanDone:
 	case <-time.After(scanStopGracePeriod):
-		log.Printf("[BLE] Warning: scan worker did not stop within %s", scanStopGracePeriod)
+		logger.Warn("Scan worker did not stop in time", "grace", scanStopGracePeriod)
 	}
 }
 
@@ -293,6 +332,21 @@ func (c *Controller) discoverDeviceCharacteristics(device bluetooth.Device) erro
 
 // publishConnection publishes a connection event to the internal event bus.
 func (c *Controller) publishConnection(connected bool, rssi int16) {
+	if connected {
+		metrics.BLEConnected.Set(1)
+		metrics.BLERSSI.Set(float64(rssi))
+	} else {
+		metrics.BLEConnected.Set(0)
+	}
+	metrics.BLELastConnectionChange.SetToCurrentTime()
+
+	c.healthMu.Lock()
+	if c.connected != connected || c.connChangedAt.IsZero() {
+		c.connChangedAt = time.Now()
+	}
+	c.connected = connected
+	c.healthMu.Unlock()
+
 	if c.eventBus != nil {
 		c.eventBus.Publish(core.Event{
 			Type: core.DeviceConnectedEvent,
@@ -306,17 +360,21 @@ func (c *Controller) publishConnection(connected bool, rssi int16) {
 
 // Run starts the main connection management loop, handling scanning, connecting, and discovery.
 func (c *Controller) Run(ctx context.Context) {
+	c.running.Store(true)
+	defer c.running.Store(false)
+
 	c.publishConnection(false, 0)
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("[BLE] Controller shutting down.")
+			logger.Info("Controller shutting down")
 			return
 		default:
 			// 1. Enable Adapter
 			if err := adapter.Enable(); err != nil {
-				log.Printf("[BLE] Failed to enable adapter: %v", err)
+				c.recordError(err)
+				logger.Error("Failed to enable adapter", "err", err)
 				time.Sleep(c.bleRetryDelay)
 				continue
 			}
@@ -329,7 +387,7 @@ func (c *Controller) Run(ctx context.Context) {
 			c.characteristic = bluetooth.DeviceCharacteristic{}
 			c.heartbeatChar = bluetooth.DeviceCharacteristic{}
 
-			log.Println("[BLE] Scanning for BLEDOM device...")
+			logger.Info("Scanning for BLEDOM device")
 			_ = adapter.StopScan()
 
 			var deviceScanResult bluetooth.ScanResult
@@ -339,50 +397,58 @@ func (c *Controller) Run(ctx context.Context) {
 				if errors.Is(scanErr, context.Canceled) {
 					return
 				}
+				c.recordError(scanErr)
 				if errors.Is(scanErr, errScanTimeout) {
-					log.Println("[BLE] Scan timed out. Retrying...")
+					metrics.BLEConnectAttempts.WithLabelValues("scan_timeout").Inc()
+					logger.Info("Scan timed out, retrying")
 				} else {
-					log.Printf("[BLE] Scan error: %v", scanErr)
+					metrics.BLEConnectAttempts.WithLabelValues("scan_error").Inc()
+					logger.Warn("Scan failed", "err", scanErr)
 				}
 				time.Sleep(c.bleRetryDelay)
 				continue
 			}
-			log.Printf("[BLE] Found device: %s (RSSI: %d)", deviceScanResult.LocalName(), deviceScanResult.RSSI)
+			logger.Info("Found device", "name", deviceScanResult.LocalName(), "rssi", deviceScanResult.RSSI)
 
-			log.Printf("[BLE] Connecting to %s...", deviceScanResult.Address.String())
+			logger.Info("Connecting", "address", deviceScanResult.Address.String())
 			connectStartedAt := time.Now()
 			device, err := adapter.Connect(deviceScanResult.Address, bluetooth.ConnectionParams{})
 			if err != nil {
+				metrics.BLEConnectAttempts.WithLabelValues("connect_error").Inc()
+				c.recordError(err)
 				if isLocalConnectionAbort(err) {
-					log.Printf("[BLE] Connection aborted locally by adapter/backend. Retrying...")
+					logger.Warn("Connection aborted locally by adapter/backend, retrying", "err", err)
 					time.Sleep(c.bleRetryDelay)
 					continue
 				}
-				log.Printf("[BLE] Failed to connect: %v", err)
+				logger.Warn("Failed to connect", "err", err)
 				c.publishConnection(false, 0)
 				time.Sleep(c.bleRetryDelay)
 				continue
 			}
 			if connectElapsed := time.Since(connectStartedAt); connectElapsed > c.bleConnectTimeout {
-				log.Printf("[BLE] Connect took %s (connect_timeout=%s)", connectElapsed.Round(time.Millisecond), c.bleConnectTimeout)
+				logger.Warn("Connect was slow", "elapsed", connectElapsed.Round(time.Millisecond), "connect_timeout", c.bleConnectTimeout)
 			}
 
-			log.Printf("[BLE] Connected to %s", deviceScanResult.LocalName())
+			logger.Info("Connected", "name", deviceScanResult.LocalName())
 			c.publishConnection(true, deviceScanResult.RSSI)
 
 			discoveryStartedAt := time.Now()
 			if err := c.discoverDeviceCharacteristics(device); err != nil {
-				log.Printf("[BLE] Service discovery failed: %v", err)
+				metrics.BLEConnectAttempts.WithLabelValues("discovery_error").Inc()
+				c.recordError(err)
+				logger.Warn("Service discovery failed", "err", err)
 				c.publishConnection(false, 0)
 				c.safeDisconnect(device)
 				time.Sleep(c.bleRetryDelay)
 				continue
 			}
 			if discoveryElapsed := time.Since(discoveryStartedAt); discoveryElapsed > c.bleConnectTimeout {
-				log.Printf("[BLE] Discovery took %s (connect_timeout=%s)", discoveryElapsed.Round(time.Millisecond), c.bleConnectTimeout)
+				logger.Warn("Service discovery was slow", "elapsed", discoveryElapsed.Round(time.Millisecond), "connect_timeout", c.bleConnectTimeout)
 			}
 
-			log.Println("[BLE] Device is ready.")
+			metrics.BLEConnectAttempts.WithLabelValues("success").Inc()
+			logger.Info("Device is ready")
 
 			heartbeatTicker := time.NewTicker(c.bleHeartbeatInterval)
 			running := true
@@ -396,27 +462,29 @@ func (c *Controller) Run(ctx context.Context) {
 						if err != nil {
 							if isUnsupportedHeartbeatRead(err) {
 								c.unsupportedHeartbeatReadOnce.Do(func() {
-									log.Printf("[BLE] Heartbeat read is not supported by this device/backend. Disabling heartbeat read checks: %v", err)
+									logger.Warn("Heartbeat read is not supported by this device/backend; disabling heartbeat checks", "err", err)
 								})
 								c.heartbeatChar = bluetooth.DeviceCharacteristic{}
 								continue
 							}
-							log.Printf("[BLE] Heartbeat failed: %v", err)
+							logger.Warn("Heartbeat failed", "err", err)
+							c.recordError(err)
 							c.signalDisconnect()
 						}
 					}
 				case <-c.disconnectChan:
-					log.Println("[BLE] Disconnection signal received. Resetting connection...")
+					logger.Info("Disconnection signal received, resetting connection")
 					running = false
 
 				case <-ctx.Done():
-					log.Println("[BLE] Disconnecting due to shutdown...")
+					logger.Info("Disconnecting due to shutdown")
 					c.safeDisconnect(device)
 					return
 				}
 			}
 
 			heartbeatTicker.Stop()
+			metrics.BLEDisconnects.Inc()
 			c.publishConnection(false, 0)
 
 			c.characteristic = bluetooth.DeviceCharacteristic{}
@@ -4,16 +4,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
+	"time"
 )
 
 // ServerConfig - налаштування HTTP сервера
 type ServerConfig struct {
-	Port           string   `json:"port"`
-	WebFilesDir    string   `json:"web_files_dir"`
-	StaticFilesDir string   `json:"static_files_dir"`
-	AllowedOrigins []string `json:"allowed_origins"`
-	EnablePprof    bool     `json:"enable_pprof"`
+	Port           string    `json:"port"`
+	WebFilesDir    string    `json:"web_files_dir"`
+	StaticFilesDir string    `json:"static_files_dir"`
+	AllowedOrigins []string  `json:"allowed_origins"`
+	EnablePprof    bool      `json:"enable_pprof"`
+	EnableMetrics  bool      `json:"enable_metrics"`
+	TLS            TLSConfig `json:"tls"`
+}
+
+// TLSConfig - налаштування HTTPS
+type TLSConfig struct {
+	Enabled      bool   `json:"enabled"`
+	CertFile     string `json:"cert_file"`
+	KeyFile      string `json:"key_file"`
+	SelfSigned   bool   `json:"self_signed"`   // Згенерувати сертифікат при першому запуску, якщо файлів немає
+	RedirectPort string `json:"redirect_port"` // Порт HTTP-слухача, що перенаправляє на HTTPS (порожньо - вимкнено)
 }
 
 // BLEConfig - налаштування Bluetooth Low Energy
@@ -39,15 +52,66 @@ type MQTTConfig struct {
 	HADiscoveryPrefix  string `json:"ha_discovery_prefix"`
 }
 
+// HealthConfig - політика готовності (/readyz)
+type HealthConfig struct {
+	RequireBLEConnection bool   `json:"require_ble_connection"` // Відключена стрічка робить агента "unready"
+	BLEGracePeriod       string `json:"ble_grace_period"`       // Скільки стрічка може бути відключена до "unready"
+}
+
+// LuaConfig - налаштування виконання Lua-патернів
+type LuaConfig struct {
+	TrustAllPatterns bool     `json:"trust_all_patterns"` // Вимкнути пісочницю для всіх патернів
+	TrustedPatterns  []string `json:"trusted_patterns"`   // Патерни з повним доступом до os/io/debug, напр. ["backup.lua"]
+
+	// Ліміти ресурсів для кожного скрипта (діють і для довірених)
+	MaxInstructionsPerSecond int64 `json:"max_instructions_per_second"` // Бюджет інструкцій VM за секунду
+	MaxCallStackSize         int   `json:"max_call_stack_size"`         // Глибина викликів (рекурсії)
+	MaxRegistrySize          int   `json:"max_registry_size"`           // Розмір стеку даних (регістрів)
+	MaxMemoryMB              int   `json:"max_memory_mb"`               // Приріст купи під час виконання скрипта
+
+	Transitions TransitionConfig `json:"transitions"` // Плавні переходи між патернами
+
+	ReloadRunning bool `json:"reload_running"` // Перезапускати поточний патерн, коли його файл або модуль з lib/ змінено на диску
+}
+
+// TransitionConfig - плавні переходи при запуску та зупинці патернів
+type TransitionConfig struct {
+	Start  string     `json:"start"`  // Перехід від поточного кольору до нового патерна ("0s" - вимкнено)
+	Stop   string     `json:"stop"`   // Повернення до стану спокою після патерна ("0s" - миттєво)
+	Easing string     `json:"easing"` // Крива переходу, як у color.ease(), напр. "in_out_sine"
+	Rest   *RestState `json:"rest"`   // Стан спокою; без нього - стан, який обрав користувач
+}
+
+// RestState - стан, до якого стрічка повертається після патерна
+type RestState struct {
+	Color      string `json:"color"`      // "#rrggbb"; порожньо - колір користувача
+	Brightness int    `json:"brightness"` // 1-100; 0 - яскравість користувача
+	Power      *bool  `json:"power"`      // Без значення - живлення, яке обрав користувач
+}
+
+// LoggingConfig - налаштування журналювання
+type LoggingConfig struct {
+	Format     string            `json:"format"`     // "text" або "json"
+	Level      string            `json:"level"`      // Рівень за замовчуванням: debug, info, warn, error
+	Components map[string]string `json:"components"` // Рівні окремих компонентів, напр. {"ble": "debug"}
+}
+
 // Config - головна структура
 type Config struct {
-	Server ServerConfig `json:"server"`
-	BLE    BLEConfig    `json:"ble"`
-	MQTT   MQTTConfig   `json:"mqtt"`
+	Server  ServerConfig  `json:"server"`
+	BLE     BLEConfig     `json:"ble"`
+	MQTT    MQTTConfig    `json:"mqtt"`
+	Health  HealthConfig  `json:"health"`
+	Lua     LuaConfig     `json:"lua"`
+	Logging LoggingConfig `json:"logging"`
 
 	// File system settings
-	PatternsDir   string `json:"patterns_dir"`
-	SchedulesFile string `json:"schedules_file"`
+	PatternsDir    string `json:"patterns_dir"`
+	AutomationsDir string `json:"automations_dir"` // Фонові скрипти-автоматизації, що запускаються зі стартом
+	SchedulesFile  string `json:"schedules_file"`
+	PlaylistsFile  string `json:"playlists_file"` // Списки відтворення патернів
+	HistoryDir     string `json:"history_dir"`    // Історія версій патернів (збереження, видалення)
+	HistoryLimit   int    `json:"history_limit"`  // Скільки останніх версій зберігати для кожного патерну
 }
 
 // Load зчитує файл, парсить JSON та застосовує валідацію/дефолти
@@ -85,8 +149,22 @@ func (c *Config) sanitize() {
 	c.Server.Port = strings.TrimSpace(c.Server.Port)
 	c.Server.WebFilesDir = strings.TrimSpace(c.Server.WebFilesDir)
 	c.Server.StaticFilesDir = strings.TrimSpace(c.Server.StaticFilesDir)
+	c.Server.TLS.CertFile = strings.TrimSpace(c.Server.TLS.CertFile)
+	c.Server.TLS.KeyFile = strings.TrimSpace(c.Server.TLS.KeyFile)
+	c.Server.TLS.RedirectPort = strings.TrimSpace(c.Server.TLS.RedirectPort)
+	c.Logging.Format = strings.ToLower(strings.TrimSpace(c.Logging.Format))
+	c.Logging.Level = strings.ToLower(strings.TrimSpace(c.Logging.Level))
 	c.PatternsDir = strings.TrimSpace(c.PatternsDir)
+	c.AutomationsDir = strings.TrimSpace(c.AutomationsDir)
 	c.SchedulesFile = strings.TrimSpace(c.SchedulesFile)
+	c.PlaylistsFile = strings.TrimSpace(c.PlaylistsFile)
+	c.HistoryDir = strings.TrimSpace(c.HistoryDir)
+	c.Lua.Transitions.Start = strings.TrimSpace(c.Lua.Transitions.Start)
+	c.Lua.Transitions.Stop = strings.TrimSpace(c.Lua.Transitions.Stop)
+	c.Lua.Transitions.Easing = strings.ToLower(strings.TrimSpace(c.Lua.Transitions.Easing))
+	if c.Lua.Transitions.Rest != nil {
+		c.Lua.Transitions.Rest.Color = strings.TrimSpace(c.Lua.Transitions.Rest.Color)
+	}
 
 	// Очищення пробілів у назвах девайсів (хоча іноді в BLE іменах важливі пробіли,
 	// але зазвичай це помилка копіювання, окрім випадку точного матчингу)
@@ -109,6 +187,14 @@ func (c *Config) setDefaults() {
 	if len(c.Server.AllowedOrigins) == 0 {
 		c.Server.AllowedOrigins = []string{"http://localhost:8080"}
 	}
+	if c.Server.TLS.Enabled {
+		if c.Server.TLS.CertFile == "" {
+			c.Server.TLS.CertFile = "certs/server.crt"
+		}
+		if c.Server.TLS.KeyFile == "" {
+			c.Server.TLS.KeyFile = "certs/server.key"
+		}
+	}
 
 	// BLE Defaults
 	if len(c.BLE.DeviceNames) == 0 {
@@ -133,13 +219,61 @@ func (c *Config) setDefaults() {
 		c.BLE.RateBurst = 25
 	}
 
+	// Health Defaults
+	if c.Health.BLEGracePeriod == "" {
+		c.Health.BLEGracePeriod = "0s"
+	}
+
+	// Lua Defaults
+	if c.Lua.MaxInstructionsPerSecond <= 0 {
+		c.Lua.MaxInstructionsPerSecond = 10_000_000
+	}
+	if c.Lua.MaxCallStackSize <= 0 {
+		c.Lua.MaxCallStackSize = 256
+	}
+	if c.Lua.MaxRegistrySize <= 0 {
+		c.Lua.MaxRegistrySize = 256 * 1024
+	}
+	if c.Lua.MaxMemoryMB <= 0 {
+		c.Lua.MaxMemoryMB = 64
+	}
+	if c.Lua.Transitions.Start == "" {
+		c.Lua.Transitions.Start = "500ms"
+	}
+	if c.Lua.Transitions.Stop == "" {
+		c.Lua.Transitions.Stop = "1s"
+	}
+	if c.Lua.Transitions.Easing == "" {
+		c.Lua.Transitions.Easing = "in_out_sine"
+	}
+
+	// Logging Defaults
+	if c.Logging.Format == "" {
+		c.Logging.Format = "text"
+	}
+	if c.Logging.Level == "" {
+		c.Logging.Level = "info"
+	}
+
 	// File Defaults
 	if c.PatternsDir == "" {
 		c.PatternsDir = "patterns"
 	}
+	if c.AutomationsDir == "" {
+		c.AutomationsDir = "automations"
+	}
 	if c.SchedulesFile == "" {
 		c.SchedulesFile = "schedules.json"
 	}
+	if c.PlaylistsFile == "" {
+		c.PlaylistsFile = "playlists.json"
+	}
+	if c.HistoryDir == "" {
+		c.HistoryDir = "pattern_history"
+	}
+	if c.HistoryLimit == 0 {
+		c.HistoryLimit = 100
+	}
 
 	// MQTT Defaults
 	if c.MQTT.Broker == "" {
@@ -162,5 +296,51 @@ func (c *Config) validate() error {
 		// Хоча ми ставимо дефолт, якщо користувач явно ввів мінус - це помилка або корекція
 		return fmt.Errorf("config error: 'command_rate_limit' must be positive")
 	}
+	if c.Server.TLS.Enabled && c.Server.TLS.RedirectPort == c.Server.Port {
+		return fmt.Errorf("config error: 'tls.redirect_port' must differ from 'port'")
+	}
+	if c.HistoryLimit < 0 {
+		return fmt.Errorf("config error: 'history_limit' must be positive")
+	}
+	if c.Logging.Format != "text" && c.Logging.Format != "json" {
+		return fmt.Errorf("config error: 'logging.format' must be \"text\" or \"json\"")
+	}
+	if !isLogLevel(c.Logging.Level) {
+		return fmt.Errorf("config error: invalid 'logging.level' %q", c.Logging.Level)
+	}
+	for _, d := range []struct{ name, value string }{
+		{"lua.transitions.start", c.Lua.Transitions.Start},
+		{"lua.transitions.stop", c.Lua.Transitions.Stop},
+		{"health.ble_grace_period", c.Health.BLEGracePeriod},
+	} {
+		if v, err := time.ParseDuration(d.value); err != nil || v < 0 {
+			return fmt.Errorf("config error: invalid duration %q for '%s'", d.value, d.name)
+		}
+	}
+	if rest := c.Lua.Transitions.Rest; rest != nil {
+		if rest.Color != "" && !hexColor.MatchString(rest.Color) {
+			return fmt.Errorf("config error: 'lua.transitions.rest.color' must be a #rrggbb color")
+		}
+		if rest.Brightness < 0 || rest.Brightness > 100 {
+			return fmt.Errorf("config error: 'lua.transitions.rest.brightness' must be between 1 and 100")
+		}
+	}
+	for component, level := range c.Logging.Components {
+		if !isLogLevel(level) {
+			return fmt.Errorf("config error: invalid level %q for logging component %q", level, component)
+		}
+	}
 	return nil
 }
+
+// hexColor - колір у форматі #rrggbb
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// isLogLevel перевіряє назву рівня журналювання
+func isLogLevel(level string) bool {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug", "info", "warn", "error":
+		return true
+	}
+	return false
+}
@@ -23,12 +23,28 @@ const (
 	CmdGetPatternCode     CommandType = "getPatternCode"
 	CmdSavePatternCode    CommandType = "savePatternCode"
 	CmdDeletePattern      CommandType = "deletePattern"
+	CmdGetPatternHistory  CommandType = "getPatternHistory"
+	CmdDiffPatternRevs    CommandType = "diffPatternRevisions"
+	CmdRestorePatternRev  CommandType = "restorePatternRevision"
+	CmdUndeletePattern    CommandType = "undeletePattern"
+	CmdSetLogLevel        CommandType = "setLogLevel"
+	CmdStartAutomation    CommandType = "startAutomation"
+	CmdStopAutomation     CommandType = "stopAutomation"
+	CmdRunPlaylist        CommandType = "runPlaylist"
+	CmdPlaylistNext       CommandType = "playlistNext"
+	CmdPlaylistPrevious   CommandType = "playlistPrevious"
+	CmdSavePlaylist       CommandType = "savePlaylist"
+	CmdDeletePlaylist     CommandType = "deletePlaylist"
 )
 
 // Command is the envelope for incoming requests to change state or perform actions.
 type Command struct {
 	Type    CommandType
 	Payload map[string]interface{}
+	// Source names the sender, e.g. the address of a WebSocket client; empty if unknown.
+	Source string
+	// Reply, if set, sends a message to the sender only.
+	Reply func(msgType string, payload interface{})
 }
 
 // CommandChannel is the single channel that the core Agent listens to for commands.
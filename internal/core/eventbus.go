@@ -1,6 +1,8 @@
 package core
 
-import "sync"
+import (
+	"sync"
+)
 
 // EventType defines the type of event being published.
 type EventType string
@@ -11,6 +13,16 @@ const (
 	PatternChangedEvent  EventType = "PatternChanged"
 	PowerChangedEvent    EventType = "PowerChanged"
 	ColorChangedEvent    EventType = "ColorChanged"
+	PatternErrorEvent    EventType = "PatternError"
+	// AutomationStatusEvent carries the status of every automation script.
+	AutomationStatusEvent EventType = "AutomationStatus"
+	// PreviewFrameEvent carries what scripts show on the strip, throttled for live previews.
+	PreviewFrameEvent EventType = "PreviewFrame"
+
+	// MQTTSubscriptionEvent asks the MQTT client to (un)subscribe an extra topic.
+	MQTTSubscriptionEvent EventType = "MQTTSubscription"
+	// MQTTMessageEvent carries a message received on an extra topic.
+	MQTTMessageEvent EventType = "MQTTMessage"
 )
 
 // Event is the envelope for all system events.
@@ -26,17 +38,28 @@ type Subscriber chan Event
 type EventBus struct {
 	mu          sync.RWMutex
 	subscribers map[EventType][]Subscriber
+	names       map[Subscriber]string
+
+	// OnDrop, if set, is called with the subscriber's name for every event it misses because
+	// its channel is full. Set it before publishing.
+	OnDrop func(subscriber string)
 }
 
 // NewEventBus creates a new EventBus.
 func NewEventBus() *EventBus {
 	return &EventBus{
 		subscribers: make(map[EventType][]Subscriber),
+		names:       make(map[Subscriber]string),
 	}
 }
 
 // Subscribe returns a channel that receives events of the given types.
 func (eb *EventBus) Subscribe(eventTypes ...EventType) Subscriber {
+	return eb.SubscribeAs("anonymous", eventTypes...)
+}
+
+// SubscribeAs is like Subscribe but names the subscriber, so dropped events can be attributed to it.
+func (eb *EventBus) SubscribeAs(name string, eventTypes ...EventType) Subscriber {
 	eb.mu.Lock()
 	defer eb.mu.Unlock()
 
@@ -44,10 +67,31 @@ func (eb *EventBus) Subscribe(eventTypes ...EventType) Subscriber {
 	for _, t := range eventTypes {
 		eb.subscribers[t] = append(eb.subscribers[t], ch)
 	}
+	eb.names[ch] = name
 
 	return ch
 }
 
+// Extend adds event types to an existing subscription. Events already queued on the channel
+// are kept.
+func (eb *EventBus) Extend(ch Subscriber, eventTypes ...EventType) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	for _, t := range eventTypes {
+		subscribed := false
+		for _, sub := range eb.subscribers[t] {
+			if sub == ch {
+				subscribed = true
+				break
+			}
+		}
+		if !subscribed {
+			eb.subscribers[t] = append(eb.subscribers[t], ch)
+		}
+	}
+}
+
 // Unsubscribe removes a subscriber channel.
 func (eb *EventBus) Unsubscribe(ch Subscriber, eventTypes ...EventType) {
 	eb.mu.Lock()
@@ -63,6 +107,15 @@ func (eb *EventBus) Unsubscribe(ch Subscriber, eventTypes ...EventType) {
 			}
 		}
 	}
+
+	for _, subs := range eb.subscribers {
+		for _, sub := range subs {
+			if sub == ch {
+				return
+			}
+		}
+	}
+	delete(eb.names, ch)
 }
 
 // Publish distributes an event to all active subscribers for its type.
@@ -76,6 +129,9 @@ func (eb *EventBus) Publish(event Event) {
 			case sub <- event:
 			default:
 				// If the subscriber channel is full, we drop the event to prevent blocking the publishers
+				if eb.OnDrop != nil {
+					eb.OnDrop(eb.names[sub])
+				}
 			}
 		}
 	}
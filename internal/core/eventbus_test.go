@@ -0,0 +1,34 @@
+package core
+
+import "testing"
+
+func TestPublishReportsDrops(t *testing.T) {
+	eb := NewEventBus()
+	drops := map[string]int{}
+	eb.OnDrop = func(subscriber string) { drops[subscriber]++ }
+
+	slow := eb.SubscribeAs("slow", PowerChangedEvent)
+	for i := 0; i < cap(slow)+3; i++ {
+		eb.Publish(Event{Type: PowerChangedEvent, Payload: i})
+	}
+	if drops["slow"] != 3 || len(slow) != cap(slow) {
+		t.Errorf("drops %v with %d events queued, want 3 drops for slow", drops, len(slow))
+	}
+}
+
+func TestExtendKeepsQueuedEvents(t *testing.T) {
+	eb := NewEventBus()
+	sub := eb.SubscribeAs("lua", PowerChangedEvent)
+	eb.Publish(Event{Type: PowerChangedEvent})
+	eb.Extend(sub, ColorChangedEvent, PowerChangedEvent)
+	eb.Publish(Event{Type: ColorChangedEvent})
+	eb.Publish(Event{Type: PowerChangedEvent})
+
+	var got []EventType
+	for len(sub) > 0 {
+		got = append(got, (<-sub).Type)
+	}
+	if len(got) != 3 || got[0] != PowerChangedEvent || got[1] != ColorChangedEvent || got[2] != PowerChangedEvent {
+		t.Errorf("received %v, want each event once in order", got)
+	}
+}
@@ -14,6 +14,17 @@ type State struct {
 	Brightness     int
 	Speed          int
 	RunningPattern string
+	RunningParams  map[string]interface{}
+	// RunningPlaylist is the playlist position (name, index, count) when the running pattern
+	// is a playlist item, otherwise nil.
+	RunningPlaylist map[string]interface{}
+	// RunningTimer is when a time-limited run ends (endsAt, remaining, then), otherwise nil.
+	RunningTimer map[string]interface{}
+
+	// UserColor is the last color chosen outside a script (UI, MQTT, API).
+	UserColorR int
+	UserColorG int
+	UserColorB int
 }
 
 // NewState creates a new State instance.
@@ -25,6 +36,7 @@ func NewState() *State {
 		ColorB:     0,
 		Brightness: 100,
 		Speed:      50,
+		UserColorG: 255,
 	}
 }
 
@@ -33,15 +45,21 @@ func (s *State) Clone() State {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return State{
-		IsConnected:    s.IsConnected,
-		RSSI:           s.RSSI,
-		Power:          s.Power,
-		ColorR:         s.ColorR,
-		ColorG:         s.ColorG,
-		ColorB:         s.ColorB,
-		Brightness:     s.Brightness,
-		Speed:          s.Speed,
-		RunningPattern: s.RunningPattern,
+		IsConnected:     s.IsConnected,
+		RSSI:            s.RSSI,
+		Power:           s.Power,
+		ColorR:          s.ColorR,
+		ColorG:          s.ColorG,
+		ColorB:          s.ColorB,
+		Brightness:      s.Brightness,
+		Speed:           s.Speed,
+		RunningPattern:  s.RunningPattern,
+		RunningParams:   s.RunningParams,
+		RunningPlaylist: s.RunningPlaylist,
+		RunningTimer:    s.RunningTimer,
+		UserColorR:      s.UserColorR,
+		UserColorG:      s.UserColorG,
+		UserColorB:      s.UserColorB,
 	}
 }
 
@@ -69,6 +87,15 @@ func (s *State) SetColor(r, g, b int) {
 	s.ColorB = b
 }
 
+// SetUserColor records a color chosen outside a script.
+func (s *State) SetUserColor(r, g, b int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.UserColorR = r
+	s.UserColorG = g
+	s.UserColorB = b
+}
+
 // SetBrightness updates the brightness state.
 func (s *State) SetBrightness(brightness int) {
 	s.mu.Lock()
@@ -83,9 +110,14 @@ func (s *State) SetSpeed(speed int) {
 	s.Speed = speed
 }
 
-// SetRunningPattern updates the running pattern state.
-func (s *State) SetRunningPattern(pattern string) {
+// SetRunningPattern updates the running pattern state, the parameter values it was started with,
+// the playlist it belongs to and when it ends. The maps are not modified afterwards, so clones
+// share them.
+func (s *State) SetRunningPattern(pattern string, params, playlist, timer map[string]interface{}) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.RunningPattern = pattern
+	s.RunningParams = params
+	s.RunningPlaylist = playlist
+	s.RunningTimer = timer
 }
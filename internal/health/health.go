@@ -0,0 +1,127 @@
+// Package health provides liveness and readiness reporting for the agent's components.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CheckFunc reports a component's health; a nil error means healthy.
+type CheckFunc func() error
+
+// Component is the last observed status of a single component.
+type Component struct {
+	Healthy     bool       `json:"healthy"`
+	Required    bool       `json:"required"`
+	Since       time.Time  `json:"since"`
+	CheckedAt   time.Time  `json:"checked_at"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Report is the JSON body returned by the readiness endpoint.
+type Report struct {
+	Status     string               `json:"status"`
+	StartedAt  time.Time            `json:"started_at"`
+	CheckedAt  time.Time            `json:"checked_at"`
+	Components map[string]Component `json:"components"`
+}
+
+type check struct {
+	name     string
+	required bool
+	fn       CheckFunc
+}
+
+// Checker runs registered component checks and remembers their status transitions.
+type Checker struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	checks    []check
+	state     map[string]*Component
+}
+
+// NewChecker creates an empty Checker.
+func NewChecker() *Checker {
+	return &Checker{
+		startedAt: time.Now(),
+		state:     make(map[string]*Component),
+	}
+}
+
+// Register adds a component check. Only required components affect readiness;
+// optional ones are still reported.
+func (c *Checker) Register(name string, required bool, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, required: required, fn: fn})
+	c.state[name] = &Component{Required: required, Since: time.Now()}
+}
+
+// Check runs every registered check and returns the resulting report.
+func (c *Checker) Check() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	report := Report{
+		Status:     "ready",
+		StartedAt:  c.startedAt,
+		CheckedAt:  now,
+		Components: make(map[string]Component, len(c.checks)),
+	}
+
+	for _, chk := range c.checks {
+		comp := c.state[chk.name]
+		err := chk.fn()
+		healthy := err == nil
+
+		if !comp.CheckedAt.IsZero() && comp.Healthy != healthy {
+			comp.Since = now
+		}
+		comp.Healthy = healthy
+		comp.CheckedAt = now
+		if err != nil {
+			at := now
+			comp.LastError = err.Error()
+			comp.LastErrorAt = &at
+			if chk.required {
+				report.Status = "unready"
+			}
+		}
+		report.Components[chk.name] = *comp
+	}
+	return report
+}
+
+// LivenessHandler answers 200 as long as the process can serve HTTP.
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":     "ok",
+			"started_at": c.startedAt,
+		})
+	})
+}
+
+// ReadinessHandler answers 200 when every required component is healthy and 503 otherwise,
+// with per-component details in both cases.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Check()
+		code := http.StatusOK
+		if report.Status != "ready" {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// bufferSize is the number of recent entries kept in memory.
+	bufferSize = 1000
+	// subscriberQueueSize is the number of entries buffered per subscriber before they are dropped.
+	subscriberQueueSize = 256
+)
+
+// Entry is a single log record as kept in the in-memory buffer and streamed to clients.
+type Entry struct {
+	ID        uint64                 `json:"id"`
+	Time      time.Time              `json:"time"`
+	Level     string                 `json:"level"`
+	Component string                 `json:"component"`
+	Message   string                 `json:"message"`
+	Attrs     map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// ringBuffer keeps the most recent entries and fans new ones out to subscribers.
+type ringBuffer struct {
+	mu      sync.Mutex
+	entries []Entry
+	start   int
+	lastID  uint64
+	subs    map[chan Entry]struct{}
+}
+
+var buffer = &ringBuffer{
+	entries: make([]Entry, 0, bufferSize),
+	subs:    make(map[chan Entry]struct{}),
+}
+
+func (b *ringBuffer) add(e Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	if len(b.entries) < bufferSize {
+		b.entries = append(b.entries, e)
+	} else {
+		b.entries[b.start] = e
+		b.start = (b.start + 1) % bufferSize
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// Slow subscriber: drop rather than block the logging call.
+		}
+	}
+}
+
+// Recent returns up to limit of the most recent entries, oldest first. A limit <= 0 returns all of them.
+func Recent(limit int) []Entry {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	n := len(buffer.entries)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	out := make([]Entry, 0, limit)
+	for i := n - limit; i < n; i++ {
+		out = append(out, buffer.entries[(buffer.start+i)%n])
+	}
+	return out
+}
+
+// Subscribe returns a channel receiving every new entry and a function that cancels the subscription.
+// Entries are dropped for subscribers that fall behind.
+func Subscribe() (<-chan Entry, func()) {
+	ch := make(chan Entry, subscriberQueueSize)
+	buffer.mu.Lock()
+	buffer.subs[ch] = struct{}{}
+	buffer.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			buffer.mu.Lock()
+			delete(buffer.subs, ch)
+			buffer.mu.Unlock()
+		})
+	}
+}
+
+// newEntry converts a record and the handler's accumulated attributes to an Entry.
+func newEntry(component string, attrs []slog.Attr, groups []string, r slog.Record) Entry {
+	e := Entry{
+		Time:      r.Time,
+		Level:     strings.ToLower(r.Level.String()),
+		Component: component,
+		Message:   r.Message,
+	}
+	if len(attrs) == 0 && r.NumAttrs() == 0 {
+		return e
+	}
+
+	e.Attrs = make(map[string]interface{}, len(attrs)+r.NumAttrs())
+	for _, a := range attrs {
+		flattenAttr(e.Attrs, "", a)
+	}
+	prefix := ""
+	if len(groups) > 0 {
+		prefix = strings.Join(groups, ".") + "."
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		flattenAttr(e.Attrs, prefix, a)
+		return true
+	})
+	return e
+}
+
+// flattenAttr stores a (possibly grouped) attribute under dotted keys, applying redaction.
+func flattenAttr(dst map[string]interface{}, prefix string, a slog.Attr) {
+	a = redactSensitive(nil, a)
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			flattenAttr(dst, prefix+a.Key+".", ga)
+		}
+		return
+	}
+
+	key := prefix + a.Key
+	switch a.Value.Kind() {
+	case slog.KindString:
+		dst[key] = a.Value.String()
+	case slog.KindInt64:
+		dst[key] = a.Value.Int64()
+	case slog.KindUint64:
+		dst[key] = a.Value.Uint64()
+	case slog.KindFloat64:
+		dst[key] = a.Value.Float64()
+	case slog.KindBool:
+		dst[key] = a.Value.Bool()
+	default:
+		dst[key] = fmt.Sprint(a.Value.Any())
+	}
+}
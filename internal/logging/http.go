@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+var logger = Logger("logging")
+
+// levelRequest is the body accepted by Handler to change a component's level.
+type levelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
+
+// Handler serves the current levels on GET and changes a component's level on PUT or POST
+// with a body like {"component": "ble", "level": "debug"}.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var req levelRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+				return
+			}
+			if err := SetLevel(req.Component, req.Level); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			logger.Info("Log level changed", "target", req.Component, "level", req.Level)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"levels": Levels()})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
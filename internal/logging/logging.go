@@ -0,0 +1,200 @@
+// Package logging provides component-scoped structured loggers built on log/slog with
+// per-component levels that can be changed at runtime.
+//
+// Packages obtain their logger once with Logger("ble") (typically as a package-level variable);
+// Setup may be called later and still applies to those loggers, because output format and
+// levels are resolved when each record is handled.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// redacted replaces the value of sensitive attributes.
+const redacted = "[REDACTED]"
+
+var (
+	root atomic.Pointer[slog.Handler]
+
+	mu           sync.RWMutex
+	defaultLevel = slog.LevelInfo
+	levels       = make(map[string]slog.Level) // explicit per-component overrides
+	known        = make(map[string]bool)       // every component that asked for a logger
+)
+
+func init() {
+	setRoot(newRootHandler(os.Stderr, "text"))
+}
+
+// Setup configures the output format ("text" or "json"), the default level and per-component levels.
+func Setup(w io.Writer, format, level string, components map[string]string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	overrides := make(map[string]slog.Level, len(components))
+	for name, l := range components {
+		parsed, err := ParseLevel(l)
+		if err != nil {
+			return fmt.Errorf("component %q: %w", name, err)
+		}
+		overrides[strings.ToLower(name)] = parsed
+	}
+
+	mu.Lock()
+	defaultLevel = lvl
+	levels = overrides
+	mu.Unlock()
+
+	setRoot(newRootHandler(w, format))
+	slog.SetDefault(Logger("main"))
+	return nil
+}
+
+// Logger returns the logger for a component. Records carry a "component" attribute.
+func Logger(component string) *slog.Logger {
+	component = strings.ToLower(component)
+	mu.Lock()
+	known[component] = true
+	mu.Unlock()
+	return slog.New(&componentHandler{component: component})
+}
+
+// ParseLevel converts a level name (debug, info, warn, error) to a slog.Level.
+func ParseLevel(name string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", name)
+	}
+	return lvl, nil
+}
+
+// SetLevel changes a component's level at runtime. The component "default" changes the level
+// used by every component without an explicit override.
+func SetLevel(component, level string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	component = strings.ToLower(strings.TrimSpace(component))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if component == "" || component == "default" {
+		defaultLevel = lvl
+		return nil
+	}
+	if !known[component] {
+		return fmt.Errorf("unknown log component %q", component)
+	}
+	levels[component] = lvl
+	return nil
+}
+
+// Levels returns the effective level of every known component plus "default".
+func Levels() map[string]string {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := map[string]string{"default": strings.ToLower(defaultLevel.String())}
+	for name := range known {
+		out[name] = strings.ToLower(levelForLocked(name).String())
+	}
+	return out
+}
+
+func levelFor(component string) slog.Level {
+	mu.RLock()
+	defer mu.RUnlock()
+	return levelForLocked(component)
+}
+
+func levelForLocked(component string) slog.Level {
+	if lvl, ok := levels[component]; ok {
+		return lvl
+	}
+	return defaultLevel
+}
+
+func setRoot(h slog.Handler) {
+	root.Store(&h)
+}
+
+// newRootHandler builds the output handler. Filtering happens in componentHandler, so the
+// root accepts everything.
+func newRootHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{
+		Level:       slog.LevelDebug - 4,
+		ReplaceAttr: redactSensitive,
+	}
+	if strings.EqualFold(format, "json") {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// redactSensitive hides values of attributes whose key looks like a credential.
+func redactSensitive(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, s := range []string{"password", "secret", "token"} {
+		if strings.Contains(key, s) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	return a
+}
+
+// componentHandler filters by the component's current level, delegates to the current root handler
+// and records every handled entry in the in-memory buffer.
+type componentHandler struct {
+	component string
+	ops       []func(slog.Handler) slog.Handler // WithAttrs/WithGroup calls, replayed on the root
+	attrs     []slog.Attr                       // attributes added with WithAttrs, for buffered entries
+	groups    []string                          // open groups, for buffered entries
+}
+
+func (h *componentHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= levelFor(h.component)
+}
+
+func (h *componentHandler) Handle(ctx context.Context, r slog.Record) error {
+	buffer.add(newEntry(h.component, h.attrs, h.groups, r))
+
+	inner := (*root.Load()).WithAttrs([]slog.Attr{slog.String("component", h.component)})
+	for _, op := range h.ops {
+		inner = op(inner)
+	}
+	return inner.Handle(ctx, r)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := h.with(func(inner slog.Handler) slog.Handler { return inner.WithAttrs(attrs) })
+	for i := len(h.groups) - 1; i >= 0; i-- {
+		attrs = []slog.Attr{{Key: h.groups[i], Value: slog.GroupValue(attrs...)}}
+	}
+	c.attrs = append(c.attrs[:len(c.attrs):len(c.attrs)], attrs...)
+	return c
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	c := h.with(func(inner slog.Handler) slog.Handler { return inner.WithGroup(name) })
+	c.groups = append(c.groups[:len(c.groups):len(c.groups)], name)
+	return c
+}
+
+func (h *componentHandler) with(op func(slog.Handler) slog.Handler) *componentHandler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &componentHandler{
+		component: h.component,
+		ops:       append(ops, op),
+		attrs:     h.attrs,
+		groups:    h.groups,
+	}
+}
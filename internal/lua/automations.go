@@ -0,0 +1,424 @@
+package lua
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bledom-controller/internal/core"
+	"bledom-controller/internal/metrics"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Restart policies for automations, declared with "@restart" in the script header.
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNever     = "never"
+)
+
+// Automation states reported in AutomationStatus.
+const (
+	AutomationRunning    = "running"
+	AutomationRestarting = "restarting"
+	AutomationStopped    = "stopped"
+	AutomationFinished   = "finished"
+	AutomationFailed     = "failed"
+)
+
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+	// stableRuntime is how long a run must last for the restart delay to start over.
+	stableRuntime = time.Minute
+)
+
+// AutomationStatus describes an automation script and what it is doing.
+type AutomationStatus struct {
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Restart     string    `json:"restart"`
+	State       string    `json:"state"`
+	Since       time.Time `json:"since"`
+	Restarts    int       `json:"restarts"`
+	Error       string    `json:"error,omitempty"`
+	Line        int       `json:"line,omitempty"`
+}
+
+// Automations runs the long-lived scripts in the automations directory. Unlike patterns they
+// run side by side, each in its own Lua state and goroutine, and never drive the strip
+// directly: they observe events through on() and change the light by sending the same
+// commands as the web UI, so the foreground pattern slot stays with the user.
+type Automations struct {
+	engine  *Engine
+	dir     string
+	cmdChan core.CommandChannel
+
+	mu      sync.Mutex
+	ctx     context.Context
+	running map[string]*automation
+	status  map[string]*AutomationStatus
+	wg      sync.WaitGroup
+}
+
+// automation is a running supervisor goroutine.
+type automation struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewAutomations creates the manager. Scripts share the engine's sandbox settings, limits and
+// lib/ modules; commands they issue are sent on cmdChan.
+func NewAutomations(engine *Engine, dir string, cmdChan core.CommandChannel) *Automations {
+	return &Automations{
+		engine:  engine,
+		dir:     dir,
+		cmdChan: cmdChan,
+		ctx:     context.Background(),
+		running: make(map[string]*automation),
+		status:  make(map[string]*AutomationStatus),
+	}
+}
+
+// Start launches every automation in the directory. ctx bounds their lifetime.
+func (a *Automations) Start(ctx context.Context) {
+	a.mu.Lock()
+	a.ctx = ctx
+	a.mu.Unlock()
+
+	names, err := a.names()
+	if err != nil {
+		logger.Error("Failed to list automations", "dir", a.dir, "err", err)
+		return
+	}
+	logger.Info("Starting automations", "dir", a.dir, "count", len(names))
+	for _, name := range names {
+		if err := a.StartAutomation(name); err != nil {
+			logger.Error("Failed to start automation", "automation", name, "err", err)
+		}
+	}
+}
+
+// Stop stops every automation and waits for them to finish.
+func (a *Automations) Stop() {
+	a.mu.Lock()
+	for _, au := range a.running {
+		au.cancel()
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+}
+
+// StartAutomation starts (or restarts) the named automation.
+func (a *Automations) StartAutomation(name string) error {
+	path, err := a.path(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("automation %q not found", name)
+	}
+	a.StopAutomation(name)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ctx, cancel := context.WithCancel(a.ctx)
+	au := &automation{cancel: cancel, done: make(chan struct{})}
+	a.running[name] = au
+	a.wg.Add(1)
+	go a.supervise(ctx, name, au)
+	return nil
+}
+
+// StopAutomation stops the named automation and waits for it to end. Stopping an automation
+// that is not running does nothing.
+func (a *Automations) StopAutomation(name string) {
+	a.mu.Lock()
+	au, ok := a.running[name]
+	a.mu.Unlock()
+	if !ok {
+		return
+	}
+	au.cancel()
+	<-au.done
+}
+
+// List returns the status of every automation file, plus any still running after its file
+// was deleted, sorted by name.
+func (a *Automations) List() []AutomationStatus {
+	names, err := a.names()
+	if err != nil {
+		logger.Warn("Failed to list automations", "dir", a.dir, "err", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	seen := make(map[string]bool, len(names))
+	list := make([]AutomationStatus, 0, len(names))
+	for _, name := range names {
+		seen[name] = true
+		list = append(list, a.describe(name))
+	}
+	for name := range a.status {
+		if !seen[name] {
+			list = append(list, a.describe(name))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// describe returns the status of name with the metadata from its header. Caller holds mu.
+func (a *Automations) describe(name string) AutomationStatus {
+	st := AutomationStatus{Name: name, State: AutomationStopped}
+	if s, ok := a.status[name]; ok {
+		st = *s
+	}
+	info := a.info(name)
+	st.DisplayName, st.Description, st.Restart = info.DisplayName, info.Description, info.Restart
+	return st
+}
+
+// info parses the header of an automation file; the restart policy defaults to on-failure.
+func (a *Automations) info(name string) PatternInfo {
+	info := PatternInfo{Name: name}
+	if path, err := a.path(name); err == nil {
+		if code, err := os.ReadFile(path); err == nil {
+			info, _ = parseHeader(string(code))
+			info.Name = name
+		}
+	}
+	if info.Restart == "" {
+		info.Restart = RestartOnFailure
+	}
+	return info
+}
+
+func (a *Automations) names() ([]string, error) {
+	names := []string{}
+	files, err := os.ReadDir(a.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return names, nil
+		}
+		return nil, err
+	}
+	for _, file := range files {
+		if !file.IsDir() && filepath.Ext(file.Name()) == ".lua" {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
+// path returns the file of an automation. Names are plain file names; lib/ is not allowed.
+func (a *Automations) path(name string) (string, error) {
+	if !strings.HasSuffix(name, ".lua") || filepath.Base(name) != name || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid automation name %q", name)
+	}
+	return filepath.Join(a.dir, name), nil
+}
+
+// supervise runs an automation, restarting it according to its policy until ctx is canceled
+// or the policy says to give up.
+func (a *Automations) supervise(ctx context.Context, name string, au *automation) {
+	defer a.wg.Done()
+	defer func() {
+		a.mu.Lock()
+		if a.running[name] == au {
+			delete(a.running, name)
+		}
+		a.mu.Unlock()
+		close(au.done)
+	}()
+
+	log := logger.With("automation", name)
+	delay := minRestartDelay
+	restarts := 0
+	for {
+		a.setStatus(name, AutomationStatus{State: AutomationRunning, Restarts: restarts})
+		metrics.LuaAutomationsRunning.Inc()
+		startedAt := time.Now()
+		log.Info("Starting automation")
+		reason, err := a.run(ctx, name, log)
+		metrics.LuaAutomationsRunning.Dec()
+		if ctx.Err() != nil {
+			log.Info("Automation stopped")
+			a.setStatus(name, AutomationStatus{State: AutomationStopped, Restarts: restarts})
+			return
+		}
+
+		ended := AutomationStatus{Restarts: restarts}
+		if err != nil {
+			ended.Error, ended.Line = a.engine.describeFailure(reason, err)
+			attrs := []any{"reason", reason, "err", ended.Error}
+			if ended.Line > 0 {
+				attrs = append(attrs, "line", ended.Line)
+			}
+			log.Error("Automation failed", attrs...)
+		}
+
+		policy := a.info(name).Restart
+		if policy == RestartNever || (policy == RestartOnFailure && err == nil) {
+			ended.State = AutomationFinished
+			if err != nil {
+				ended.State = AutomationFailed
+			}
+			log.Info("Automation ended", "state", ended.State)
+			a.setStatus(name, ended)
+			return
+		}
+
+		if time.Since(startedAt) >= stableRuntime {
+			delay = minRestartDelay
+		}
+		ended.State = AutomationRestarting
+		a.setStatus(name, ended)
+		log.Info("Restarting automation", "delay", delay)
+		if cancellableSleep(ctx, delay) {
+			log.Info("Automation stopped")
+			a.setStatus(name, AutomationStatus{State: AutomationStopped, Restarts: restarts})
+			return
+		}
+		delay = min(delay*2, maxRestartDelay)
+		restarts++
+		metrics.LuaAutomationRestarts.WithLabelValues(name).Inc()
+	}
+}
+
+// run executes an automation once in a fresh state. Like a pattern, a script that registered
+// callbacks keeps running to handle events. reason classifies a failure (see terminationReason).
+func (a *Automations) run(ctx context.Context, name string, log *slog.Logger) (string, error) {
+	e := a.engine
+	path, err := a.path(name)
+	if err != nil {
+		return "error", err
+	}
+
+	scriptCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// Automations are trusted like patterns, listed as "automations/<name>" in trusted_patterns.
+	lim := e.limits.forAutomation()
+	L := newState(e.isTrusted("automations/"+name, cmdRunFile), lim.stateOptions(), filepath.Join(e.patternsDir, libDirName))
+	defer L.Close()
+	lim.apply(L)
+	L.SetContext(newBudgetContext(scriptCtx, cancel, lim, time.Now))
+
+	hooks := newHookSet(L, scriptCtx, e.eventBus)
+	defer hooks.close()
+	e.registerBaseFunctions(L, scriptCtx, hooks, log)
+	a.registerCommandFunctions(L, scriptCtx)
+
+	err = L.DoFile(path)
+	if err == nil && hooks.active() {
+		err = hooks.run()
+	}
+	if err != nil {
+		return terminationReason(scriptCtx, err), err
+	}
+	return "", nil
+}
+
+// setStatus records a status change and publishes the full list.
+func (a *Automations) setStatus(name string, st AutomationStatus) {
+	st.Name = name
+	st.Since = time.Now()
+	a.mu.Lock()
+	a.status[name] = &st
+	a.mu.Unlock()
+
+	if a.engine.eventBus != nil {
+		a.engine.eventBus.Publish(core.Event{Type: core.AutomationStatusEvent, Payload: a.List()})
+	}
+}
+
+// registerCommandFunctions exposes functions that change the light by sending commands to
+// the agent, exactly as if the user had used the web UI.
+func (a *Automations) registerCommandFunctions(L *lua.LState, ctx context.Context) {
+	send := func(t core.CommandType, payload map[string]interface{}) {
+		select {
+		case a.cmdChan <- core.Command{Type: t, Payload: payload}:
+		case <-ctx.Done():
+		}
+	}
+
+	L.SetGlobal("set_power", L.NewFunction(func(L *lua.LState) int {
+		send(core.CmdSetPower, map[string]interface{}{"isOn": L.ToBool(1)})
+		return 0
+	}))
+	L.SetGlobal("set_color", L.NewFunction(func(L *lua.LState) int {
+		c, ok := toColor(L.Get(1))
+		if !ok || L.GetTop() > 1 {
+			c = rgb{float64(L.CheckInt(1)), float64(L.CheckInt(2)), float64(L.CheckInt(3))}
+		}
+		r, g, b := c.ints()
+		send(core.CmdSetColor, map[string]interface{}{"r": float64(r), "g": float64(g), "b": float64(b)})
+		return 0
+	}))
+	L.SetGlobal("set_brightness", L.NewFunction(func(L *lua.LState) int {
+		send(core.CmdSetBrightness, map[string]interface{}{"value": float64(L.CheckInt(1))})
+		return 0
+	}))
+	L.SetGlobal("set_speed", L.NewFunction(func(L *lua.LState) int {
+		send(core.CmdSetSpeed, map[string]interface{}{"value": float64(L.CheckInt(1))})
+		return 0
+	}))
+	L.SetGlobal("run_pattern", L.NewFunction(func(L *lua.LState) int {
+		payload := map[string]interface{}{"name": L.CheckString(1)}
+		if t := L.OptTable(2, nil); t != nil {
+			payload["params"] = tableToParams(t)
+		}
+		send(core.CmdRunPattern, payload)
+		return 0
+	}))
+	L.SetGlobal("stop_pattern", L.NewFunction(func(L *lua.LState) int {
+		send(core.CmdStopPattern, nil)
+		return 0
+	}))
+	L.SetGlobal("get_pattern", L.NewFunction(func(L *lua.LState) int {
+		if a.engine.state == nil {
+			L.Push(lua.LNil)
+			return 1
+		}
+		if running := a.engine.state.Clone().RunningPattern; running != "" {
+			L.Push(lua.LString(running))
+			return 1
+		}
+		L.Push(lua.LNil)
+		return 1
+	}))
+}
+
+// tableToParams converts a Lua table of pattern parameters to the values a command carries:
+// numbers, booleans and strings, with colors as "#rrggbb".
+func tableToParams(t *lua.LTable) map[string]interface{} {
+	params := make(map[string]interface{})
+	t.ForEach(func(k, v lua.LValue) {
+		key, ok := k.(lua.LString)
+		if !ok {
+			return
+		}
+		switch v := v.(type) {
+		case lua.LNumber:
+			params[string(key)] = float64(v)
+		case lua.LBool:
+			params[string(key)] = bool(v)
+		case lua.LString:
+			params[string(key)] = string(v)
+		case *lua.LTable:
+			if c, ok := toColor(v); ok {
+				params[string(key)] = c.hex()
+			}
+		}
+	})
+	return params
+}
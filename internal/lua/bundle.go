@@ -0,0 +1,505 @@
+package lua
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Archive formats of a pattern bundle.
+const (
+	BundleZip   = "zip"
+	BundleTarGz = "tar.gz"
+)
+
+// How an import treats a file that exists with different code.
+const (
+	ImportAsk       = ""          // import nothing and report the conflicts
+	ImportSkip      = "skip"      // keep the existing file
+	ImportOverwrite = "overwrite" // replace it; the old code stays in the history
+	ImportRename    = "rename"    // import under a free name, such as "police-2.lua"
+)
+
+// Statuses of a file in an ImportResult.
+const (
+	ImportAdded       = "added"
+	ImportOverwritten = "overwritten"
+	ImportRenamed     = "renamed"
+	ImportUnchanged   = "unchanged" // the same code exists already
+	ImportSkipped     = "skipped"
+	ImportConflict    = "conflict"
+	ImportInvalid     = "invalid"
+)
+
+// MaxBundleSize bounds an imported bundle, both packed and unpacked.
+const MaxBundleSize = 8 << 20
+
+const (
+	bundleManifestName = "manifest.json"
+	bundleVersion      = 1
+)
+
+var (
+	// ErrInvalidBundle is returned (wrapped) for a bundle that cannot be imported as is.
+	ErrInvalidBundle = errors.New("invalid bundle")
+	// ErrImportConflict is returned when an import with ImportAsk would replace existing files.
+	ErrImportConflict = errors.New("bundle conflicts with existing patterns")
+)
+
+// BundleManifest describes the files of a pattern bundle. It is stored as manifest.json next
+// to them.
+type BundleManifest struct {
+	Version int          `json:"version"`
+	Created time.Time    `json:"created"`
+	Files   []BundleFile `json:"files"`
+}
+
+// BundleFile is a pattern ("police.lua") or shared module ("lib/util.lua") in a bundle.
+type BundleFile struct {
+	Name     string       `json:"name"`
+	SHA256   string       `json:"sha256"`
+	Size     int          `json:"size"`
+	Requires []string     `json:"requires,omitempty"` // modules loaded with require()
+	Info     *PatternInfo `json:"info,omitempty"`     // header metadata of a pattern
+}
+
+// ImportResult reports what an import did, or would do, with each file of a bundle.
+type ImportResult struct {
+	Files []ImportedFile `json:"files"`
+}
+
+// ImportedFile is the outcome for one file. As is the name it was imported under when renamed.
+type ImportedFile struct {
+	Name   string `json:"name"`
+	As     string `json:"as,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// bundleEntry is a file to be written to an archive.
+type bundleEntry struct {
+	name string
+	data []byte
+}
+
+// ExportPatterns writes the named patterns, or all patterns when names is empty, as a bundle
+// in the given format. The shared modules they require are included. It returns the manifest.
+func (e *Engine) ExportPatterns(w io.Writer, names []string, format string) (*BundleManifest, error) {
+	if format != BundleZip && format != BundleTarGz {
+		return nil, fmt.Errorf("unknown bundle format %q (want %s or %s)", format, BundleZip, BundleTarGz)
+	}
+	if len(names) == 0 {
+		all, err := e.GetPatternNames()
+		if err != nil {
+			return nil, err
+		}
+		names = all
+	}
+
+	manifest := &BundleManifest{Version: bundleVersion, Created: time.Now().UTC(), Files: []BundleFile{}}
+	var entries []bundleEntry
+	seen := make(map[string]bool)
+	for len(names) > 0 {
+		name := names[0]
+		names = names[1:]
+		clean, err := sanitizeFilename(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if seen[clean] {
+			continue
+		}
+		seen[clean] = true
+		code, err := e.GetPatternCode(clean)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", clean, err)
+		}
+
+		file := BundleFile{Name: clean, SHA256: hashCode(code), Size: len(code)}
+		modules, diag := requiredModules(clean, code)
+		if diag != nil {
+			logger.Warn("Exporting pattern with a syntax error", "pattern", clean, "line", diag.Line, "err", diag.Message)
+		}
+		for _, module := range modules {
+			file.Requires = append(file.Requires, module)
+			path := libDirName + "/" + module + ".lua"
+			if _, err := e.GetPatternCode(path); err != nil {
+				logger.Warn("Required module not found, not exporting it", "pattern", clean, "module", module)
+				continue
+			}
+			names = append(names, path)
+		}
+		if !isLibraryModule(clean) {
+			info, errs := parseHeader(code)
+			info.Name = clean
+			if len(errs) > 0 {
+				logger.Warn("Exporting pattern with invalid header lines", "pattern", clean, "errors", len(errs))
+			}
+			file.Info = &info
+		}
+		manifest.Files = append(manifest.Files, file)
+		entries = append(entries, bundleEntry{clean, []byte(code)})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	entries = append([]bundleEntry{{bundleManifestName, data}}, entries...)
+	if format == BundleZip {
+		return manifest, writeZip(w, entries, manifest.Created)
+	}
+	return manifest, writeTarGz(w, entries, manifest.Created)
+}
+
+// ImportPatterns unpacks a bundle (zip or tar.gz, told apart by content) into the patterns
+// directory, recording each write in the history by author. Every file must be listed in the
+// manifest with its hash, have a name that sanitizeFilename leaves unchanged, and compile;
+// otherwise nothing is imported and the error wraps ErrInvalidBundle. A file that exists with
+// different code is handled by onConflict. Modules imported under a new name are required
+// under it by the imported files.
+func (e *Engine) ImportPatterns(data []byte, onConflict, author string) (*ImportResult, error) {
+	switch onConflict {
+	case ImportAsk, ImportSkip, ImportOverwrite, ImportRename:
+	default:
+		return nil, fmt.Errorf("unknown conflict handling %q", onConflict)
+	}
+	files, err := readBundle(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	manifest, err := parseManifest(files)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+
+	result := &ImportResult{Files: []ImportedFile{}}
+	invalid := 0
+	listed := make(map[string]bool)
+	for _, f := range manifest.Files {
+		imported := ImportedFile{Name: f.Name}
+		if msg := validateBundleFile(f, files, listed); msg != "" {
+			imported.Status, imported.Error = ImportInvalid, msg
+			invalid++
+		}
+		listed[f.Name] = true
+		result.Files = append(result.Files, imported)
+	}
+	var unlisted []string
+	for name := range files {
+		if name != bundleManifestName && !listed[name] {
+			unlisted = append(unlisted, name)
+		}
+	}
+	sort.Strings(unlisted)
+	for _, name := range unlisted {
+		result.Files = append(result.Files, ImportedFile{Name: name, Status: ImportInvalid, Error: "not listed in the manifest"})
+		invalid++
+	}
+	if invalid > 0 {
+		for i := range result.Files {
+			if result.Files[i].Status == "" {
+				result.Files[i].Status = ImportSkipped
+			}
+		}
+		return result, fmt.Errorf("%w: %d of %d files rejected", ErrInvalidBundle, invalid, len(result.Files))
+	}
+
+	// Find what exists, and where conflicting files go.
+	taken := make(map[string]bool)
+	for _, f := range manifest.Files {
+		taken[f.Name] = true
+	}
+	conflicts := 0
+	renames := make(map[string]string) // module name -> new module name
+	for i := range result.Files {
+		imported := &result.Files[i]
+		current, err := e.GetPatternCode(imported.Name)
+		switch {
+		case os.IsNotExist(err):
+			imported.Status = ImportAdded
+			continue
+		case err != nil:
+			return result, err
+		case current == string(files[imported.Name]):
+			imported.Status = ImportUnchanged
+			continue
+		}
+		switch onConflict {
+		case ImportAsk:
+			imported.Status = ImportConflict
+			conflicts++
+		case ImportSkip:
+			imported.Status = ImportSkipped
+		case ImportOverwrite:
+			imported.Status = ImportOverwritten
+		case ImportRename:
+			as, err := e.freeName(imported.Name, taken)
+			if err != nil {
+				return result, err
+			}
+			imported.Status, imported.As = ImportRenamed, as
+			taken[imported.As] = true
+			if isLibraryModule(imported.Name) {
+				renames[moduleName(imported.Name)] = moduleName(imported.As)
+			}
+		}
+	}
+	if conflicts > 0 {
+		return result, fmt.Errorf("%w: %d of %d files", ErrImportConflict, conflicts, len(result.Files))
+	}
+
+	for i := range result.Files {
+		imported := &result.Files[i]
+		if imported.Status == ImportUnchanged || imported.Status == ImportSkipped {
+			continue
+		}
+		name := imported.Name
+		if imported.As != "" {
+			name = imported.As
+		}
+		path, err := e.GetPatternPath(name)
+		if err != nil {
+			return result, err
+		}
+		code := renameRequires(string(files[imported.Name]), renames)
+		if err := e.writePattern(name, path, code, Revision{Action: RevisionImport, Author: author}); err != nil {
+			return result, fmt.Errorf("%s: %w", name, err)
+		}
+		logger.Info("Imported pattern", "pattern", name, "status", imported.Status)
+	}
+	return result, nil
+}
+
+// validateBundleFile returns why a file listed in the manifest cannot be imported, or "".
+func validateBundleFile(f BundleFile, files map[string][]byte, listed map[string]bool) string {
+	clean, err := sanitizeFilename(f.Name)
+	if err != nil {
+		return err.Error()
+	}
+	if clean != f.Name {
+		return "invalid file name"
+	}
+	if listed[f.Name] {
+		return "listed twice in the manifest"
+	}
+	data, ok := files[f.Name]
+	if !ok {
+		return "missing from the bundle"
+	}
+	if hashCode(string(data)) != f.SHA256 {
+		return "content does not match the manifest's checksum"
+	}
+	if _, diag := requiredModules(f.Name, string(data)); diag != nil {
+		return fmt.Sprintf("syntax error on line %d: %s", diag.Line, diag.Message)
+	}
+	return ""
+}
+
+// maxRenameTries bounds the copies freeName tries before giving up.
+const maxRenameTries = 100
+
+// freeName returns a name for a copy of a pattern or module that is neither on disk nor taken:
+// "police.lua" becomes "police-2.lua", or "police-3.lua" and so on.
+func (e *Engine) freeName(name string, taken map[string]bool) (string, error) {
+	base := strings.TrimSuffix(name, ".lua")
+	for n := 2; n < maxRenameTries+2; n++ {
+		candidate := fmt.Sprintf("%s-%d.lua", base, n)
+		if taken[candidate] {
+			continue
+		}
+		_, err := e.GetPatternCode(candidate)
+		switch {
+		case os.IsNotExist(err):
+			return candidate, nil
+		case err != nil:
+			return "", fmt.Errorf("renaming %s: %w", name, err)
+		}
+	}
+	return "", fmt.Errorf("renaming %s: no free name after %d tries", name, maxRenameTries)
+}
+
+// moduleName returns the name require() loads a module by: "lib/util.lua" -> "util".
+func moduleName(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, libDirName+"/"), ".lua")
+}
+
+// requiredModules returns the modules code loads with require() and a literal name, or the
+// syntax error that keeps it from compiling.
+func requiredModules(name, code string) ([]string, *Diagnostic) {
+	chunk, err := parse.Parse(strings.NewReader(code), name)
+	if err == nil {
+		_, err = lua.Compile(chunk, name)
+	}
+	if err != nil {
+		d := syntaxDiagnostic(err, code)
+		return nil, &d
+	}
+	var modules []string
+	seen := make(map[string]bool)
+	walkStmts(chunk, func(stmt ast.Stmt) {
+		for _, expr := range stmtExprs(stmt) {
+			walkCallExprs(expr, func(call *ast.FuncCallExpr) {
+				fn, ok := call.Func.(*ast.IdentExpr)
+				if !ok || fn.Value != "require" || len(call.Args) != 1 {
+					return
+				}
+				arg, ok := call.Args[0].(*ast.StringExpr)
+				if ok && moduleNamePattern.MatchString(arg.Value) && !seen[arg.Value] {
+					seen[arg.Value] = true
+					modules = append(modules, arg.Value)
+				}
+			})
+		}
+	})
+	return modules, nil
+}
+
+// renameRequires points require() calls with a literal module name at the module's new name.
+func renameRequires(code string, renames map[string]string) string {
+	for from, to := range renames {
+		re := regexp.MustCompile(`(\brequire\s*\(?\s*["'])` + regexp.QuoteMeta(from) + `(["'])`)
+		code = re.ReplaceAllString(code, "${1}"+to+"${2}")
+	}
+	return code
+}
+
+// parseManifest decodes the bundle's manifest.json.
+func parseManifest(files map[string][]byte) (*BundleManifest, error) {
+	data, ok := files[bundleManifestName]
+	if !ok {
+		return nil, fmt.Errorf("no %s", bundleManifestName)
+	}
+	var manifest BundleManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %v", bundleManifestName, err)
+	}
+	if manifest.Version < 1 || manifest.Version > bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", manifest.Version)
+	}
+	if len(manifest.Files) == 0 {
+		return nil, errors.New("the bundle has no patterns")
+	}
+	return &manifest, nil
+}
+
+// readBundle returns the regular files of a zip or tar.gz archive by name. Their total size
+// is limited to MaxBundleSize.
+func readBundle(data []byte) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	total := int64(0)
+	add := func(name string, r io.Reader) error {
+		if _, ok := files[name]; ok {
+			return fmt.Errorf("%s appears twice", name)
+		}
+		content, err := io.ReadAll(io.LimitReader(r, MaxBundleSize-total+1))
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		total += int64(len(content))
+		if total > MaxBundleSize {
+			return fmt.Errorf("unpacks to more than %d MiB", MaxBundleSize>>20)
+		}
+		files[name] = content
+		return nil
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if !f.Mode().IsRegular() {
+				return nil, fmt.Errorf("%s is not a regular file", f.Name)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.Name, err)
+			}
+			err = add(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			switch hdr.Typeflag {
+			case tar.TypeDir:
+				continue
+			case tar.TypeReg:
+				if err := add(strings.TrimPrefix(hdr.Name, "./"), tr); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, fmt.Errorf("%s is not a regular file", hdr.Name)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("not a %s or %s archive", BundleZip, BundleTarGz)
+	}
+	return files, nil
+}
+
+func writeZip(w io.Writer, entries []bundleEntry, modified time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range entries {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(entry.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, entries []bundleEntry, modified time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		hdr := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.data)), ModTime: modified, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
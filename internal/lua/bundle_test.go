@@ -0,0 +1,36 @@
+package lua
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFreeName(t *testing.T) {
+	dir := t.TempDir()
+	e := &Engine{patternsDir: dir}
+	for _, name := range []string{"police.lua", "police-2.lua"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("sleep(1)"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := e.freeName("police.lua", map[string]bool{"police-3.lua": true})
+	if err != nil || got != "police-4.lua" {
+		t.Errorf("freeName = %q, %v; want police-4.lua", got, err)
+	}
+
+	// An error other than a missing file must end the search rather than loop forever.
+	if got, err := e.freeName(strings.Repeat("x", 300)+".lua", nil); err == nil {
+		t.Errorf("freeName of an overlong name = %q, want an error", got)
+	}
+
+	taken := make(map[string]bool)
+	for n := 2; n < maxRenameTries+2; n++ {
+		taken[fmt.Sprintf("busy-%d.lua", n)] = true
+	}
+	if got, err := e.freeName("busy.lua", taken); err == nil {
+		t.Errorf("freeName with every candidate taken = %q, want an error", got)
+	}
+}
@@ -0,0 +1,304 @@
+package lua
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rgb is a color with channels in the 0-255 range. Channels stay fractional during math
+// and are rounded and clamped only when the color leaves Go.
+type rgb struct{ r, g, b float64 }
+
+func (c rgb) ints() (int, int, int) {
+	return clampChannel(c.r), clampChannel(c.g), clampChannel(c.b)
+}
+
+func (c rgb) hex() string {
+	r, g, b := c.ints()
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+func clampChannel(v float64) int {
+	return int(math.Round(math.Max(0, math.Min(255, v))))
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// parseHexColor parses "#rrggbb" or "rrggbb".
+func parseHexColor(s string) (rgb, error) {
+	m := colorPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return rgb{}, fmt.Errorf("invalid color %q (expected #rrggbb)", s)
+	}
+	v, _ := strconv.ParseUint(m[1], 16, 32)
+	return rgb{float64(v >> 16 & 0xff), float64(v >> 8 & 0xff), float64(v & 0xff)}, nil
+}
+
+// hsvToRGB converts hue (degrees), saturation and value (0-1).
+func hsvToRGB(h, s, v float64) rgb {
+	h = math.Mod(math.Mod(h, 360)+360, 360)
+	s, v = clamp01(s), clamp01(v)
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	return hueSector(h, c, x, v-c)
+}
+
+func rgbToHSV(c rgb) (h, s, v float64) {
+	r, g, b := c.r/255, c.g/255, c.b/255
+	max, min := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	v = max
+	if max > 0 {
+		s = (max - min) / max
+	}
+	return hue(r, g, b, max, min), s, v
+}
+
+// hslToRGB converts hue (degrees), saturation and lightness (0-1).
+func hslToRGB(h, s, l float64) rgb {
+	h = math.Mod(math.Mod(h, 360)+360, 360)
+	s, l = clamp01(s), clamp01(l)
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	return hueSector(h, c, x, l-c/2)
+}
+
+func rgbToHSL(c rgb) (h, s, l float64) {
+	r, g, b := c.r/255, c.g/255, c.b/255
+	max, min := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	l = (max + min) / 2
+	if d := max - min; d > 0 {
+		s = d / (1 - math.Abs(2*l-1))
+	}
+	return hue(r, g, b, max, min), s, l
+}
+
+// hueSector places chroma c and the second component x by hue sector, then adds m.
+func hueSector(h, c, x, m float64) rgb {
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return rgb{(r + m) * 255, (g + m) * 255, (b + m) * 255}
+}
+
+func hue(r, g, b, max, min float64) float64 {
+	d := max - min
+	if d == 0 {
+		return 0
+	}
+	var h float64
+	switch max {
+	case r:
+		h = math.Mod((g-b)/d, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// oklab is a perceptual color space: equal steps look roughly equally different, so
+// interpolating in it avoids the muddy midpoints of plain RGB interpolation.
+type oklab struct{ l, a, b float64 }
+
+func srgbToLinear(v float64) float64 {
+	v /= 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92 * 255
+	}
+	return (1.055*math.Pow(v, 1/2.4) - 0.055) * 255
+}
+
+func (c rgb) oklab() oklab {
+	r, g, b := srgbToLinear(c.r), srgbToLinear(c.g), srgbToLinear(c.b)
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+	return oklab{
+		l: 0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		a: 1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		b: 0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+func (c oklab) rgb() rgb {
+	l := c.l + 0.3963377774*c.a + 0.2158037573*c.b
+	m := c.l - 0.1055613458*c.a - 0.0638541728*c.b
+	s := c.l - 0.0894841775*c.a - 1.2914855480*c.b
+	l, m, s = l*l*l, m*m*m, s*s*s
+	return rgb{
+		linearToSRGB(4.0767416621*l - 3.3077115913*m + 0.2309699292*s),
+		linearToSRGB(-1.2684380046*l + 2.6097574011*m - 0.3413193965*s),
+		linearToSRGB(-0.0041960863*l - 0.7034186147*m + 1.7076147010*s),
+	}
+}
+
+// lerpRGB interpolates each channel linearly.
+func lerpRGB(a, b rgb, t float64) rgb {
+	return rgb{a.r + (b.r-a.r)*t, a.g + (b.g-a.g)*t, a.b + (b.b-a.b)*t}
+}
+
+// lerpPerceptual interpolates in OKLab.
+func lerpPerceptual(a, b rgb, t float64) rgb {
+	pa, pb := a.oklab(), b.oklab()
+	return oklab{pa.l + (pb.l-pa.l)*t, pa.a + (pb.a-pa.a)*t, pa.b + (pb.b-pa.b)*t}.rgb()
+}
+
+// blendModes combine two colors channel by channel (values 0-1).
+var blendModes = map[string]func(a, b float64) float64{
+	"multiply": func(a, b float64) float64 { return a * b },
+	"screen":   func(a, b float64) float64 { return 1 - (1-a)*(1-b) },
+	"add":      func(a, b float64) float64 { return math.Min(1, a+b) },
+	"average":  func(a, b float64) float64 { return (a + b) / 2 },
+	"overlay": func(a, b float64) float64 {
+		if a < 0.5 {
+			return 2 * a * b
+		}
+		return 1 - 2*(1-a)*(1-b)
+	},
+}
+
+func blend(a, b rgb, mode string) (rgb, error) {
+	fn, ok := blendModes[mode]
+	if !ok {
+		return rgb{}, fmt.Errorf("unknown blend mode %q (one of %s)", mode, strings.Join(sortedKeys(blendModes), ", "))
+	}
+	ch := func(x, y float64) float64 { return fn(x/255, y/255) * 255 }
+	return rgb{ch(a.r, b.r), ch(a.g, b.g), ch(a.b, b.b)}, nil
+}
+
+// easings map a progress value in [0, 1] to an eased value, following the usual
+// easings.net definitions.
+var easings = map[string]func(t float64) float64{
+	"linear":        func(t float64) float64 { return t },
+	"in_quad":       func(t float64) float64 { return t * t },
+	"out_quad":      func(t float64) float64 { return 1 - (1-t)*(1-t) },
+	"in_out_quad":   inOut(func(t float64) float64 { return t * t }),
+	"in_cubic":      func(t float64) float64 { return t * t * t },
+	"out_cubic":     func(t float64) float64 { return 1 - math.Pow(1-t, 3) },
+	"in_out_cubic":  inOut(func(t float64) float64 { return t * t * t }),
+	"in_sine":       func(t float64) float64 { return 1 - math.Cos(t*math.Pi/2) },
+	"out_sine":      func(t float64) float64 { return math.Sin(t * math.Pi / 2) },
+	"in_out_sine":   func(t float64) float64 { return -(math.Cos(math.Pi*t) - 1) / 2 },
+	"in_bounce":     func(t float64) float64 { return 1 - outBounce(1-t) },
+	"out_bounce":    outBounce,
+	"in_out_bounce": inOut(func(t float64) float64 { return 1 - outBounce(1-t) }),
+	"in_expo":       expo,
+	"out_expo":      func(t float64) float64 { return 1 - expo(1-t) },
+	"in_out_expo":   inOut(expo),
+	"smoothstep":    func(t float64) float64 { return t * t * (3 - 2*t) },
+	"smootherstep":  func(t float64) float64 { return t * t * t * (t*(t*6-15) + 10) },
+}
+
+// inOut builds a symmetric ease-in-out from an ease-in function.
+func inOut(in func(float64) float64) func(float64) float64 {
+	return func(t float64) float64 {
+		if t < 0.5 {
+			return in(2*t) / 2
+		}
+		return 1 - in(2*(1-t))/2
+	}
+}
+
+func expo(t float64) float64 {
+	if t == 0 {
+		return 0
+	}
+	return math.Pow(2, 10*t-10)
+}
+
+func outBounce(t float64) float64 {
+	const n1, d1 = 7.5625, 2.75
+	switch {
+	case t < 1/d1:
+		return n1 * t * t
+	case t < 2/d1:
+		t -= 1.5 / d1
+		return n1*t*t + 0.75
+	case t < 2.5/d1:
+		t -= 2.25 / d1
+		return n1*t*t + 0.9375
+	default:
+		t -= 2.625 / d1
+		return n1*t*t + 0.984375
+	}
+}
+
+// ease applies a named easing function to t, clamped to [0, 1].
+func ease(name string, t float64) (float64, error) {
+	fn, ok := easings[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown easing %q (one of %s)", name, strings.Join(sortedKeys(easings), ", "))
+	}
+	return fn(clamp01(t)), nil
+}
+
+// palettes are the named color sets available to gradients.
+var palettes = map[string][]rgb{
+	"fire":    {{0, 0, 0}, {128, 17, 0}, {255, 69, 0}, {255, 140, 0}, {255, 215, 0}, {255, 250, 205}},
+	"ocean":   {{0, 18, 51}, {0, 60, 130}, {0, 119, 190}, {0, 180, 200}, {72, 209, 204}},
+	"sunset":  {{255, 94, 77}, {255, 149, 0}, {255, 204, 92}, {199, 81, 132}, {88, 40, 120}},
+	"rainbow": {{255, 0, 0}, {255, 127, 0}, {255, 255, 0}, {0, 255, 0}, {0, 0, 255}, {75, 0, 130}, {148, 0, 211}},
+	"forest":  {{20, 50, 10}, {34, 139, 34}, {107, 142, 35}, {154, 205, 50}},
+	"ice":     {{240, 248, 255}, {173, 216, 230}, {0, 191, 255}, {70, 130, 180}},
+}
+
+// gradient samples evenly spaced stops at pos (0-1), interpolating perceptually. With wrap,
+// the last stop blends back into the first, so positions past 1 repeat.
+func gradient(stops []rgb, pos float64, wrap bool) rgb {
+	switch len(stops) {
+	case 0:
+		return rgb{}
+	case 1:
+		return stops[0]
+	}
+	if wrap {
+		pos -= math.Floor(pos)
+		stops = append(stops[:len(stops):len(stops)], stops[0])
+	} else {
+		pos = clamp01(pos)
+	}
+	scaled := pos * float64(len(stops)-1)
+	i := int(scaled)
+	if i >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+	return lerpPerceptual(stops[i], stops[i+1], scaled-float64(i))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,175 @@
+package lua
+
+import (
+	lua "github.com/yuin/gopher-lua"
+)
+
+// openColorLib registers the global color table: conversions, perceptual interpolation,
+// blending, easing, gradients and named palettes. Colors are returned as tables with r, g, b
+// and hex fields that can also be indexed as {r, g, b}; functions accept such tables, plain
+// {r, g, b} arrays and "#rrggbb" strings.
+func openColorLib(L *lua.LState) {
+	mod := L.NewTable()
+	L.SetFuncs(mod, map[string]lua.LGFunction{
+		"rgb": func(L *lua.LState) int {
+			L.Push(newColorTable(L, rgb{float64(L.CheckNumber(1)), float64(L.CheckNumber(2)), float64(L.CheckNumber(3))}))
+			return 1
+		},
+		"parse": func(L *lua.LState) int {
+			L.Push(newColorTable(L, checkColor(L, 1)))
+			return 1
+		},
+		"hex": func(L *lua.LState) int {
+			L.Push(lua.LString(checkColor(L, 1).hex()))
+			return 1
+		},
+		"hsv": func(L *lua.LState) int {
+			L.Push(newColorTable(L, hsvToRGB(float64(L.CheckNumber(1)), float64(L.CheckNumber(2)), float64(L.CheckNumber(3)))))
+			return 1
+		},
+		"to_hsv": func(L *lua.LState) int {
+			h, s, v := rgbToHSV(checkColor(L, 1))
+			L.Push(lua.LNumber(h))
+			L.Push(lua.LNumber(s))
+			L.Push(lua.LNumber(v))
+			return 3
+		},
+		"hsl": func(L *lua.LState) int {
+			L.Push(newColorTable(L, hslToRGB(float64(L.CheckNumber(1)), float64(L.CheckNumber(2)), float64(L.CheckNumber(3)))))
+			return 1
+		},
+		"to_hsl": func(L *lua.LState) int {
+			h, s, l := rgbToHSL(checkColor(L, 1))
+			L.Push(lua.LNumber(h))
+			L.Push(lua.LNumber(s))
+			L.Push(lua.LNumber(l))
+			return 3
+		},
+		"lerp": func(L *lua.LState) int {
+			L.Push(newColorTable(L, lerpPerceptual(checkColor(L, 1), checkColor(L, 2), clamp01(float64(L.CheckNumber(3))))))
+			return 1
+		},
+		"lerp_rgb": func(L *lua.LState) int {
+			L.Push(newColorTable(L, lerpRGB(checkColor(L, 1), checkColor(L, 2), clamp01(float64(L.CheckNumber(3))))))
+			return 1
+		},
+		"blend": func(L *lua.LState) int {
+			c, err := blend(checkColor(L, 1), checkColor(L, 2), L.OptString(3, "average"))
+			if err != nil {
+				L.ArgError(3, err.Error())
+			}
+			L.Push(newColorTable(L, c))
+			return 1
+		},
+		"scale": func(L *lua.LState) int {
+			c, f := checkColor(L, 1), float64(L.CheckNumber(2))
+			L.Push(newColorTable(L, rgb{c.r * f, c.g * f, c.b * f}))
+			return 1
+		},
+		"ease": func(L *lua.LState) int {
+			v, err := ease(L.CheckString(1), float64(L.CheckNumber(2)))
+			if err != nil {
+				L.ArgError(1, err.Error())
+			}
+			L.Push(lua.LNumber(v))
+			return 1
+		},
+		"gradient": func(L *lua.LState) int {
+			stops := checkStops(L, 1)
+			L.Push(newColorTable(L, gradient(stops, float64(L.CheckNumber(2)), L.OptBool(3, false))))
+			return 1
+		},
+		"palette": func(L *lua.LState) int {
+			name := L.CheckString(1)
+			p, ok := palettes[name]
+			if !ok {
+				L.ArgError(1, "unknown palette "+name)
+			}
+			t := L.CreateTable(len(p), 0)
+			for _, c := range p {
+				t.Append(newColorTable(L, c))
+			}
+			L.Push(t)
+			return 1
+		},
+		"palettes": func(L *lua.LState) int {
+			t := L.NewTable()
+			for _, name := range sortedKeys(palettes) {
+				t.Append(lua.LString(name))
+			}
+			L.Push(t)
+			return 1
+		},
+	})
+	L.SetGlobal("color", mod)
+}
+
+// newColorTable converts c to the table representation used by scripts.
+func newColorTable(L *lua.LState, c rgb) *lua.LTable {
+	r, g, b := c.ints()
+	t := L.CreateTable(3, 4)
+	t.RawSetInt(1, lua.LNumber(r))
+	t.RawSetInt(2, lua.LNumber(g))
+	t.RawSetInt(3, lua.LNumber(b))
+	t.RawSetString("r", lua.LNumber(r))
+	t.RawSetString("g", lua.LNumber(g))
+	t.RawSetString("b", lua.LNumber(b))
+	t.RawSetString("hex", lua.LString(c.hex()))
+	return t
+}
+
+// toColor converts a color table, {r, g, b} array or "#rrggbb" string.
+func toColor(v lua.LValue) (rgb, bool) {
+	switch v := v.(type) {
+	case *lua.LTable:
+		if r, ok := v.RawGetString("r").(lua.LNumber); ok {
+			g, _ := v.RawGetString("g").(lua.LNumber)
+			b, _ := v.RawGetString("b").(lua.LNumber)
+			return rgb{float64(r), float64(g), float64(b)}, true
+		}
+		r, ok := v.RawGetInt(1).(lua.LNumber)
+		if !ok {
+			return rgb{}, false
+		}
+		g, _ := v.RawGetInt(2).(lua.LNumber)
+		b, _ := v.RawGetInt(3).(lua.LNumber)
+		return rgb{float64(r), float64(g), float64(b)}, true
+	case lua.LString:
+		c, err := parseHexColor(string(v))
+		return c, err == nil
+	}
+	return rgb{}, false
+}
+
+// checkColor returns argument n as a color or raises an argument error.
+func checkColor(L *lua.LState, n int) rgb {
+	c, ok := toColor(L.Get(n))
+	if !ok {
+		L.ArgError(n, "color expected (a {r, g, b} table or \"#rrggbb\" string)")
+	}
+	return c
+}
+
+// checkStops returns argument n as gradient stops: a palette name or an array of colors.
+func checkStops(L *lua.LState, n int) []rgb {
+	switch v := L.Get(n).(type) {
+	case lua.LString:
+		p, ok := palettes[string(v)]
+		if !ok {
+			L.ArgError(n, "unknown palette "+string(v))
+		}
+		return p
+	case *lua.LTable:
+		stops := make([]rgb, 0, v.Len())
+		for i := 1; i <= v.Len(); i++ {
+			c, ok := toColor(v.RawGetInt(i))
+			if !ok {
+				L.ArgError(n, "gradient stops must be colors")
+			}
+			stops = append(stops, c)
+		}
+		return stops
+	}
+	L.ArgError(n, "palette name or array of colors expected")
+	return nil
+}
@@ -3,56 +3,122 @@ package lua
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"bledom-controller/internal/ble"
+	"bledom-controller/internal/config"
 	"bledom-controller/internal/core"
+	"bledom-controller/internal/logging"
+	"bledom-controller/internal/metrics"
 
 	lua "github.com/yuin/gopher-lua"
 )
 
+var logger = logging.Logger("lua")
+
 // cmdType defines the type of engine command.
 type cmdType int
 
 const (
 	cmdRunFile cmdType = iota
 	cmdRunString
+	cmdRunPlaylist
+	// cmdTimeUp performs the end action of a time-limited run without running the pattern.
+	cmdTimeUp
 	cmdStop
 )
 
+// How long the worker waits for a canceled script: it logs a warning after stopWarnAfter and
+// abandons the script after stopAbandonAfter.
+const (
+	stopWarnAfter    = 2 * time.Second
+	stopAbandonAfter = 30 * time.Second
+)
+
 // engineCmd represents a command sent to the Lua engine.
 type engineCmd struct {
-	kind cmdType
-	name string
-	code string
+	kind     cmdType
+	name     string
+	code     string
+	params   map[string]interface{}
+	decls    []PatternParam
+	playlist Playlist
+	// index is the playlist position to start at, in order when it is set.
+	index int
+	order []int
+	// keepLastFrame leaves the strip as the pattern left it instead of restoring it (@on_end keep).
+	keepLastFrame bool
+	// timer ends the run early, when set.
+	timer runTimer
+}
+
+// strip is the LED strip scripts drive: the BLE controller, or a recording strip in headless
+// runs.
+type strip interface {
+	SetColor(r, g, b int)
+	SetBrightness(val int)
+	SetPower(isOn bool)
+	GetState() ble.State
 }
 
 // Engine manages the Lua scripting environment using a single worker goroutine
 // to ensure only one pattern runs at a time.
 type Engine struct {
-	bleController *ble.Controller
+	bleController strip
 	patternsDir   string
 	eventBus      *core.EventBus
-
-	cmdChan  chan engineCmd
-	stopChan chan struct{}
+	state         *core.State
+	luaCfg        config.LuaConfig
+	limits        limits
+	transitions   transitions
+	out           *output
+	playlists     *playlistStore
+	history       *patternHistory
+
+	cmdChan chan engineCmd
+	// stopChan carries stop requests; true restores the rest state afterwards.
+	stopChan chan bool
+	skipChan chan int
 	wg       sync.WaitGroup
+	running  atomic.Bool
+	// stuck counts abandoned scripts that have not returned yet (see abandon).
+	stuck    atomic.Int32
+	hooks    atomic.Pointer[hookSet]
+	playlist atomic.Pointer[playlistRun]
+
+	// sim is the virtual clock of a headless run (see RunHeadless), nil in the agent.
+	sim *simulation
 }
 
 // NewEngine creates a new Lua engine and starts its background worker.
-func NewEngine(bleController *ble.Controller, patternsDir string, eb *core.EventBus) *Engine {
+// Patterns run sandboxed unless luaCfg marks them as trusted; st is read by get_state().
+// Playlists are loaded from and saved to playlistsFile; revisions of patterns are kept in
+// historyDir, at most historyLimit per pattern.
+func NewEngine(bleController *ble.Controller, patternsDir, playlistsFile, historyDir string, historyLimit int, eb *core.EventBus, st *core.State, luaCfg config.LuaConfig) *Engine {
 	e := &Engine{
 		bleController: bleController,
 		patternsDir:   patternsDir,
 		eventBus:      eb,
+		state:         st,
+		luaCfg:        luaCfg,
+		limits:        newLimits(luaCfg),
+		transitions:   newTransitions(luaCfg.Transitions),
+		out:           &output{ble: newPreviewStrip(bleController, eb)},
+		playlists:     newPlaylistStore(playlistsFile),
+		history:       newPatternHistory(historyDir, historyLimit),
 		cmdChan:       make(chan engineCmd, 10),
-		stopChan:      make(chan struct{}, 1),
+		stopChan:      make(chan bool, 1),
+		skipChan:      make(chan int, 1),
 	}
 
 	go e.runLoop()
@@ -62,28 +128,59 @@ func NewEngine(bleController *ble.Controller, patternsDir string, eb *core.Event
 
 // runLoop is the main worker loop that processes engine commands sequentially.
 func (e *Engine) runLoop() {
-	var currentCancel context.CancelFunc
+	e.running.Store(true)
+	defer e.running.Store(false)
+
+	var currentCancel context.CancelCauseFunc
 	var scriptDone chan struct{}
 
-	cancelCurrent := func() {
+	// cancelCurrent stops the running job, if any, and waits for it. The cause tells the job
+	// what to do with the strip (see errStopped).
+	cancelCurrent := func(cause error) bool {
 		if currentCancel == nil {
-			return
+			return false
 		}
-		currentCancel()
+		currentCancel(cause)
 		select {
 		case <-scriptDone:
-		case <-time.After(2 * time.Second):
-			log.Println("[Lua] Timeout waiting for script to stop")
+		case <-time.After(stopWarnAfter):
+			// The VM checks for cancellation between instructions, so only a Go function that
+			// ignores the context can hold it up. Keep waiting for a while rather than run two
+			// scripts at once, but do not let it block the engine for good.
+			logger.Warn("Script is slow to stop, still waiting")
+			select {
+			case <-scriptDone:
+			case <-time.After(stopAbandonAfter - stopWarnAfter):
+				e.abandon(scriptDone)
+			}
 		}
 		currentCancel = nil
 		scriptDone = nil
+		return true
+	}
+
+	start := func(job func(ctx context.Context, done chan struct{})) {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		currentCancel = cancel
+		scriptDone = make(chan struct{})
+		go job(ctx, scriptDone)
+	}
+
+	stop := func(restore bool) {
+		if !restore {
+			cancelCurrent(errInterrupted)
+			return
+		}
+		if cancelCurrent(errStopped) {
+			start(e.executeRestore)
+		}
 	}
 
 	for {
 		for {
 			select {
-			case <-e.stopChan:
-				cancelCurrent()
+			case restore := <-e.stopChan:
+				stop(restore)
 				continue
 			default:
 			}
@@ -91,59 +188,154 @@ func (e *Engine) runLoop() {
 		}
 
 		select {
-		case <-e.stopChan:
-			cancelCurrent()
+		case restore := <-e.stopChan:
+			stop(restore)
 			continue
 		case cmd, ok := <-e.cmdChan:
 			if !ok {
-				cancelCurrent()
+				cancelCurrent(errInterrupted)
 				return
 			}
 
-			cancelCurrent()
-
 			if cmd.kind == cmdStop {
+				cancelCurrent(errInterrupted)
 				continue
 			}
+			cancelCurrent(errReplaced)
 
-			ctx, cancel := context.WithCancel(context.Background())
-			currentCancel = cancel
-			scriptDone = make(chan struct{})
-
-			go func(cmd engineCmd, ctx context.Context, done chan struct{}) {
+			start(func(ctx context.Context, done chan struct{}) {
 				switch cmd.kind {
 				case cmdRunFile:
-					e.executeFile(cmd.name, cmd.code, ctx, done)
+					e.executeFile(cmd, ctx, done)
 				case cmdRunString:
 					e.executeString(cmd.name, cmd.code, ctx, done)
+				case cmdRunPlaylist:
+					e.executePlaylist(cmd.name, cmd.playlist, cmd.index, cmd.order, ctx, done)
+				case cmdTimeUp:
+					e.executeTimeUp(cmd, ctx, done)
 				}
-			}(cmd, ctx, scriptDone)
+			})
+		}
+	}
+}
+
+// Alive reports whether the engine's worker goroutine is running.
+func (e *Engine) Alive() bool {
+	return e.running.Load()
+}
+
+// Health reports an error when the worker is not running or a script it gave up on has still
+// not stopped.
+func (e *Engine) Health() error {
+	if !e.Alive() {
+		return errors.New("worker not running")
+	}
+	if n := e.stuck.Load(); n > 0 {
+		return fmt.Errorf("%d abandoned script(s) still running", n)
+	}
+	return nil
+}
+
+// abandon gives up on a script that did not stop within stopAbandonAfter so the worker can
+// go on. It is counted as stuck until it finally returns.
+func (e *Engine) abandon(done chan struct{}) {
+	metrics.LuaPatternsAbandoned.Inc()
+	e.stuck.Add(1)
+	logger.Error("Script did not stop, abandoning it", "waited", stopAbandonAfter)
+	go func() {
+		<-done
+		e.stuck.Add(-1)
+		logger.Info("Abandoned script has stopped")
+	}()
+}
+
+// isTrusted reports whether the named pattern may use the full standard library.
+// One-off command strings are only trusted when every pattern is.
+func (e *Engine) isTrusted(name string, kind cmdType) bool {
+	if e.luaCfg.TrustAllPatterns {
+		return true
+	}
+	if kind != cmdRunFile {
+		return false
+	}
+	for _, trusted := range e.luaCfg.TrustedPatterns {
+		if trusted == name {
+			return true
 		}
 	}
+	return false
 }
 
-// StopCurrentPattern stops the currently running script if any.
+// StopCurrentPattern stops the currently running script if any and fades the strip back to
+// the rest state.
 func (e *Engine) StopCurrentPattern() {
-	select {
-	case e.stopChan <- struct{}{}:
-	default:
-		// Stop already queued; nothing else to do.
+	e.requestStop(true)
+}
+
+// InterruptCurrentPattern stops the currently running script if any and leaves the strip to
+// the caller, which is about to set it.
+func (e *Engine) InterruptCurrentPattern() {
+	e.requestStop(false)
+}
+
+func (e *Engine) requestStop(restore bool) {
+	for {
+		select {
+		case e.stopChan <- restore:
+			return
+		default:
+		}
+		select {
+		case pending := <-e.stopChan:
+			if restore && !pending {
+				// An interrupt is already queued and wins over a stop.
+				restore = false
+			}
+		default:
+		}
 	}
 }
 
-// RunPattern prepares and sends a command to execute a Lua script from a file.
-func (e *Engine) RunPattern(name string) {
+// RunPattern validates params against the parameters declared in the pattern's header and
+// sends a command to execute it, stopping it again when limit says so. Invalid values are
+// reported and the pattern is not started.
+func (e *Engine) RunPattern(name string, params map[string]interface{}, limit RunLimit) error {
 	scriptPath, err := e.GetPatternPath(name)
 	if err != nil {
-		log.Printf("[Lua] Could not get pattern path for '%s': %v", name, err)
-		return
+		logger.Error("Could not get pattern path", "pattern", name, "err", err)
+		return err
+	}
+	if clean, _ := sanitizeFilename(name); isLibraryModule(clean) {
+		err := fmt.Errorf("%s is a library module; load it with require() from a pattern", name)
+		e.reportError(name, "error", err)
+		return err
+	}
+	info, err := e.GetPatternInfo(name)
+	if err != nil {
+		logger.Error("Could not read pattern", "pattern", name, "err", err)
+		return err
+	}
+	resolved, err := resolveParams(info.Params, params)
+	if err != nil {
+		e.reportError(name, "invalid_params", err)
+		return err
+	}
+	timer, err := e.resolveTimer(limit, info, time.Now())
+	if err != nil {
+		e.reportError(name, "invalid_params", err)
+		return err
 	}
 
 	e.cmdChan <- engineCmd{
-		kind: cmdRunFile,
-		name: name,
-		code: scriptPath,
+		kind:          cmdRunFile,
+		name:          name,
+		code:          scriptPath,
+		params:        resolved,
+		decls:         info.Params,
+		keepLastFrame: info.OnEnd == OnEndKeep,
+		timer:         timer,
 	}
+	return nil
 }
 
 // ExecuteString prepares and sends a command to execute a one-off Lua command string.
@@ -156,14 +348,22 @@ func (e *Engine) ExecuteString(code string) {
 }
 
 // sanitizeFilename checks for directory traversal and ensures a valid .lua extension.
+// Names may be prefixed with "lib/" to address shared modules.
 func sanitizeFilename(name string) (string, error) {
 	if !strings.HasSuffix(name, ".lua") {
 		return "", fmt.Errorf("filename must end with .lua")
 	}
+	dir := ""
+	if rest, ok := strings.CutPrefix(name, libDirName+"/"); ok {
+		dir, name = libDirName, rest
+	}
 	cleanName := filepath.Base(name)
 	if cleanName == "" || cleanName == ".lua" || strings.Contains(cleanName, "..") {
 		return "", fmt.Errorf("invalid filename")
 	}
+	if dir != "" {
+		return dir + "/" + cleanName, nil
+	}
 	return cleanName, nil
 }
 
@@ -173,14 +373,20 @@ func (e *Engine) GetPatternPath(name string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	// Ensure the base directory exists
-	if _, err := os.Stat(e.patternsDir); os.IsNotExist(err) {
-		log.Printf("[Lua] Creating patterns directory: %s", e.patternsDir)
-		if err := os.MkdirAll(e.patternsDir, 0755); err != nil {
+	path := filepath.Join(e.patternsDir, filepath.FromSlash(cleanName))
+	// Ensure the directory exists
+	if dir := filepath.Dir(path); !dirExists(dir) {
+		logger.Info("Creating patterns directory", "dir", dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
 			return "", fmt.Errorf("failed to create patterns directory: %w", err)
 		}
 	}
-	return filepath.Join(e.patternsDir, cleanName), nil
+	return path, nil
+}
+
+func dirExists(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
 }
 
 // GetPatternCode reads and returns the source code of a pattern file.
@@ -196,26 +402,37 @@ func (e *Engine) GetPatternCode(name string) (string, error) {
 	return string(content), nil
 }
 
-// SavePatternCode writes the provided Lua source code to a pattern file.
-func (e *Engine) SavePatternCode(name, code string) error {
+// SavePatternCode checks the provided Lua source code (see LintPattern) and writes it to a
+// pattern file, recording a revision by author (who may be unknown). Code with a syntax
+// error is not saved; the error wraps ErrSyntax. The diagnostics are returned either way.
+func (e *Engine) SavePatternCode(name, code, author string) ([]Diagnostic, error) {
 	path, err := e.GetPatternPath(name)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	diags := e.LintPattern(name, code)
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return diags, fmt.Errorf("%w on line %d: %s", ErrSyntax, d.Line, d.Message)
+		}
 	}
-	return os.WriteFile(path, []byte(code), 0644)
+	clean, _ := sanitizeFilename(name)
+	return diags, e.writePattern(clean, path, code, Revision{Action: RevisionSave, Author: author})
 }
 
-// DeletePattern removes a pattern file by name.
-func (e *Engine) DeletePattern(name string) error {
+// DeletePattern removes a pattern file by name. Its code is kept in the history, so it can
+// be undeleted.
+func (e *Engine) DeletePattern(name, author string) error {
 	path, err := e.GetPatternPath(name)
 	if err != nil {
 		return err
 	}
-	return os.Remove(path)
+	clean, _ := sanitizeFilename(name)
+	return e.removePattern(clean, path, author)
 }
 
-// GetPatternList scans the patterns directory and returns a list of available .lua files.
-func (e *Engine) GetPatternList() ([]string, error) {
+// GetPatternNames scans the patterns directory and returns the names of the available .lua files.
+func (e *Engine) GetPatternNames() ([]string, error) {
 	var patterns []string
 	files, err := os.ReadDir(e.patternsDir)
 	if err != nil {
@@ -232,56 +449,221 @@ func (e *Engine) GetPatternList() ([]string, error) {
 	return patterns, nil
 }
 
-// executeFile is an internal wrapper to run a Lua file within the worker's context.
-func (e *Engine) executeFile(name, path string, ctx context.Context, done chan struct{}) {
+// GetPatternList returns every available pattern with the metadata declared in its header.
+func (e *Engine) GetPatternList() ([]PatternInfo, error) {
+	names, err := e.GetPatternNames()
+	if err != nil {
+		return nil, err
+	}
+	patterns := make([]PatternInfo, 0, len(names))
+	for _, name := range names {
+		info, err := e.GetPatternInfo(name)
+		if err != nil {
+			logger.Warn("Could not read pattern", "pattern", name, "err", err)
+			continue
+		}
+		patterns = append(patterns, info)
+	}
+	return patterns, nil
+}
+
+// GetPatternInfo parses the header of a pattern file. Malformed declarations are logged and skipped.
+func (e *Engine) GetPatternInfo(name string) (PatternInfo, error) {
+	code, err := e.GetPatternCode(name)
+	if err != nil {
+		return PatternInfo{}, err
+	}
+	info, errs := parseHeader(code)
+	info.Name = name
+	for _, err := range errs {
+		logger.Warn("Ignoring invalid pattern header line", "pattern", name, "err", err)
+	}
+	return info, nil
+}
+
+// executeFile is an internal wrapper to run a Lua file within the worker's context. A run
+// with a timer is stopped when it expires and followed by the timer's end action.
+func (e *Engine) executeFile(cmd engineCmd, ctx context.Context, done chan struct{}) {
 	defer close(done)
-	e.execute(name, func(L *lua.LState) error {
-		return L.DoFile(path)
-	}, ctx)
+	runCtx := ctx
+	var timer map[string]interface{}
+	if !cmd.timer.endsAt.IsZero() {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithDeadline(ctx, cmd.timer.endsAt)
+		defer cancel()
+		timer = cmd.timer.status()
+	}
+	e.execute(cmd.name, cmd.params, timer, e.isTrusted(cmd.name, cmdRunFile), func(L *lua.LState) error {
+		L.SetGlobal("params", paramsTable(L, cmd.params, cmd.decls))
+		return L.DoFile(cmd.code)
+	}, runCtx)
+	if ctx.Err() == nil && runCtx.Err() == context.DeadlineExceeded {
+		e.timeUp(ctx, cmd.name, cmd.timer)
+		return
+	}
+	e.endPattern(ctx, cmd.keepLastFrame)
 }
 
 // executeString is an internal wrapper to run a Lua code string within the worker's context.
+// The strip keeps what the command set.
 func (e *Engine) executeString(name, code string, ctx context.Context, done chan struct{}) {
 	defer close(done)
-	e.execute(name, func(L *lua.LState) error {
+	e.execute(name, nil, nil, e.isTrusted(name, cmdRunString), func(L *lua.LState) error {
 		return L.DoString(code)
 	}, ctx)
+	e.endPattern(ctx, true)
 }
 
 // execute is a helper to run Lua code using a fresh state and provided executor function.
-func (e *Engine) execute(name string, executor func(*lua.LState) error, ctx context.Context) {
-	log.Printf("[Lua] Starting pattern '%s'...", name)
+// Untrusted code gets a sandboxed state (see newState). params are the resolved parameter values,
+// announced with the PatternChangedEvent, together with timer, the end of a time-limited run,
+// and the position when a playlist runs it.
+// The strip crossfades into the script's first frames; announcing the end is left to the
+// caller (see endPattern). A failure is reported and its reason and error returned.
+func (e *Engine) execute(name string, params, timer map[string]interface{}, trusted bool, executor func(*lua.LState) error, ctx context.Context) (string, error) {
+	logger.Info("Starting pattern", "pattern", name, "sandboxed", !trusted)
+	startedAt := time.Now()
+	metrics.LuaPatternStarts.WithLabelValues(name).Inc()
+	metrics.LuaPatternRunning.Set(1)
+	playlist := e.playlist.Load()
 	if e.eventBus != nil {
+		payload := map[string]interface{}{
+			"running": name,
+			"params":  params,
+		}
+		if timer != nil {
+			payload["timer"] = timer
+		}
+		if playlist != nil {
+			payload["playlist"] = playlist.status()
+		}
 		e.eventBus.Publish(core.Event{
-			Type: core.PatternChangedEvent,
-			Payload: map[string]interface{}{
-				"running": name,
-			},
+			Type:    core.PatternChangedEvent,
+			Payload: payload,
 		})
 	}
 
 	defer func() {
-		log.Printf("[Lua] Pattern '%s' finished.", name)
-		if e.eventBus != nil {
-			e.eventBus.Publish(core.Event{
-				Type: core.PatternChangedEvent,
-				Payload: map[string]interface{}{
-					"running": "",
-				},
-			})
-		}
+		logger.Info("Pattern finished", "pattern", name, "runtime", time.Since(startedAt).Round(time.Millisecond))
+		metrics.LuaPatternRunning.Set(0)
+		metrics.LuaPatternRuntime.Observe(time.Since(startedAt).Seconds())
+	}()
+
+	// scriptCtx is additionally canceled, with the limit as its cause, when a limit is exceeded.
+	scriptCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	fadeCtx, stopFade := context.WithCancel(scriptCtx)
+	fadeDone := e.out.startCrossfade(fadeCtx, e.transitions.start, e.transitions.easing)
+	defer func() {
+		stopFade()
+		<-fadeDone
 	}()
 
-	L := lua.NewState()
+	L := newState(trusted, e.limits.stateOptions(), filepath.Join(e.patternsDir, libDirName))
 	defer L.Close()
-	L.SetContext(ctx)
-	e.registerGoFunctions(L, ctx)
-
-	if err := executor(L); err != nil {
-		if ctx.Err() == context.Canceled {
-			log.Printf("[Lua] Pattern '%s' execution was canceled.", name)
-		} else {
-			log.Printf("[Lua] Error executing pattern '%s': %v", name, err)
+	e.limits.apply(L)
+	L.SetContext(newBudgetContext(scriptCtx, cancel, e.limits, e.now))
+	hooks := newHookSet(L, scriptCtx, e.eventBus)
+	log := logger.With("pattern", name)
+	if e.sim != nil {
+		e.sim.installClock(L)
+		hooks.sim = e.sim
+		log = slog.New(printRecorder{e.sim})
+	}
+	e.hooks.Store(hooks)
+	defer func() {
+		e.hooks.Store(nil)
+		hooks.close()
+	}()
+	e.registerGoFunctions(L, scriptCtx, hooks, log)
+
+	err := executor(L)
+	if err == nil && hooks.active() {
+		// The script registered callbacks: keep it running to handle events until stopped.
+		err = hooks.run()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			logger.Info("Pattern canceled", "pattern", name)
+			return "", nil
+		}
+		reason := terminationReason(scriptCtx, err)
+		if reason != "error" {
+			metrics.LuaPatternTerminations.WithLabelValues(reason).Inc()
+		}
+		e.reportError(name, reason, err)
+		return reason, err
+	}
+	return "", nil
+}
+
+// HandlesEvent reports whether the running script registered an on() hook for the named
+// event, e.g. "power_changed".
+func (e *Engine) HandlesEvent(event string) bool {
+	h := e.hooks.Load()
+	return h != nil && h.handles(event)
+}
+
+// reportError logs a failed script and publishes a PatternErrorEvent describing it.
+func (e *Engine) reportError(name, reason string, err error) {
+	metrics.LuaPatternErrors.WithLabelValues(name).Inc()
+
+	msg, line := e.describeFailure(reason, err)
+	attrs := []any{"pattern", name, "reason", reason, "err", msg}
+	if line > 0 {
+		attrs = append(attrs, "line", line)
+	}
+	logger.Error("Pattern failed", attrs...)
+
+	if e.eventBus != nil {
+		e.eventBus.Publish(core.Event{
+			Type: core.PatternErrorEvent,
+			Payload: map[string]interface{}{
+				"pattern": name,
+				"reason":  reason,
+				"error":   msg,
+				"line":    line,
+			},
+		})
+	}
+}
+
+// describeFailure is describeError with a readable message for scripts stopped by a limit.
+func (e *Engine) describeFailure(reason string, err error) (string, int) {
+	msg, line := describeError(err)
+	switch reason {
+	case "instruction_limit":
+		msg = fmt.Sprintf("terminated: more than %d instructions in one second (does a loop call sleep()?)", e.limits.instructionsPerSecond)
+	case "memory_limit":
+		msg = fmt.Sprintf("terminated: memory use grew by more than %d MB", e.limits.maxMemory>>20)
+	}
+	return msg, line
+}
+
+// errorLinePattern matches the line number in gopher-lua runtime ("chunk:12: ...") and
+// syntax ("chunk line:12(column:3) ...") errors.
+var errorLinePattern = regexp.MustCompile(`(?::(\d+):| line:(\d+)\()`)
+
+// describeError returns the first line of a Lua error (without the traceback) and the
+// script line it refers to, or 0 if unknown.
+func describeError(err error) (string, int) {
+	msg := err.Error()
+	if apiErr, ok := err.(*lua.ApiError); ok && apiErr.Object != nil {
+		msg = apiErr.Object.String()
+	}
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+	msg = strings.TrimSpace(msg)
+
+	line := 0
+	if m := errorLinePattern.FindStringSubmatch(msg); m != nil {
+		digits := m[1]
+		if digits == "" {
+			digits = m[2]
 		}
+		line, _ = strconv.Atoi(digits)
 	}
+	return msg, line
 }
@@ -0,0 +1,31 @@
+package lua
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthReportsAbandonedScript(t *testing.T) {
+	e := &Engine{}
+	if err := e.Health(); err == nil {
+		t.Error("Health is nil without a running worker")
+	}
+	e.running.Store(true)
+	if err := e.Health(); err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+
+	done := make(chan struct{})
+	e.abandon(done)
+	if err := e.Health(); err == nil {
+		t.Fatal("Health is nil while an abandoned script runs")
+	}
+	close(done)
+	deadline := time.Now().Add(time.Second)
+	for e.Health() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Health still failing after the script returned: %v", e.Health())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
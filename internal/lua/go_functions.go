@@ -2,24 +2,23 @@ package lua
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"math"
+	"strings"
 	"time"
 
 	lua "github.com/yuin/gopher-lua"
 )
 
-// registerGoFunctions exposes Go functions to the given Lua state.
-func (e *Engine) registerGoFunctions(L *lua.LState, ctx context.Context) {
+// registerGoFunctions exposes Go functions to the given Lua state. Script output is written to log.
+// sleep() dispatches the events registered in hooks.
+func (e *Engine) registerGoFunctions(L *lua.LState, ctx context.Context, hooks *hookSet, log *slog.Logger) {
+	e.registerBaseFunctions(L, ctx, hooks, log)
+
 	// Basic control functions
 	L.SetGlobal("set_color", L.NewFunction(e.luaSetColor))
 	L.SetGlobal("set_brightness", L.NewFunction(e.luaSetBrightness))
 	L.SetGlobal("set_power", L.NewFunction(e.luaSetPower))
-	L.SetGlobal("print", L.NewFunction(luaPrint))
-
-	// Control flow and utility functions
-	L.SetGlobal("sleep", L.NewFunction(func(L *lua.LState) int { return e.luaSleepCancellable(L, ctx) }))
-	L.SetGlobal("should_stop", L.NewFunction(func(L *lua.LState) int { return e.luaShouldStop(L, ctx) }))
 
 	// Built-in animation effects
 	L.SetGlobal("breathe", L.NewFunction(func(L *lua.LState) int { return e.luaBreathe(L, ctx) }))
@@ -28,28 +27,101 @@ func (e *Engine) registerGoFunctions(L *lua.LState, ctx context.Context) {
 	L.SetGlobal("fade_brightness", L.NewFunction(func(L *lua.LState) int { return e.luaFadeBrightness(L, ctx) }))
 }
 
-// luaPrint is the Go implementation of the Lua print() function, routing output to the standard logger.
-func luaPrint(L *lua.LState) int {
-	log.Printf("[Lua] %s", L.ToString(1))
+// registerBaseFunctions exposes the functions shared by patterns and automations: output, state
+// queries, sleep, event callbacks and the color library. None of them touch the strip.
+func (e *Engine) registerBaseFunctions(L *lua.LState, ctx context.Context, hooks *hookSet, log *slog.Logger) {
+	L.SetGlobal("print", L.NewFunction(func(L *lua.LState) int { return luaPrint(L, log) }))
+
+	// State queries
+	L.SetGlobal("get_state", L.NewFunction(e.luaGetState))
+	L.SetGlobal("get_user_color", L.NewFunction(e.luaGetUserColor))
+
+	// Control flow and utility functions
+	L.SetGlobal("sleep", L.NewFunction(func(L *lua.LState) int { return e.luaSleepCancellable(L, hooks) }))
+	L.SetGlobal("should_stop", L.NewFunction(func(L *lua.LState) int { return e.luaShouldStop(L, ctx) }))
+
+	// Event callbacks
+	L.SetGlobal("on", L.NewFunction(hooks.luaOn))
+
+	// Color math, easing and palettes
+	openColorLib(L)
+}
+
+// luaPrint is the Go implementation of the Lua print() function. Like the standard print, it joins
+// its arguments with tabs; the line goes to the pattern's logger instead of stdout.
+func luaPrint(L *lua.LState, log *slog.Logger) int {
+	parts := make([]string, 0, L.GetTop())
+	for i := 1; i <= L.GetTop(); i++ {
+		parts = append(parts, L.ToStringMeta(L.Get(i)).String())
+	}
+	log.Info(strings.Join(parts, "\t"), "source", "print")
 	return 0
 }
 
 // luaSetColor is the Go implementation for setting a static RGB color from Lua.
+// It takes r, g, b numbers or a single color (see toColor).
 func (e *Engine) luaSetColor(L *lua.LState) int {
+	if c, ok := toColor(L.Get(1)); ok && L.GetTop() == 1 {
+		e.out.SetColor(c.ints())
+		return 0
+	}
 	r, g, b := L.ToInt(1), L.ToInt(2), L.ToInt(3)
-	e.bleController.SetColor(r, g, b)
+	e.out.SetColor(r, g, b)
 	return 0
 }
 
+// optEasing returns the easing function named by argument n, or linear when it is absent.
+func optEasing(L *lua.LState, n int) func(float64) float64 {
+	name := L.OptString(n, "linear")
+	fn, ok := easings[name]
+	if !ok {
+		_, err := ease(name, 0)
+		L.ArgError(n, err.Error())
+	}
+	return fn
+}
+
+// luaGetState returns what the strip currently shows (including changes made by the script,
+// even while they are still being crossfaded in) and the connection status.
+func (e *Engine) luaGetState(L *lua.LState) int {
+	bs := e.out.State()
+	t := L.NewTable()
+	t.RawSetString("power", lua.LBool(bs.IsOn))
+	t.RawSetString("r", lua.LNumber(bs.R))
+	t.RawSetString("g", lua.LNumber(bs.G))
+	t.RawSetString("b", lua.LNumber(bs.B))
+	t.RawSetString("color", newColorTable(L, rgb{float64(bs.R), float64(bs.G), float64(bs.B)}))
+	t.RawSetString("brightness", lua.LNumber(bs.Brightness))
+	t.RawSetString("speed", lua.LNumber(bs.Speed))
+	if e.state != nil {
+		st := e.state.Clone()
+		t.RawSetString("connected", lua.LBool(st.IsConnected))
+		t.RawSetString("rssi", lua.LNumber(st.RSSI))
+	}
+	L.Push(t)
+	return 1
+}
+
+// luaGetUserColor returns the last color chosen outside a script, as a color table.
+func (e *Engine) luaGetUserColor(L *lua.LState) int {
+	if e.state == nil {
+		L.Push(lua.LNil)
+		return 1
+	}
+	st := e.state.Clone()
+	L.Push(newColorTable(L, rgb{float64(st.UserColorR), float64(st.UserColorG), float64(st.UserColorB)}))
+	return 1
+}
+
 // luaSetBrightness is the Go implementation for setting device brightness from Lua.
 func (e *Engine) luaSetBrightness(L *lua.LState) int {
-	e.bleController.SetBrightness(L.ToInt(1))
+	e.out.SetBrightness(L.ToInt(1))
 	return 0
 }
 
 // luaSetPower is the Go implementation for toggling device power from Lua.
 func (e *Engine) luaSetPower(L *lua.LState) int {
-	e.bleController.SetPower(L.ToBool(1))
+	e.out.SetPower(L.ToBool(1))
 	return 0
 }
 
@@ -74,12 +146,28 @@ func cancellableSleep(ctx context.Context, d time.Duration) bool {
 	}
 }
 
+// sleep is cancellableSleep on the engine's clock, which is virtual in headless runs.
+func (e *Engine) sleep(ctx context.Context, d time.Duration) bool {
+	if e.sim != nil {
+		return e.sim.sleep(d)
+	}
+	return cancellableSleep(ctx, d)
+}
+
+// now returns the time on the engine's clock.
+func (e *Engine) now() time.Time {
+	if e.sim != nil {
+		return e.sim.now
+	}
+	return time.Now()
+}
+
 // luaSleepCancellable is the Go implementation for a non-blocking sleep from Lua that respects script cancellation.
-func (e *Engine) luaSleepCancellable(L *lua.LState, ctx context.Context) int {
+// Registered event hooks run while the script sleeps.
+func (e *Engine) luaSleepCancellable(L *lua.LState, hooks *hookSet) int {
 	ms := L.ToInt(1)
-	if cancellableSleep(ctx, time.Duration(ms)*time.Millisecond) {
-		return 0
-	}
+	// On cancellation the script stops at its next instruction, so the result of wait is not needed.
+	hooks.wait(time.Duration(max(ms, 0)) * time.Millisecond)
 	return 0
 }
 
@@ -104,16 +192,16 @@ func (e *Engine) luaBreathe(L *lua.LState, ctx context.Context) int {
 
 	// Fade in
 	for i := 1; i <= steps; i++ {
-		e.bleController.SetBrightness(i)
-		if cancellableSleep(ctx, stepDuration) {
+		e.out.SetBrightness(i)
+		if e.sleep(ctx, stepDuration) {
 			return 0
 		}
 	}
 
 	// Fade out
 	for i := steps; i >= 1; i-- {
-		e.bleController.SetBrightness(i)
-		if cancellableSleep(ctx, stepDuration) {
+		e.out.SetBrightness(i)
+		if e.sleep(ctx, stepDuration) {
 			return 0
 		}
 	}
@@ -130,25 +218,25 @@ func (e *Engine) luaStrobe(L *lua.LState, ctx context.Context) int {
 
 	duration := time.Duration(durationMs) * time.Millisecond
 
-	e.bleController.SetPower(true)
-	e.bleController.SetBrightness(100)
+	e.out.SetPower(true)
+	e.out.SetBrightness(100)
 
 	// Calculate the on/off time for each flash to match the frequency
 	if hz <= 0 {
 		return 0
 	} // Avoid division by zero
 	halfPeriod := time.Duration(1000/hz/2) * time.Millisecond
-	startTime := time.Now()
+	startTime := e.now()
 
-	for time.Since(startTime) < duration {
-		e.bleController.SetColor(r, g, b)
-		if cancellableSleep(ctx, halfPeriod) {
+	for e.now().Sub(startTime) < duration {
+		e.out.SetColor(r, g, b)
+		if e.sleep(ctx, halfPeriod) {
 			return 0
 		}
 
 		// Turn off for a better strobe effect
-		e.bleController.SetColor(0, 0, 0)
-		if cancellableSleep(ctx, halfPeriod) {
+		e.out.SetColor(0, 0, 0)
+		if e.sleep(ctx, halfPeriod) {
 			return 0
 		}
 	}
@@ -156,46 +244,55 @@ func (e *Engine) luaStrobe(L *lua.LState, ctx context.Context) int {
 }
 
 // luaFade smoothly transitions from a starting color to an ending color over a duration.
+// It takes fade(r1, g1, b1, r2, g2, b2, ms [, easing]) or fade(from, to, ms [, easing]).
 func (e *Engine) luaFade(L *lua.LState, ctx context.Context) int {
-	r1 := L.ToInt(1)
-	g1 := L.ToInt(2)
-	b1 := L.ToInt(3)
-	r2 := L.ToInt(4)
-	g2 := L.ToInt(5)
-	b2 := L.ToInt(6)
-	durationMs := L.ToInt(7)
+	var r1, g1, b1, r2, g2, b2, durationMs int
+	var easing func(float64) float64
+	if from, ok := toColor(L.Get(1)); ok && L.Get(1).Type() != lua.LTNumber {
+		r1, g1, b1 = from.ints()
+		r2, g2, b2 = checkColor(L, 2).ints()
+		durationMs = L.ToInt(3)
+		easing = optEasing(L, 4)
+	} else {
+		r1, g1, b1 = L.ToInt(1), L.ToInt(2), L.ToInt(3)
+		r2, g2, b2 = L.ToInt(4), L.ToInt(5), L.ToInt(6)
+		durationMs = L.ToInt(7)
+		easing = optEasing(L, 8)
+	}
 
 	duration := time.Duration(durationMs) * time.Millisecond
 
-	e.bleController.SetPower(true)
+	e.out.SetPower(true)
 
 	steps := 100
 	stepDuration := duration / time.Duration(steps)
 
 	for i := 0; i <= steps; i++ {
-		progress := float64(i) / float64(steps)
+		progress := easing(float64(i) / float64(steps))
 
-		// Linear interpolation for each color channel
+		// Interpolation for each color channel
 		r := int(math.Round(float64(r1) + progress*(float64(r2-r1))))
 		g := int(math.Round(float64(g1) + progress*(float64(g2-g1))))
 		b := int(math.Round(float64(b1) + progress*(float64(b2-b1))))
 
-		e.bleController.SetColor(r, g, b)
+		e.out.SetColor(r, g, b)
 
-		if cancellableSleep(ctx, stepDuration) {
+		if e.sleep(ctx, stepDuration) {
 			return 0
 		}
 	}
 	// Ensure the final color is set exactly
-	e.bleController.SetColor(r2, g2, b2)
+	e.out.SetColor(r2, g2, b2)
 	return 0
 }
 
-// luaFadeBrightness smoothly transitions the brightness from a start value to an end value over a specified duration.
+// luaFadeBrightness smoothly transitions the brightness from a start value to an end value over a specified duration,
+// with an optional easing name as the fourth argument.
 func (e *Engine) luaFadeBrightness(L *lua.LState, ctx context.Context) int {
 	startBrightness := L.ToInt(1)
 	endBrightness := L.ToInt(2)
 	durationMs := L.ToInt(3)
+	easing := optEasing(L, 4)
 
 	// Clamp brightness values to the valid range [1, 100]
 	startBrightness = int(math.Max(1, math.Min(100, float64(startBrightness))))
@@ -205,12 +302,12 @@ func (e *Engine) luaFadeBrightness(L *lua.LState, ctx context.Context) int {
 
 	// Handle edge cases: zero or negative duration, or no change needed
 	if duration <= 0 || startBrightness == endBrightness {
-		e.bleController.SetPower(true)               // Still ensure power is on
-		e.bleController.SetBrightness(endBrightness) // Just set the final brightness
+		e.out.SetPower(true)               // Still ensure power is on
+		e.out.SetBrightness(endBrightness) // Just set the final brightness
 		return 0
 	}
 
-	e.bleController.SetPower(true) // Ensure power is on
+	e.out.SetPower(true) // Ensure power is on
 
 	steps := 100 // Number of steps for smooth transition
 	stepDuration := duration / time.Duration(steps)
@@ -219,18 +316,18 @@ func (e *Engine) luaFadeBrightness(L *lua.LState, ctx context.Context) int {
 	}
 
 	for i := 0; i <= steps; i++ {
-		progress := float64(i) / float64(steps) // Calculate current progress (0.0 to 1.0)
+		progress := easing(float64(i) / float64(steps)) // Calculate current progress (0.0 to 1.0)
 
-		// Linear interpolation for brightness
+		// Interpolation for brightness
 		currentBrightness := int(math.Round(float64(startBrightness) + progress*(float64(endBrightness-startBrightness))))
 
-		e.bleController.SetBrightness(currentBrightness)
+		e.out.SetBrightness(currentBrightness)
 
-		if cancellableSleep(ctx, stepDuration) {
+		if e.sleep(ctx, stepDuration) {
 			return 0 // Exit if cancelled
 		}
 	}
 	// Ensure the final brightness is set exactly
-	e.bleController.SetBrightness(endBrightness)
+	e.out.SetBrightness(endBrightness)
 	return 0
 }
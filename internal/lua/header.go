@@ -0,0 +1,189 @@
+package lua
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PatternInfo describes a pattern file and the metadata declared in its header block.
+// Every field except Name and Params is optional.
+type PatternInfo struct {
+	Name        string         `json:"name"`
+	DisplayName string         `json:"displayName,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Author      string         `json:"author,omitempty"`
+	Loops       *bool          `json:"loops,omitempty"`
+	Palette     []string       `json:"palette,omitempty"`
+	Restart     string         `json:"restart,omitempty"`
+	OnEnd       string         `json:"onEnd,omitempty"`
+	MaxRuntime  string         `json:"maxRuntime,omitempty"`
+	Params      []PatternParam `json:"params"`
+}
+
+// Title returns the display name, or the file name without its extension.
+func (info PatternInfo) Title() string {
+	if info.DisplayName != "" {
+		return info.DisplayName
+	}
+	return strings.TrimSuffix(info.Name, ".lua")
+}
+
+// summaryLine matches the "-- name.lua: What it does." first line used by existing patterns.
+var summaryLine = regexp.MustCompile(`^[\w.-]+\.lua:\s*(.+)$`)
+
+// parseHeader reads the header block of a pattern: the leading run of "--" comment lines
+// (blank lines allowed). Metadata and parameters are declared with one tag per line:
+//
+//	-- @name Police Lights
+//	-- @description Strobes between two colors.
+//	-- @tags party, fast
+//	-- @author Jane Doe
+//	-- @loops true
+//	-- @palette #ff0000 #0000ff
+//	-- @restart on-failure
+//	-- @on_end keep
+//	-- @max_runtime 2h
+//	-- @param speed number default=1 min=0.25 max=4 label="Speed multiplier"
+//
+// Repeated @description lines are joined. Without one, a "name.lua: text" summary line is
+// used. Unknown tags are ignored; malformed values are skipped and returned as errors with
+// their line number.
+func parseHeader(src string) (PatternInfo, []error) {
+	var info PatternInfo
+	var errs []error
+	summary := ""
+	for i, raw := range strings.Split(src, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(line, "--"))
+		tag, rest, _ := strings.Cut(text, " ")
+		rest = strings.TrimSpace(rest)
+		switch tag {
+		case "@name":
+			info.DisplayName = rest
+		case "@description":
+			info.Description = strings.TrimSpace(info.Description + " " + rest)
+		case "@author":
+			info.Author = rest
+		case "@tags":
+			for _, t := range strings.FieldsFunc(rest, isListSeparator) {
+				info.Tags = append(info.Tags, strings.ToLower(t))
+			}
+		case "@loops":
+			loops := true
+			if rest != "" {
+				v, err := strconv.ParseBool(rest)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("line %d: @loops must be true or false", i+1))
+					continue
+				}
+				loops = v
+			}
+			info.Loops = &loops
+		case "@palette":
+			for _, c := range strings.FieldsFunc(rest, isListSeparator) {
+				m := colorPattern.FindStringSubmatch(c)
+				if m == nil {
+					errs = append(errs, fmt.Errorf("line %d: invalid palette color %q", i+1, c))
+					continue
+				}
+				info.Palette = append(info.Palette, "#"+strings.ToLower(m[1]))
+			}
+		case "@restart":
+			switch rest {
+			case RestartAlways, RestartOnFailure, RestartNever:
+				info.Restart = rest
+			default:
+				errs = append(errs, fmt.Errorf("line %d: @restart must be %s, %s or %s", i+1, RestartAlways, RestartOnFailure, RestartNever))
+			}
+		case "@on_end":
+			switch rest {
+			case OnEndRestore, OnEndKeep:
+				info.OnEnd = rest
+			default:
+				errs = append(errs, fmt.Errorf("line %d: @on_end must be %s or %s", i+1, OnEndRestore, OnEndKeep))
+			}
+		case "@max_runtime":
+			if _, err := parseRunDuration(rest); err != nil {
+				errs = append(errs, fmt.Errorf("line %d: @max_runtime: %w", i+1, err))
+				continue
+			}
+			info.MaxRuntime = rest
+		case "@param":
+			p, err := parseParam(rest)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("line %d: %w", i+1, err))
+				continue
+			}
+			if info.param(p.Name) != nil {
+				errs = append(errs, fmt.Errorf("line %d: parameter %q declared twice", i+1, p.Name))
+				continue
+			}
+			info.Params = append(info.Params, p)
+		default:
+			if m := summaryLine.FindStringSubmatch(text); m != nil && summary == "" {
+				summary = m[1]
+			}
+		}
+	}
+	if info.Description == "" {
+		info.Description = summary
+	}
+	if info.Params == nil {
+		info.Params = []PatternParam{}
+	}
+	return info, errs
+}
+
+// param returns the declared parameter with the given name, or nil.
+func (info *PatternInfo) param(name string) *PatternParam {
+	for i := range info.Params {
+		if info.Params[i].Name == name {
+			return &info.Params[i]
+		}
+	}
+	return nil
+}
+
+func isListSeparator(r rune) bool {
+	return r == ',' || r == ' ' || r == '\t'
+}
+
+// splitFields splits a header line on whitespace, keeping double-quoted text (which may
+// follow "key=") together and removing the quotes.
+func splitFields(s string) ([]string, error) {
+	var fields []string
+	var cur strings.Builder
+	inQuotes, inField := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			inField = true
+		case !inQuotes && (r == ' ' || r == '\t'):
+			if inField {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		default:
+			cur.WriteRune(r)
+			inField = true
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
@@ -0,0 +1,385 @@
+package lua
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Actions recorded in a pattern's history.
+const (
+	RevisionSave     = "save"     // saved from the editor
+	RevisionDelete   = "delete"   // deleted; the revision holds the deleted code
+	RevisionRestore  = "restore"  // an earlier revision was restored, or the pattern undeleted
+	RevisionExternal = "external" // changed outside the agent, found when the pattern was next saved
+	RevisionImport   = "import"   // written by importing a bundle
+)
+
+// revisionsFile is the index of a pattern's revisions inside its history directory.
+const revisionsFile = "revisions.json"
+
+// Revision is one recorded version of a pattern. The code is stored by its hash, so
+// revisions with the same content share it.
+type Revision struct {
+	ID     int       `json:"id"`
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Author string    `json:"author,omitempty"`
+	Hash   string    `json:"hash"` // SHA-256 of the code
+	Size   int       `json:"size"`
+	// From is the revision that was restored.
+	From int `json:"from,omitempty"`
+}
+
+// DeletedPattern is a pattern whose last revision is its deletion.
+type DeletedPattern struct {
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deletedAt"`
+	Revision  int       `json:"revision"`
+}
+
+// patternHistory keeps the last limit revisions of every pattern under dir:
+// dir/<pattern>/revisions.json with the code in dir/<pattern>/<hash>.lua. The agent always
+// has a history (see history_dir); engines without a dir, such as headless runs, record none.
+type patternHistory struct {
+	mu    sync.Mutex
+	dir   string
+	limit int
+}
+
+func newPatternHistory(dir string, limit int) *patternHistory {
+	return &patternHistory{dir: dir, limit: limit}
+}
+
+func (h *patternHistory) enabled() bool {
+	return h != nil && h.dir != ""
+}
+
+func (h *patternHistory) patternDir(name string) string {
+	return filepath.Join(h.dir, filepath.FromSlash(name))
+}
+
+// revisions returns a pattern's revisions, oldest first. Caller holds mu.
+func (h *patternHistory) revisions(name string) ([]Revision, error) {
+	data, err := os.ReadFile(filepath.Join(h.patternDir(name), revisionsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var revs []Revision
+	if err := json.Unmarshal(data, &revs); err != nil {
+		return nil, fmt.Errorf("history of %s: %w", name, err)
+	}
+	return revs, nil
+}
+
+// record stores code as a new revision of the pattern. Caller holds mu.
+func (h *patternHistory) record(name, code string, rev Revision) (Revision, error) {
+	revs, err := h.revisions(name)
+	if err != nil {
+		return rev, err
+	}
+	dir := h.patternDir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return rev, err
+	}
+	rev.Hash, rev.Size = hashCode(code), len(code)
+	codeFile := filepath.Join(dir, rev.Hash+".lua")
+	if _, err := os.Stat(codeFile); os.IsNotExist(err) {
+		if err := os.WriteFile(codeFile, []byte(code), 0644); err != nil {
+			return rev, err
+		}
+	}
+	rev.ID = 1
+	if len(revs) > 0 {
+		rev.ID = revs[len(revs)-1].ID + 1
+	}
+	if rev.Time.IsZero() {
+		rev.Time = time.Now()
+	}
+	revs = append(revs, rev)
+	var pruned []Revision
+	if h.limit > 0 && len(revs) > h.limit {
+		pruned, revs = revs[:len(revs)-h.limit], revs[len(revs)-h.limit:]
+	}
+	data, err := json.MarshalIndent(revs, "", "  ")
+	if err != nil {
+		return rev, err
+	}
+	// Write the index in one step so a crash cannot leave it half written.
+	tmp := filepath.Join(dir, revisionsFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return rev, err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, revisionsFile)); err != nil {
+		return rev, err
+	}
+	h.removeUnused(dir, pruned, revs)
+	return rev, nil
+}
+
+// removeUnused deletes the code of pruned revisions that no kept revision shares. Caller
+// holds mu.
+func (h *patternHistory) removeUnused(dir string, pruned, kept []Revision) {
+	used := make(map[string]bool, len(kept))
+	for _, rev := range kept {
+		used[rev.Hash] = true
+	}
+	for _, rev := range pruned {
+		if used[rev.Hash] {
+			continue
+		}
+		used[rev.Hash] = true
+		if err := os.Remove(filepath.Join(dir, rev.Hash+".lua")); err != nil && !os.IsNotExist(err) {
+			logger.Warn("Failed to remove pruned pattern revision", "dir", dir, "revision", rev.ID, "err", err)
+		}
+	}
+}
+
+// revision returns a revision and its code. Caller holds mu.
+func (h *patternHistory) revision(name string, id int) (Revision, string, error) {
+	revs, err := h.revisions(name)
+	if err != nil {
+		return Revision{}, "", err
+	}
+	for _, rev := range revs {
+		if rev.ID == id {
+			code, err := os.ReadFile(filepath.Join(h.patternDir(name), rev.Hash+".lua"))
+			if err != nil {
+				return rev, "", fmt.Errorf("revision %d of %s: %w", id, name, err)
+			}
+			return rev, string(code), nil
+		}
+	}
+	return Revision{}, "", fmt.Errorf("%s has no revision %d", name, id)
+}
+
+// snapshot records the pattern's current file as an external revision if it differs from
+// the last one, so code that was changed outside the agent, or predates the history, is
+// kept before it is overwritten. Caller holds mu.
+func (h *patternHistory) snapshot(name, path string) error {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	revs, err := h.revisions(name)
+	if err != nil {
+		return err
+	}
+	if len(revs) > 0 && revs[len(revs)-1].Hash == hashCode(string(content)) {
+		return nil
+	}
+	rev := Revision{Action: RevisionExternal}
+	if info, err := os.Stat(path); err == nil {
+		rev.Time = info.ModTime()
+	}
+	_, err = h.record(name, string(content), rev)
+	return err
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// writePattern writes a pattern file and records the change. A save that does not change the
+// code records nothing.
+func (e *Engine) writePattern(name, path, code string, rev Revision) error {
+	if !e.history.enabled() {
+		return os.WriteFile(path, []byte(code), 0644)
+	}
+	e.history.mu.Lock()
+	defer e.history.mu.Unlock()
+	if err := e.history.snapshot(name, path); err != nil {
+		logger.Warn("Failed to record pattern history", "pattern", name, "err", err)
+	}
+	if current, err := os.ReadFile(path); err == nil && string(current) == code && rev.Action == RevisionSave {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+		return err
+	}
+	if _, err := e.history.record(name, code, rev); err != nil {
+		logger.Warn("Failed to record pattern history", "pattern", name, "err", err)
+	}
+	return nil
+}
+
+// removePattern deletes a pattern file, recording its code first so it can be undeleted.
+func (e *Engine) removePattern(name, path, author string) error {
+	if !e.history.enabled() {
+		return os.Remove(path)
+	}
+	e.history.mu.Lock()
+	defer e.history.mu.Unlock()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := e.history.snapshot(name, path); err != nil {
+		return fmt.Errorf("recording history: %w", err)
+	}
+	if _, err := e.history.record(name, string(content), Revision{Action: RevisionDelete, Author: author}); err != nil {
+		return fmt.Errorf("recording history: %w", err)
+	}
+	return os.Remove(path)
+}
+
+// PatternHistory returns the revisions of a pattern, newest first.
+func (e *Engine) PatternHistory(name string) ([]Revision, error) {
+	clean, err := sanitizeFilename(name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.history.enabled() {
+		return []Revision{}, nil
+	}
+	e.history.mu.Lock()
+	revs, err := e.history.revisions(clean)
+	e.history.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Revision, len(revs))
+	for i, rev := range revs {
+		out[len(revs)-1-i] = rev
+	}
+	return out, nil
+}
+
+// DiffPatternRevisions returns a unified diff from revision from to revision to of a pattern.
+// Revision 0 is the pattern's current file.
+func (e *Engine) DiffPatternRevisions(name string, from, to int) (string, error) {
+	clean, err := sanitizeFilename(name)
+	if err != nil {
+		return "", err
+	}
+	fromCode, fromLabel, err := e.revisionCode(clean, from)
+	if err != nil {
+		return "", err
+	}
+	toCode, toLabel, err := e.revisionCode(clean, to)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(fromLabel, toLabel, fromCode, toCode), nil
+}
+
+// revisionCode returns the code of a revision, or of the current file for 0, and a label for it.
+func (e *Engine) revisionCode(name string, id int) (string, string, error) {
+	if id == 0 {
+		code, err := e.GetPatternCode(name)
+		if os.IsNotExist(err) {
+			return "", name + " (deleted)", nil
+		}
+		return code, name + " (current)", err
+	}
+	if !e.history.enabled() {
+		return "", "", errors.New("pattern history is disabled")
+	}
+	e.history.mu.Lock()
+	defer e.history.mu.Unlock()
+	_, code, err := e.history.revision(name, id)
+	return code, fmt.Sprintf("%s@%d", name, id), err
+}
+
+// RestorePatternRevision writes an earlier revision back to the pattern file. The restored
+// code is not linted: it is what the pattern was before.
+func (e *Engine) RestorePatternRevision(name string, id int, author string) error {
+	path, err := e.GetPatternPath(name)
+	if err != nil {
+		return err
+	}
+	clean, _ := sanitizeFilename(name)
+	if !e.history.enabled() {
+		return errors.New("pattern history is disabled")
+	}
+	e.history.mu.Lock()
+	rev, code, err := e.history.revision(clean, id)
+	e.history.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	logger.Info("Restoring pattern revision", "pattern", clean, "revision", id, "from", rev.Time)
+	return e.writePattern(clean, path, code, Revision{Action: RevisionRestore, Author: author, From: id})
+}
+
+// UndeletePattern restores a deleted pattern from the revision recorded when it was deleted.
+func (e *Engine) UndeletePattern(name, author string) error {
+	path, err := e.GetPatternPath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s exists", name)
+	}
+	clean, _ := sanitizeFilename(name)
+	if !e.history.enabled() {
+		return errors.New("pattern history is disabled")
+	}
+	e.history.mu.Lock()
+	revs, err := e.history.revisions(clean)
+	e.history.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if len(revs) == 0 || revs[len(revs)-1].Action != RevisionDelete {
+		return fmt.Errorf("%s was not deleted", name)
+	}
+	return e.RestorePatternRevision(clean, revs[len(revs)-1].ID, author)
+}
+
+// DeletedPatterns returns the patterns that were deleted and can be undeleted, most recently
+// deleted first.
+func (e *Engine) DeletedPatterns() ([]DeletedPattern, error) {
+	deleted := []DeletedPattern{}
+	if !e.history.enabled() {
+		return deleted, nil
+	}
+	e.history.mu.Lock()
+	defer e.history.mu.Unlock()
+	err := filepath.WalkDir(e.history.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || d.Name() != revisionsFile {
+			return nil
+		}
+		rel, err := filepath.Rel(e.history.dir, filepath.Dir(path))
+		if err != nil {
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+		revs, err := e.history.revisions(name)
+		if err != nil || len(revs) == 0 {
+			return nil
+		}
+		last := revs[len(revs)-1]
+		if last.Action != RevisionDelete {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(e.patternsDir, filepath.FromSlash(name))); err == nil {
+			return nil
+		}
+		deleted = append(deleted, DeletedPattern{Name: name, DeletedAt: last.Time, Revision: last.ID})
+		return nil
+	})
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].DeletedAt.After(deleted[j].DeletedAt) })
+	return deleted, err
+}
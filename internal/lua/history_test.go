@@ -0,0 +1,51 @@
+package lua
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistoryPrunesOldRevisions(t *testing.T) {
+	dir := t.TempDir()
+	h := newPatternHistory(dir, 3)
+	codes := []string{"a", "b", "a", "c", "d"}
+	for _, code := range codes {
+		if _, err := h.record("glow.lua", code, Revision{Action: RevisionSave}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	revs, err := h.revisions("glow.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 3 || revs[0].ID != 3 || revs[2].ID != 5 {
+		t.Fatalf("revisions %+v, want 3 to 5", revs)
+	}
+	// "a" is still used by revision 3; "b" was only used by a pruned revision.
+	for code, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		_, err := os.Stat(filepath.Join(dir, "glow.lua", hashCode(code)+".lua"))
+		if got := err == nil; got != want {
+			t.Errorf("code %q kept: %v, want %v", code, got, want)
+		}
+	}
+	if _, code, err := h.revision("glow.lua", 3); err != nil || code != "a" {
+		t.Errorf("revision 3 = %q, %v", code, err)
+	}
+	if _, _, err := h.revision("glow.lua", 2); err == nil {
+		t.Error("pruned revision 2 still readable")
+	}
+}
+
+func TestHistoryWithoutLimitKeepsEverything(t *testing.T) {
+	h := newPatternHistory(t.TempDir(), 0)
+	for i := 0; i < 10; i++ {
+		if _, err := h.record("glow.lua", fmt.Sprint(i), Revision{Action: RevisionSave}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if revs, _ := h.revisions("glow.lua"); len(revs) != 10 {
+		t.Errorf("%d revisions, want 10", len(revs))
+	}
+}
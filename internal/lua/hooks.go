@@ -0,0 +1,329 @@
+package lua
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"bledom-controller/internal/core"
+
+	"github.com/robfig/cron/v3"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// minTickInterval bounds how often a tick hook can fire.
+	minTickInterval = 50 * time.Millisecond
+	// firedQueueSize is how many timer firings can wait while a handler runs; more are dropped.
+	firedQueueSize = 16
+)
+
+// busHooks maps hook names to the EventBus events that drive them.
+var busHooks = map[string]core.EventType{
+	"power_changed":      core.PowerChangedEvent,
+	"color_changed":      core.ColorChangedEvent,
+	"brightness_changed": core.StateChangedEvent,
+	"speed_changed":      core.StateChangedEvent,
+	"connection_changed": core.DeviceConnectedEvent,
+	"mqtt":               core.MQTTMessageEvent,
+}
+
+// hook is a callback registered with on().
+type hook struct {
+	event  string
+	filter string // MQTT topic filter
+	fn     *lua.LFunction
+}
+
+// hookSet holds the callbacks a script registered with on() and dispatches events to them.
+// Events are delivered on the script's goroutine, so handlers never run concurrently with
+// the script: while it is in sleep(), and after its main chunk returns until it is stopped.
+type hookSet struct {
+	L        *lua.LState
+	ctx      context.Context
+	eventBus *core.EventBus
+
+	hooks       []*hook
+	sub         core.Subscriber
+	subTypes    []core.EventType
+	mqttFilters []string
+	fired       chan *hook
+	stopTimers  context.CancelFunc
+	dispatching bool
+	// sim runs timers and events on the virtual clock of a headless run.
+	sim *simulation
+
+	// events is read from other goroutines through Engine.HandlesEvent.
+	mu     sync.Mutex
+	events map[string]bool
+}
+
+func newHookSet(L *lua.LState, ctx context.Context, eb *core.EventBus) *hookSet {
+	timerCtx, cancel := context.WithCancel(ctx)
+	return &hookSet{
+		L:          L,
+		ctx:        timerCtx,
+		eventBus:   eb,
+		fired:      make(chan *hook, firedQueueSize),
+		stopTimers: cancel,
+		events:     make(map[string]bool),
+	}
+}
+
+// active reports whether any hooks were registered.
+func (h *hookSet) active() bool {
+	return len(h.hooks) > 0
+}
+
+// handles reports whether a hook is registered for the named event.
+func (h *hookSet) handles(event string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.events[event]
+}
+
+func (h *hookSet) add(hk *hook) {
+	h.hooks = append(h.hooks, hk)
+	h.mu.Lock()
+	h.events[hk.event] = true
+	h.mu.Unlock()
+}
+
+// close stops timers and releases the EventBus subscription and MQTT topics.
+func (h *hookSet) close() {
+	h.stopTimers()
+	if h.sub != nil {
+		h.eventBus.Unsubscribe(h.sub, h.subTypes...)
+	}
+	for _, filter := range h.mqttFilters {
+		h.eventBus.Publish(core.Event{
+			Type:    core.MQTTSubscriptionEvent,
+			Payload: map[string]interface{}{"topic": filter, "subscribe": false},
+		})
+	}
+}
+
+// luaOn is the Go implementation of on(event, [arg,] fn).
+func (h *hookSet) luaOn(L *lua.LState) int {
+	event := L.CheckString(1)
+	switch event {
+	case "tick":
+		ms := L.CheckInt(2)
+		interval := time.Duration(ms) * time.Millisecond
+		if interval < minTickInterval {
+			L.ArgError(2, fmt.Sprintf("tick interval must be at least %d ms", minTickInterval.Milliseconds()))
+		}
+		hk := &hook{event: event, fn: L.CheckFunction(3)}
+		h.add(hk)
+		if h.sim != nil {
+			h.sim.addTicker(hk, interval)
+		} else {
+			go h.runTicker(hk, interval)
+		}
+
+	case "cron":
+		spec := L.CheckString(2)
+		sched, err := cron.ParseStandard(spec)
+		if err != nil {
+			L.ArgError(2, fmt.Sprintf("invalid cron spec %q: %v", spec, err))
+		}
+		hk := &hook{event: event, fn: L.CheckFunction(3)}
+		h.add(hk)
+		if h.sim != nil {
+			h.sim.addCron(hk, sched)
+		} else {
+			go h.runCron(hk, sched)
+		}
+
+	case "mqtt":
+		filter := L.CheckString(2)
+		if filter == "" {
+			L.ArgError(2, "topic expected")
+		}
+		fn := L.CheckFunction(3)
+		if h.sim != nil {
+			h.add(&hook{event: event, filter: filter, fn: fn})
+			break
+		}
+		h.requireBus(L)
+		h.add(&hook{event: event, filter: filter, fn: fn})
+		h.subscribe(busHooks[event])
+		h.mqttFilters = append(h.mqttFilters, filter)
+		h.eventBus.Publish(core.Event{
+			Type:    core.MQTTSubscriptionEvent,
+			Payload: map[string]interface{}{"topic": filter, "subscribe": true},
+		})
+
+	default:
+		eventType, ok := busHooks[event]
+		if !ok {
+			L.ArgError(1, fmt.Sprintf("unknown event %q (one of %s, tick, cron)", event, strings.Join(sortedKeys(busHooks), ", ")))
+		}
+		fn := L.CheckFunction(2)
+		if h.sim != nil {
+			h.add(&hook{event: event, fn: fn})
+			break
+		}
+		h.requireBus(L)
+		h.add(&hook{event: event, fn: fn})
+		h.subscribe(eventType)
+	}
+	return 0
+}
+
+func (h *hookSet) requireBus(L *lua.LState) {
+	if h.eventBus == nil {
+		L.RaiseError("system events are not available in this context")
+	}
+}
+
+// subscribe adds an event type to the script's EventBus subscription. The script keeps one
+// channel, so events queued for the types it already handles are not lost.
+func (h *hookSet) subscribe(t core.EventType) {
+	for _, existing := range h.subTypes {
+		if existing == t {
+			return
+		}
+	}
+	h.subTypes = append(h.subTypes, t)
+	if h.sub == nil {
+		h.sub = h.eventBus.SubscribeAs("lua", t)
+		return
+	}
+	h.eventBus.Extend(h.sub, t)
+}
+
+func (h *hookSet) runTicker(hk *hook, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+			h.fire(hk)
+		}
+	}
+}
+
+func (h *hookSet) runCron(hk *hook, sched cron.Schedule) {
+	for {
+		timer := time.NewTimer(time.Until(sched.Next(time.Now())))
+		select {
+		case <-h.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			h.fire(hk)
+		}
+	}
+}
+
+// fire queues a timer hook, dropping it if the script is too far behind.
+func (h *hookSet) fire(hk *hook) {
+	select {
+	case h.fired <- hk:
+	default:
+	}
+}
+
+// wait blocks for d (or until the script is canceled when d < 0), calling handlers for events
+// that arrive meanwhile. It reports whether the script was canceled. Handlers are called
+// unprotected, so their errors propagate to the script; wait must therefore only be called
+// from a Go function invoked by the script, or through run.
+func (h *hookSet) wait(d time.Duration) bool {
+	if h.sim != nil {
+		return h.sim.wait(h, d)
+	}
+	if h.dispatching {
+		// A handler is sleeping: don't start another handler inside it.
+		return cancellableSleep(h.ctx, d)
+	}
+
+	var timeout <-chan time.Time
+	if d >= 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		select {
+		case <-h.ctx.Done():
+			return true
+		case <-timeout:
+			return false
+		case hk := <-h.fired:
+			h.call(hk.fn)
+		case event := <-h.sub:
+			h.dispatchEvent(event)
+		}
+	}
+}
+
+// run dispatches events after the main chunk returned, until the script is canceled or a
+// handler fails.
+func (h *hookSet) run() error {
+	return h.L.CallByParam(lua.P{
+		Fn: h.L.NewFunction(func(L *lua.LState) int {
+			h.wait(-1)
+			return 0
+		}),
+		Protect: true,
+	})
+}
+
+// dispatchEvent calls every hook registered for an EventBus event.
+func (h *hookSet) dispatchEvent(event core.Event) {
+	payload, _ := event.Payload.(map[string]interface{})
+	// Full state syncs (e.g. after a pattern ends) carry every field, not a change.
+	_, isSync := payload["isOn"]
+	for _, hk := range h.hooks {
+		if busHooks[hk.event] != event.Type {
+			continue
+		}
+		if event.Type == core.StateChangedEvent && isSync {
+			continue
+		}
+		switch hk.event {
+		case "power_changed":
+			if on, ok := payload["isOn"].(bool); ok {
+				h.call(hk.fn, lua.LBool(on))
+			}
+		case "color_changed":
+			r, _ := payload["r"].(int)
+			g, _ := payload["g"].(int)
+			b, _ := payload["b"].(int)
+			h.call(hk.fn, newColorTable(h.L, rgb{float64(r), float64(g), float64(b)}))
+		case "brightness_changed":
+			if v, ok := payload["brightness"].(int); ok {
+				h.call(hk.fn, lua.LNumber(v))
+			}
+		case "speed_changed":
+			if v, ok := payload["speed"].(int); ok {
+				h.call(hk.fn, lua.LNumber(v))
+			}
+		case "connection_changed":
+			connected, _ := payload["connected"].(bool)
+			rssi, _ := payload["rssi"].(int16)
+			h.call(hk.fn, lua.LBool(connected), lua.LNumber(rssi))
+		case "mqtt":
+			if filter, _ := payload["filter"].(string); filter == hk.filter {
+				topic, _ := payload["topic"].(string)
+				body, _ := payload["payload"].(string)
+				h.call(hk.fn, lua.LString(body), lua.LString(topic))
+			}
+		}
+	}
+}
+
+func (h *hookSet) call(fn *lua.LFunction, args ...lua.LValue) {
+	h.dispatching = true
+	defer func() { h.dispatching = false }()
+	h.L.Push(fn)
+	for _, a := range args {
+		h.L.Push(a)
+	}
+	h.L.Call(len(args), 0)
+}
@@ -0,0 +1,38 @@
+package lua
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bledom-controller/internal/core"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Registering a hook for another event must not lose events queued for earlier hooks.
+func TestHooksKeepQueuedEventsWhenSubscribing(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	eb := core.NewEventBus()
+	h := newHookSet(L, ctx, eb)
+	defer h.close()
+	L.SetGlobal("on", L.NewFunction(h.luaOn))
+
+	if err := L.DoString(`calls = {} on("power_changed", function(on) table.insert(calls, "power") end)`); err != nil {
+		t.Fatal(err)
+	}
+	eb.Publish(core.Event{Type: core.PowerChangedEvent, Payload: map[string]interface{}{"isOn": true}})
+	if err := L.DoString(`on("color_changed", function(c) table.insert(calls, "color") end)`); err != nil {
+		t.Fatal(err)
+	}
+	eb.Publish(core.Event{Type: core.ColorChangedEvent, Payload: map[string]interface{}{"r": 1, "g": 2, "b": 3}})
+
+	h.wait(50 * time.Millisecond)
+	calls := L.GetGlobal("calls").(*lua.LTable)
+	if calls.Len() != 2 || calls.RawGetInt(1).String() != "power" || calls.RawGetInt(2).String() != "color" {
+		t.Errorf("handlers called %d times, want power then color", calls.Len())
+	}
+}
@@ -0,0 +1,85 @@
+package lua
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// libDirName is the subdirectory of the patterns directory holding shared modules.
+const libDirName = "lib"
+
+// moduleNamePattern restricts require() to plain names, so modules cannot name arbitrary paths.
+var moduleNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// isLibraryModule reports whether a (sanitized) file name refers to a module in lib/.
+func isLibraryModule(name string) bool {
+	return strings.HasPrefix(name, libDirName+"/")
+}
+
+// installRequire replaces require with a loader that only reads modules from libDir.
+// Each module runs once per script; later calls return the cached result, like the standard require.
+func installRequire(L *lua.LState, libDir string) {
+	loaded := make(map[string]lua.LValue)
+	loading := make(map[string]bool)
+
+	L.SetGlobal("require", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		if !moduleNamePattern.MatchString(name) {
+			L.ArgError(1, fmt.Sprintf("invalid module name %q (modules are files in %s/, required by name without .lua)", name, libDirName))
+		}
+		if v, ok := loaded[name]; ok {
+			L.Push(v)
+			return 1
+		}
+		if loading[name] {
+			L.RaiseError("circular require of module %q", name)
+		}
+
+		path := filepath.Join(libDir, name+".lua")
+		if _, err := os.Stat(path); err != nil {
+			L.RaiseError("module %q not found in %s/", name, libDirName)
+		}
+		fn, err := L.LoadFile(path)
+		if err != nil {
+			L.RaiseError("%s", err.Error())
+		}
+
+		loading[name] = true
+		L.Push(fn)
+		L.Push(lua.LString(name))
+		L.Call(1, 1)
+		delete(loading, name)
+
+		result := L.Get(-1)
+		L.Pop(1)
+		if result == lua.LNil {
+			result = lua.LTrue
+		}
+		loaded[name] = result
+		L.Push(result)
+		return 1
+	}))
+}
+
+// GetLibraryList returns the modules in the lib/ directory as "lib/<name>.lua".
+func (e *Engine) GetLibraryList() ([]string, error) {
+	modules := []string{}
+	files, err := os.ReadDir(filepath.Join(e.patternsDir, libDirName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return modules, nil
+		}
+		return nil, err
+	}
+	for _, file := range files {
+		if !file.IsDir() && filepath.Ext(file.Name()) == ".lua" {
+			modules = append(modules, libDirName+"/"+file.Name())
+		}
+	}
+	return modules, nil
+}
@@ -0,0 +1,225 @@
+package lua
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	"bledom-controller/internal/config"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Errors used as the cancellation cause when a script exceeds a limit.
+var (
+	errInstructionLimit = errors.New("instruction limit exceeded")
+	errMemoryLimit      = errors.New("memory limit exceeded")
+)
+
+const (
+	// instructionCheckInterval is how many VM instructions run between budget checks (a power of two).
+	instructionCheckInterval = 1 << 10
+	// memoryCheckInterval is how many VM instructions run between heap samples (a power of two).
+	memoryCheckInterval = 1 << 16
+	// heapMetric is the live+unswept heap size, readable without stopping the world.
+	heapMetric = "/memory/classes/heap/objects:bytes"
+)
+
+// limits are the resource limits applied to every script, trusted or not.
+type limits struct {
+	instructionsPerSecond int64
+	callStackSize         int
+	registryMaxSize       int
+	maxMemory             uint64
+	// heapGrowth enables the check of process heap growth against maxMemory. string.rep is
+	// bounded by maxMemory either way.
+	heapGrowth bool
+}
+
+func newLimits(cfg config.LuaConfig) limits {
+	return limits{
+		instructionsPerSecond: cfg.MaxInstructionsPerSecond,
+		callStackSize:         cfg.MaxCallStackSize,
+		registryMaxSize:       cfg.MaxRegistrySize,
+		maxMemory:             uint64(cfg.MaxMemoryMB) << 20,
+		heapGrowth:            true,
+	}
+}
+
+// forAutomation returns the limits for an automation. Automations run for days while the
+// rest of the agent allocates, so process heap growth says nothing about the script and is
+// not checked; the instruction, stack and string.rep limits still apply.
+func (l limits) forAutomation() limits {
+	l.heapGrowth = false
+	return l
+}
+
+// stateOptions returns the lua.Options bounding the call stack and data stack (registry).
+func (l limits) stateOptions() lua.Options {
+	opts := lua.Options{
+		CallStackSize:   l.callStackSize,
+		RegistrySize:    lua.RegistrySize,
+		RegistryMaxSize: l.registryMaxSize,
+	}
+	if opts.RegistrySize > opts.RegistryMaxSize {
+		opts.RegistrySize = opts.RegistryMaxSize
+	}
+	return opts
+}
+
+// apply installs Go-side guards for allocations that happen inside a single VM instruction,
+// and makes coroutines run under the script's budget.
+func (l limits) apply(L *lua.LState) {
+	l.limitStringRep(L)
+	limitCoroutines(L)
+}
+
+func (l limits) limitStringRep(L *lua.LState) {
+	str, ok := L.GetGlobal(lua.StringLibName).(*lua.LTable)
+	if !ok {
+		return
+	}
+	str.RawSetString("rep", L.NewFunction(func(L *lua.LState) int {
+		s := L.CheckString(1)
+		n := L.CheckInt(2)
+		if n > 0 && uint64(len(s))*uint64(n) > l.maxMemory {
+			L.RaiseError("%s: string.rep result too large", errMemoryLimit)
+		}
+		if n < 0 {
+			n = 0
+		}
+		L.Push(lua.LString(strings.Repeat(s, n)))
+		return 1
+	}))
+}
+
+// limitCoroutines wraps coroutine.create and coroutine.wrap so new threads share the context
+// of the code creating them. gopher-lua gives each thread a plain child context, which would
+// let a coroutine run without the budgetContext counting its instructions.
+func limitCoroutines(L *lua.LState) {
+	co, ok := L.GetGlobal(lua.CoroutineLibName).(*lua.LTable)
+	if !ok {
+		return
+	}
+	for _, name := range []string{"create", "wrap"} {
+		orig, ok := co.RawGetString(name).(*lua.LFunction)
+		if !ok {
+			continue
+		}
+		wrap := name == "wrap"
+		co.RawSetString(name, L.NewFunction(func(L *lua.LState) int {
+			L.Push(orig)
+			L.Push(L.CheckFunction(1))
+			L.Call(1, 1)
+			ret := L.Get(-1)
+			thread, _ := ret.(*lua.LState)
+			if fn, ok := ret.(*lua.LFunction); ok && wrap && len(fn.Upvalues) > 0 {
+				// The wrapper function keeps its thread as its only upvalue.
+				thread, _ = fn.Upvalues[0].Value().(*lua.LState)
+			}
+			if thread != nil && L.Context() != nil {
+				thread.SetContext(L.Context())
+			}
+			return 1
+		}))
+	}
+}
+
+// budgetContext enforces the instruction and memory limits. gopher-lua calls Done once per
+// VM instruction, which makes it a cheap hook for counting instructions; when a limit is
+// exceeded the context is canceled with the limit error as its cause, which stops the VM.
+//
+// Done is only called from the goroutine running the script, so no synchronization is needed.
+type budgetContext struct {
+	context.Context
+	cancel context.CancelCauseFunc
+	limits limits
+
+	// now is the clock instruction windows are measured on: virtual in headless runs, where
+	// sleep() takes no real time.
+	now         func() time.Time
+	count       int64
+	windowCount int64
+	windowStart time.Time
+
+	heapBaseline uint64
+	heapSample   []metrics.Sample
+}
+
+func newBudgetContext(ctx context.Context, cancel context.CancelCauseFunc, l limits, now func() time.Time) *budgetContext {
+	c := &budgetContext{
+		Context:     ctx,
+		cancel:      cancel,
+		limits:      l,
+		now:         now,
+		windowStart: now(),
+		heapSample:  []metrics.Sample{{Name: heapMetric}},
+	}
+	c.heapBaseline = c.heapBytes()
+	return c
+}
+
+func (c *budgetContext) Done() <-chan struct{} {
+	c.count++
+	if c.count&(instructionCheckInterval-1) == 0 {
+		c.checkInstructions()
+	}
+	if c.limits.heapGrowth && c.count&(memoryCheckInterval-1) == 0 {
+		c.checkMemory()
+	}
+	return c.Context.Done()
+}
+
+func (c *budgetContext) checkInstructions() {
+	now := c.now()
+	if now.Sub(c.windowStart) >= time.Second {
+		c.windowStart = now
+		c.windowCount = 0
+	}
+	c.windowCount += instructionCheckInterval
+	if c.windowCount > c.limits.instructionsPerSecond {
+		c.cancel(errInstructionLimit)
+	}
+}
+
+// checkMemory compares heap growth since the script started against the limit. Growth is
+// attributed to the script, which is approximate while automations run alongside it; a GC
+// confirms before terminating. Automations are not checked (see forAutomation).
+func (c *budgetContext) checkMemory() {
+	if c.heapBytes() <= c.heapBaseline+c.limits.maxMemory {
+		return
+	}
+	runtime.GC()
+	if c.heapBytes() > c.heapBaseline+c.limits.maxMemory {
+		c.cancel(errMemoryLimit)
+	}
+}
+
+func (c *budgetContext) heapBytes() uint64 {
+	metrics.Read(c.heapSample)
+	if c.heapSample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return c.heapSample[0].Value.Uint64()
+}
+
+// terminationReason classifies a failed script for the pattern_error event and metrics.
+func terminationReason(ctx context.Context, err error) string {
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errInstructionLimit):
+		return "instruction_limit"
+	case errors.Is(cause, errMemoryLimit):
+		return "memory_limit"
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, errMemoryLimit.Error()):
+		return "memory_limit"
+	case strings.Contains(msg, "stack overflow"), strings.Contains(msg, "registry overflow"):
+		return "stack_limit"
+	}
+	return "error"
+}
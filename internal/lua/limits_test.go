@@ -0,0 +1,111 @@
+package lua
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// runLimited runs code in a state bounded by l and returns the error and termination reason.
+func runLimited(t *testing.T, l limits, code string) (string, error) {
+	t.Helper()
+	// A script that escapes the budget fails the test instead of hanging it.
+	base, stop := context.WithTimeout(context.Background(), 10*time.Second)
+	defer stop()
+	ctx, cancel := context.WithCancelCause(base)
+	defer cancel(nil)
+	L := lua.NewState(l.stateOptions())
+	defer L.Close()
+	l.apply(L)
+	L.SetContext(newBudgetContext(ctx, cancel, l, time.Now))
+	err := L.DoString(code)
+	if err == nil {
+		return "", nil
+	}
+	return terminationReason(ctx, err), err
+}
+
+func testLimits() limits {
+	return limits{instructionsPerSecond: 1 << 20, callStackSize: 256, registryMaxSize: 1 << 18, maxMemory: 1 << 20, heapGrowth: true}
+}
+
+func TestInstructionLimit(t *testing.T) {
+	loops := map[string]string{
+		"main chunk":       `while true do end`,
+		"coroutine.wrap":   `coroutine.wrap(function() while true do end end)()`,
+		"coroutine.create": `coroutine.resume(coroutine.create(function() while true do end end))`,
+		"nested coroutine": `coroutine.wrap(function() coroutine.wrap(function() while true do end end)() end)()`,
+	}
+	for name, l := range map[string]limits{"pattern": testLimits(), "automation": testLimits().forAutomation()} {
+		for loop, code := range loops {
+			reason, err := runLimited(t, l, code)
+			if err == nil || reason != "instruction_limit" {
+				t.Errorf("%s, %s: busy loop ended with %q, %v; want instruction_limit", name, loop, reason, err)
+			}
+		}
+	}
+}
+
+func TestStringRepLimit(t *testing.T) {
+	for name, l := range map[string]limits{"pattern": testLimits(), "automation": testLimits().forAutomation()} {
+		reason, err := runLimited(t, l, `local s = string.rep("x", 2 * 1024 * 1024)`)
+		if err == nil || reason != "memory_limit" {
+			t.Errorf("%s: oversized string.rep ended with %q, %v; want memory_limit", name, reason, err)
+		}
+		if _, err := runLimited(t, l, `assert(#string.rep("ab", 1000) == 2000)`); err != nil {
+			t.Errorf("%s: small string.rep failed: %v", name, err)
+		}
+	}
+}
+
+// Automations must not be charged for heap the rest of the process allocates.
+func TestAutomationIgnoresHeapGrowth(t *testing.T) {
+	l := testLimits().forAutomation()
+	l.maxMemory = 1
+	l.instructionsPerSecond = 1 << 30
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	c := newBudgetContext(ctx, cancel, l, time.Now)
+	c.heapBaseline = 0
+	for i := 0; i < 4*memoryCheckInterval; i++ {
+		c.Done()
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, errMemoryLimit) {
+		t.Fatalf("automation budget canceled with %v", cause)
+	}
+
+	l.heapGrowth = true
+	c = newBudgetContext(ctx, cancel, l, time.Now)
+	c.heapBaseline = 0
+	for i := 0; i < memoryCheckInterval; i++ {
+		c.Done()
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, errMemoryLimit) {
+		t.Fatalf("pattern budget not canceled for heap growth, cause %v", cause)
+	}
+}
+
+func TestTerminationReasonForStackOverflow(t *testing.T) {
+	reason, err := runLimited(t, testLimits(), `local function f() return 1 + f() end f()`)
+	if err == nil || !strings.Contains(reason, "stack_limit") {
+		t.Errorf("recursion ended with %q, %v; want stack_limit", reason, err)
+	}
+}
+
+func TestCoroutinesWorkUnderLimits(t *testing.T) {
+	code := `
+local gen = coroutine.wrap(function() for i = 1, 3 do coroutine.yield(i) end end)
+assert(gen() + gen() + gen() == 6)
+local co = coroutine.create(function(a) local b = coroutine.yield(a + 1) return b * 2 end)
+local _, x = coroutine.resume(co, 1)
+local _, y = coroutine.resume(co, 5)
+assert(x == 2 and y == 10 and coroutine.status(co) == "dead")
+`
+	if _, err := runLimited(t, testLimits(), code); err != nil {
+		t.Fatal(err)
+	}
+}
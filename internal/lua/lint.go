@@ -0,0 +1,812 @@
+package lua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Severities of a Diagnostic.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ErrSyntax is returned (wrapped) by SavePatternCode for code that does not compile.
+var ErrSyntax = errors.New("syntax error")
+
+// Diagnostic is a problem found in a script before it runs. Lines and columns start at 1;
+// Column is 0 when only the line is known.
+type Diagnostic struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// pausingFunctions yield to the agent: a loop that calls one of them can be stopped.
+var pausingFunctions = map[string]bool{
+	"sleep": true, "should_stop": true,
+	"breathe": true, "strobe": true, "fade": true, "fade_brightness": true,
+}
+
+// goFunctionArgs are the argument counts the Go functions accept. Most read missing arguments
+// as 0 or false instead of raising an error, so a wrong count silently does the wrong thing.
+var goFunctionArgs = map[string][]int{
+	"set_power":       {1},
+	"set_color":       {1, 3},
+	"set_brightness":  {1},
+	"sleep":           {1},
+	"should_stop":     {0},
+	"get_state":       {0},
+	"get_user_color":  {0},
+	"breathe":         {1},
+	"strobe":          {5},
+	"fade":            {3, 4, 7, 8},
+	"fade_brightness": {3, 4},
+	"on":              {2, 3},
+	"color.rgb":       {3},
+	"color.parse":     {1},
+	"color.hex":       {1},
+	"color.hsv":       {3},
+	"color.to_hsv":    {1},
+	"color.hsl":       {3},
+	"color.to_hsl":    {1},
+	"color.lerp":      {3},
+	"color.lerp_rgb":  {3},
+	"color.blend":     {2, 3},
+	"color.scale":     {2},
+	"color.ease":      {2},
+	"color.gradient":  {2, 3},
+	"color.palette":   {1},
+	"color.palettes":  {0},
+}
+
+// timerHooks are the on() events that take an argument before the callback.
+var timerHooks = map[string]bool{"tick": true, "cron": true, "mqtt": true}
+
+// LintPattern compiles a pattern or library module and checks it for common mistakes. A
+// syntax error is reported as the only diagnostic, with severity SeverityError; everything
+// else is a warning: loops that never pause, unknown globals and fields of the standard
+// tables, and Go functions called with the wrong number of arguments.
+func (e *Engine) LintPattern(name, code string) []Diagnostic {
+	chunk, err := parse.Parse(strings.NewReader(code), name)
+	if err == nil {
+		_, err = lua.Compile(chunk, name)
+	}
+	if err != nil {
+		return []Diagnostic{syntaxDiagnostic(err, code)}
+	}
+
+	l := &linter{env: e.lintEnv(name), diags: []Diagnostic{}, defined: map[string]bool{}, functions: map[string]*ast.FunctionExpr{}}
+	l.collect(chunk)
+	l.block(chunk, newLintScope(nil))
+	sort.SliceStable(l.diags, func(i, j int) bool { return l.diags[i].Line < l.diags[j].Line })
+	return l.diags
+}
+
+func syntaxDiagnostic(err error, code string) Diagnostic {
+	d := Diagnostic{Severity: SeverityError, Message: err.Error()}
+	var perr *parse.Error
+	var cerr *lua.CompileError
+	switch {
+	case errors.As(err, &perr):
+		// The parser's own message is just "syntax error"; the lexer's are more specific.
+		d.Line, d.Column, d.Message = perr.Pos.Line, perr.Pos.Column, perr.Message
+		switch {
+		case perr.Pos.Line == parse.EOF:
+			d.Line, d.Column = strings.Count(code, "\n")+1, 0
+			d.Message = "unexpected end of file"
+		case perr.Message == "syntax error" && perr.Token != "":
+			d.Message = fmt.Sprintf("unexpected '%s'", perr.Token)
+		case perr.Token != "":
+			d.Message = fmt.Sprintf("%s near '%s'", perr.Message, perr.Token)
+		}
+		// The parser reports where the token ends.
+		if d.Column >= len(perr.Token) && perr.Token != "" {
+			d.Column -= len(perr.Token) - 1
+		}
+	case errors.As(err, &cerr):
+		d.Line, d.Message = cerr.Line, cerr.Message
+	}
+	return d
+}
+
+// lintEnv is what a script finds in its global table, taken from a state set up the way the
+// pattern would run.
+type lintEnv struct {
+	globals map[string]bool
+	// fields of the global tables, e.g. fields["math"]["floor"].
+	fields map[string]map[string]bool
+	// blocked are the globals and tables the sandbox replaced by errors.
+	blocked map[string]bool
+	// usable are the globals the script can actually use: globals without blocked. Only
+	// these are offered as suggestions.
+	usable map[string]bool
+}
+
+func (e *Engine) lintEnv(name string) *lintEnv {
+	trusted := e.isTrusted(name, cmdRunFile)
+	L := newState(trusted, e.limits.stateOptions(), filepath.Join(e.patternsDir, libDirName))
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.registerGoFunctions(L, ctx, newHookSet(L, ctx, nil), logger)
+	L.SetGlobal("params", L.NewTable())
+
+	env := &lintEnv{globals: map[string]bool{}, fields: map[string]map[string]bool{}, blocked: map[string]bool{}}
+	L.G.Global.ForEach(func(k, v lua.LValue) {
+		key, ok := k.(lua.LString)
+		if !ok {
+			return
+		}
+		env.globals[string(key)] = true
+		if t, ok := v.(*lua.LTable); ok && string(key) != "_G" {
+			fields := map[string]bool{}
+			t.ForEach(func(fk, _ lua.LValue) {
+				if s, ok := fk.(lua.LString); ok {
+					fields[string(s)] = true
+				}
+			})
+			env.fields[string(key)] = fields
+		}
+	})
+	if !trusted {
+		for _, n := range blockedGlobals {
+			env.blocked[n] = true
+		}
+		for _, n := range blockedLibs {
+			env.blocked[n] = true
+		}
+	}
+	env.usable = make(map[string]bool, len(env.globals))
+	for n := range env.globals {
+		if !env.blocked[n] {
+			env.usable[n] = true
+		}
+	}
+	return env
+}
+
+// lintScope is a block's local variables.
+type lintScope struct {
+	parent *lintScope
+	names  map[string]bool
+}
+
+func newLintScope(parent *lintScope) *lintScope {
+	return &lintScope{parent: parent, names: map[string]bool{}}
+}
+
+func (s *lintScope) isLocal(name string) bool {
+	for ; s != nil; s = s.parent {
+		if s.names[name] {
+			return true
+		}
+	}
+	return false
+}
+
+type linter struct {
+	env   *lintEnv
+	diags []Diagnostic
+	// defined are the globals the script assigns anywhere.
+	defined map[string]bool
+	// functions are the functions the script defines by name, to see whether calling one pauses.
+	functions map[string]*ast.FunctionExpr
+	pausing   map[*ast.FunctionExpr]bool
+	reported  map[string]bool
+}
+
+func (l *linter) warn(line int, format string, args ...interface{}) {
+	l.diags = append(l.diags, Diagnostic{Line: line, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+// warnOnce reports a problem only where it first occurs.
+func (l *linter) warnOnce(key string, line int, format string, args ...interface{}) {
+	if l.reported == nil {
+		l.reported = map[string]bool{}
+	}
+	if l.reported[key] {
+		return
+	}
+	l.reported[key] = true
+	l.warn(line, format, args...)
+}
+
+// collect records the globals the script assigns and the functions it names, so that uses
+// before the definition are not reported.
+func (l *linter) collect(stmts []ast.Stmt) {
+	walkStmts(stmts, func(stmt ast.Stmt) {
+		switch s := stmt.(type) {
+		case *ast.AssignStmt:
+			for i, lhs := range s.Lhs {
+				if id, ok := lhs.(*ast.IdentExpr); ok {
+					l.defined[id.Value] = true
+					if i < len(s.Rhs) {
+						if fn, ok := s.Rhs[i].(*ast.FunctionExpr); ok {
+							l.functions[id.Value] = fn
+						}
+					}
+				}
+			}
+		case *ast.LocalAssignStmt:
+			for i, name := range s.Names {
+				if i < len(s.Exprs) {
+					if fn, ok := s.Exprs[i].(*ast.FunctionExpr); ok {
+						l.functions[name] = fn
+					}
+				}
+			}
+		case *ast.FuncDefStmt:
+			if id, ok := s.Name.Func.(*ast.IdentExpr); ok && s.Name.Receiver == nil {
+				l.defined[id.Value] = true
+				l.functions[id.Value] = s.Func
+			}
+		}
+	})
+}
+
+func (l *linter) block(stmts []ast.Stmt, scope *lintScope) {
+	for _, stmt := range stmts {
+		l.stmt(stmt, scope)
+	}
+}
+
+func (l *linter) stmt(stmt ast.Stmt, scope *lintScope) {
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range s.Lhs {
+			if _, ok := lhs.(*ast.IdentExpr); !ok {
+				l.expr(lhs, scope)
+			}
+		}
+		l.exprs(s.Rhs, scope)
+	case *ast.LocalAssignStmt:
+		if len(s.Names) == 1 && len(s.Exprs) == 1 && isFunction(s.Exprs[0]) {
+			// "local function f" can call itself.
+			scope.names[s.Names[0]] = true
+		}
+		l.exprs(s.Exprs, scope)
+		for _, name := range s.Names {
+			scope.names[name] = true
+		}
+	case *ast.FuncCallStmt:
+		l.expr(s.Expr, scope)
+	case *ast.DoBlockStmt:
+		l.block(s.Stmts, newLintScope(scope))
+	case *ast.WhileStmt:
+		l.expr(s.Condition, scope)
+		if isTruthy(s.Condition) {
+			l.checkLoop(s.Line(), s.Stmts, scope)
+		}
+		l.block(s.Stmts, newLintScope(scope))
+	case *ast.RepeatStmt:
+		inner := newLintScope(scope)
+		l.block(s.Stmts, inner)
+		l.expr(s.Condition, inner)
+		if isFalsy(s.Condition) {
+			l.checkLoop(s.Line(), s.Stmts, scope)
+		}
+	case *ast.IfStmt:
+		l.expr(s.Condition, scope)
+		l.block(s.Then, newLintScope(scope))
+		l.block(s.Else, newLintScope(scope))
+	case *ast.NumberForStmt:
+		l.expr(s.Init, scope)
+		l.expr(s.Limit, scope)
+		if s.Step != nil {
+			l.expr(s.Step, scope)
+		}
+		inner := newLintScope(scope)
+		inner.names[s.Name] = true
+		l.block(s.Stmts, inner)
+	case *ast.GenericForStmt:
+		l.exprs(s.Exprs, scope)
+		inner := newLintScope(scope)
+		for _, name := range s.Names {
+			inner.names[name] = true
+		}
+		l.block(s.Stmts, inner)
+	case *ast.FuncDefStmt:
+		if s.Name.Func != nil {
+			if _, ok := s.Name.Func.(*ast.IdentExpr); !ok {
+				l.expr(s.Name.Func, scope)
+			}
+		}
+		if s.Name.Receiver != nil {
+			l.expr(s.Name.Receiver, scope)
+		}
+		if s.Name.Method != "" {
+			l.function(s.Func, scope, "self")
+		} else {
+			l.function(s.Func, scope)
+		}
+	case *ast.ReturnStmt:
+		l.exprs(s.Exprs, scope)
+	}
+}
+
+// function checks a function body; implicit are locals such as a method's self.
+func (l *linter) function(fn *ast.FunctionExpr, scope *lintScope, implicit ...string) {
+	inner := newLintScope(scope)
+	for _, name := range implicit {
+		inner.names[name] = true
+	}
+	for _, name := range fn.ParList.Names {
+		inner.names[name] = true
+	}
+	l.block(fn.Stmts, inner)
+}
+
+func (l *linter) exprs(exprs []ast.Expr, scope *lintScope) {
+	for _, e := range exprs {
+		l.expr(e, scope)
+	}
+}
+
+func (l *linter) expr(expr ast.Expr, scope *lintScope) {
+	switch x := expr.(type) {
+	case *ast.IdentExpr:
+		l.global(x, scope)
+	case *ast.AttrGetExpr:
+		l.expr(x.Object, scope)
+		l.expr(x.Key, scope)
+		l.field(x, scope)
+	case *ast.TableExpr:
+		for _, f := range x.Fields {
+			if f.Key != nil {
+				l.expr(f.Key, scope)
+			}
+			l.expr(f.Value, scope)
+		}
+	case *ast.FuncCallExpr:
+		if x.Func != nil {
+			l.expr(x.Func, scope)
+		}
+		if x.Receiver != nil {
+			l.expr(x.Receiver, scope)
+		}
+		l.exprs(x.Args, scope)
+		l.arguments(x, scope)
+	case *ast.LogicalOpExpr:
+		l.expr(x.Lhs, scope)
+		l.expr(x.Rhs, scope)
+	case *ast.RelationalOpExpr:
+		l.expr(x.Lhs, scope)
+		l.expr(x.Rhs, scope)
+	case *ast.StringConcatOpExpr:
+		l.expr(x.Lhs, scope)
+		l.expr(x.Rhs, scope)
+	case *ast.ArithmeticOpExpr:
+		l.expr(x.Lhs, scope)
+		l.expr(x.Rhs, scope)
+	case *ast.UnaryMinusOpExpr:
+		l.expr(x.Expr, scope)
+	case *ast.UnaryNotOpExpr:
+		l.expr(x.Expr, scope)
+	case *ast.UnaryLenOpExpr:
+		l.expr(x.Expr, scope)
+	case *ast.FunctionExpr:
+		l.function(x, scope)
+	}
+}
+
+// builtin reports whether name refers to the environment's global rather than to a local or
+// a global the script sets itself.
+func (l *linter) builtin(name string, scope *lintScope) bool {
+	return !scope.isLocal(name) && !l.defined[name] && l.env.globals[name]
+}
+
+func (l *linter) global(id *ast.IdentExpr, scope *lintScope) {
+	name := id.Value
+	if scope.isLocal(name) || l.defined[name] {
+		return
+	}
+	if l.env.blocked[name] {
+		l.warnOnce("blocked:"+name, id.Line(), "%s is not available in sandboxed patterns", name)
+		return
+	}
+	if l.env.globals[name] {
+		return
+	}
+	msg := fmt.Sprintf("unknown global %q", name)
+	if s := closest(name, l.env.usable); s != "" {
+		msg += fmt.Sprintf("; did you mean %q?", s)
+	}
+	l.warnOnce("global:"+name, id.Line(), "%s", msg)
+}
+
+// field checks a constant field of a standard table, e.g. math.floor.
+func (l *linter) field(x *ast.AttrGetExpr, scope *lintScope) {
+	obj, ok := x.Object.(*ast.IdentExpr)
+	if !ok || !l.builtin(obj.Value, scope) {
+		return
+	}
+	key, ok := x.Key.(*ast.StringExpr)
+	if !ok {
+		return
+	}
+	fields, ok := l.env.fields[obj.Value]
+	if !ok || obj.Value == "params" || l.env.blocked[obj.Value] || fields[key.Value] {
+		return
+	}
+	name := obj.Value + "." + key.Value
+	if obj.Value == lua.OsLibName && !l.env.blocked[lua.OsLibName] && len(fields) == len(safeOSFunctions) {
+		l.warnOnce("blocked:"+name, x.Line(), "%s is not available in sandboxed patterns", name)
+		return
+	}
+	msg := fmt.Sprintf("unknown field %s", name)
+	if s := closest(key.Value, fields); s != "" {
+		msg += fmt.Sprintf("; did you mean %s.%s?", obj.Value, s)
+	}
+	l.warnOnce("field:"+name, x.Line(), "%s", msg)
+}
+
+// arguments checks the argument count of a call to a Go function.
+func (l *linter) arguments(call *ast.FuncCallExpr, scope *lintScope) {
+	if call.Receiver != nil {
+		return
+	}
+	name := ""
+	switch fn := call.Func.(type) {
+	case *ast.IdentExpr:
+		if l.builtin(fn.Value, scope) {
+			name = fn.Value
+		}
+	case *ast.AttrGetExpr:
+		obj, ok := fn.Object.(*ast.IdentExpr)
+		key, isString := fn.Key.(*ast.StringExpr)
+		if ok && isString && l.builtin(obj.Value, scope) {
+			name = obj.Value + "." + key.Value
+		}
+	}
+	counts, ok := goFunctionArgs[name]
+	if !ok {
+		return
+	}
+	n := len(call.Args)
+	if name == "on" && n > 0 {
+		if event, ok := call.Args[0].(*ast.StringExpr); ok {
+			counts = []int{2}
+			if timerHooks[event.Value] {
+				counts = []int{3}
+			}
+		}
+	}
+	if n > 0 && isMultiValue(call.Args[n-1]) {
+		// The last argument may expand to any number of values.
+		if n-1 > counts[len(counts)-1] {
+			l.warn(call.Line(), "%s expects %s, got at least %d", name, describeCounts(counts), n-1)
+		}
+		return
+	}
+	for _, c := range counts {
+		if c == n {
+			return
+		}
+	}
+	l.warn(call.Line(), "%s expects %s, got %d", name, describeCounts(counts), n)
+}
+
+// checkLoop warns about a loop that never ends on its own if nothing in it pauses: it would
+// keep the script busy until the instruction limit stops it.
+func (l *linter) checkLoop(line int, body []ast.Stmt, scope *lintScope) {
+	if leavesLoop(body) || l.mayPause(body, scope) {
+		return
+	}
+	l.warn(line, "infinite loop without sleep() or should_stop(); it will hit the instruction limit")
+}
+
+// mayPause reports whether running stmts may call a pausing function. Calls it cannot
+// resolve, such as module functions, are assumed to pause.
+func (l *linter) mayPause(stmts []ast.Stmt, scope *lintScope) bool {
+	found := false
+	walkCalls(stmts, func(call *ast.FuncCallExpr) {
+		if !found && l.callMayPause(call, scope) {
+			found = true
+		}
+	})
+	return found
+}
+
+func (l *linter) callMayPause(call *ast.FuncCallExpr, scope *lintScope) bool {
+	if call.Receiver != nil {
+		return true
+	}
+	switch fn := call.Func.(type) {
+	case *ast.IdentExpr:
+		name := fn.Value
+		if body, ok := l.functions[name]; ok {
+			return l.functionMayPause(body, scope)
+		}
+		if !l.builtin(name, scope) {
+			return true
+		}
+		// pcall and friends call what they are given.
+		return pausingFunctions[name] || name == "pcall" || name == "xpcall" || name == "require"
+	case *ast.AttrGetExpr:
+		obj, ok := fn.Object.(*ast.IdentExpr)
+		return !ok || !l.builtin(obj.Value, scope) || obj.Value == lua.CoroutineLibName
+	}
+	return true
+}
+
+func (l *linter) functionMayPause(fn *ast.FunctionExpr, scope *lintScope) bool {
+	if l.pausing == nil {
+		l.pausing = map[*ast.FunctionExpr]bool{}
+	}
+	if v, ok := l.pausing[fn]; ok {
+		return v
+	}
+	l.pausing[fn] = false // recursion does not pause by itself
+	v := l.mayPause(fn.Stmts, scope)
+	l.pausing[fn] = v
+	return v
+}
+
+// leavesLoop reports whether a loop body contains a break, return or goto of its own.
+func leavesLoop(stmts []ast.Stmt) bool {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.BreakStmt, *ast.ReturnStmt, *ast.GotoStmt:
+			return true
+		case *ast.DoBlockStmt:
+			if leavesLoop(s.Stmts) {
+				return true
+			}
+		case *ast.IfStmt:
+			if leavesLoop(s.Then) || leavesLoop(s.Else) {
+				return true
+			}
+		case *ast.WhileStmt, *ast.RepeatStmt, *ast.NumberForStmt, *ast.GenericForStmt:
+			// A break in a nested loop ends that loop, but a return still leaves this one.
+			if returns(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func returns(stmt ast.Stmt) bool {
+	found := false
+	walkStmts([]ast.Stmt{stmt}, func(s ast.Stmt) {
+		if _, ok := s.(*ast.ReturnStmt); ok {
+			found = true
+		}
+	})
+	return found
+}
+
+// walkStmts calls fn for every statement in stmts and the blocks nested in them, including
+// function bodies.
+func walkStmts(stmts []ast.Stmt, fn func(ast.Stmt)) {
+	for _, stmt := range stmts {
+		fn(stmt)
+		switch s := stmt.(type) {
+		case *ast.DoBlockStmt:
+			walkStmts(s.Stmts, fn)
+		case *ast.WhileStmt:
+			walkStmts(s.Stmts, fn)
+		case *ast.RepeatStmt:
+			walkStmts(s.Stmts, fn)
+		case *ast.IfStmt:
+			walkStmts(s.Then, fn)
+			walkStmts(s.Else, fn)
+		case *ast.NumberForStmt:
+			walkStmts(s.Stmts, fn)
+		case *ast.GenericForStmt:
+			walkStmts(s.Stmts, fn)
+		case *ast.FuncDefStmt:
+			walkStmts(s.Func.Stmts, fn)
+		}
+		for _, e := range stmtExprs(stmt) {
+			walkFunctions(e, func(f *ast.FunctionExpr) { walkStmts(f.Stmts, fn) })
+		}
+	}
+}
+
+// walkCalls calls fn for every function call that running stmts makes directly, that is,
+// outside function bodies defined in them.
+func walkCalls(stmts []ast.Stmt, fn func(*ast.FuncCallExpr)) {
+	for _, stmt := range stmts {
+		for _, e := range stmtExprs(stmt) {
+			walkCallExprs(e, fn)
+		}
+		switch s := stmt.(type) {
+		case *ast.DoBlockStmt:
+			walkCalls(s.Stmts, fn)
+		case *ast.WhileStmt:
+			walkCalls(s.Stmts, fn)
+		case *ast.RepeatStmt:
+			walkCalls(s.Stmts, fn)
+		case *ast.IfStmt:
+			walkCalls(s.Then, fn)
+			walkCalls(s.Else, fn)
+		case *ast.NumberForStmt:
+			walkCalls(s.Stmts, fn)
+		case *ast.GenericForStmt:
+			walkCalls(s.Stmts, fn)
+		}
+	}
+}
+
+// stmtExprs returns the expressions a statement evaluates itself.
+func stmtExprs(stmt ast.Stmt) []ast.Expr {
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+		return append(append([]ast.Expr{}, s.Lhs...), s.Rhs...)
+	case *ast.LocalAssignStmt:
+		return s.Exprs
+	case *ast.FuncCallStmt:
+		return []ast.Expr{s.Expr}
+	case *ast.WhileStmt:
+		return []ast.Expr{s.Condition}
+	case *ast.RepeatStmt:
+		return []ast.Expr{s.Condition}
+	case *ast.IfStmt:
+		return []ast.Expr{s.Condition}
+	case *ast.NumberForStmt:
+		exprs := []ast.Expr{s.Init, s.Limit}
+		if s.Step != nil {
+			exprs = append(exprs, s.Step)
+		}
+		return exprs
+	case *ast.GenericForStmt:
+		return s.Exprs
+	case *ast.ReturnStmt:
+		return s.Exprs
+	}
+	return nil
+}
+
+// subExprs returns the direct subexpressions of an expression, not looking into functions.
+func subExprs(expr ast.Expr) []ast.Expr {
+	switch x := expr.(type) {
+	case *ast.AttrGetExpr:
+		return []ast.Expr{x.Object, x.Key}
+	case *ast.TableExpr:
+		var out []ast.Expr
+		for _, f := range x.Fields {
+			if f.Key != nil {
+				out = append(out, f.Key)
+			}
+			out = append(out, f.Value)
+		}
+		return out
+	case *ast.FuncCallExpr:
+		out := append([]ast.Expr{}, x.Args...)
+		if x.Func != nil {
+			out = append(out, x.Func)
+		}
+		if x.Receiver != nil {
+			out = append(out, x.Receiver)
+		}
+		return out
+	case *ast.LogicalOpExpr:
+		return []ast.Expr{x.Lhs, x.Rhs}
+	case *ast.RelationalOpExpr:
+		return []ast.Expr{x.Lhs, x.Rhs}
+	case *ast.StringConcatOpExpr:
+		return []ast.Expr{x.Lhs, x.Rhs}
+	case *ast.ArithmeticOpExpr:
+		return []ast.Expr{x.Lhs, x.Rhs}
+	case *ast.UnaryMinusOpExpr:
+		return []ast.Expr{x.Expr}
+	case *ast.UnaryNotOpExpr:
+		return []ast.Expr{x.Expr}
+	case *ast.UnaryLenOpExpr:
+		return []ast.Expr{x.Expr}
+	}
+	return nil
+}
+
+func walkCallExprs(expr ast.Expr, fn func(*ast.FuncCallExpr)) {
+	if call, ok := expr.(*ast.FuncCallExpr); ok {
+		fn(call)
+	}
+	for _, sub := range subExprs(expr) {
+		walkCallExprs(sub, fn)
+	}
+}
+
+func walkFunctions(expr ast.Expr, fn func(*ast.FunctionExpr)) {
+	if f, ok := expr.(*ast.FunctionExpr); ok {
+		fn(f)
+		return
+	}
+	for _, sub := range subExprs(expr) {
+		walkFunctions(sub, fn)
+	}
+}
+
+func isFunction(expr ast.Expr) bool {
+	_, ok := expr.(*ast.FunctionExpr)
+	return ok
+}
+
+// isTruthy reports whether a loop condition is a constant that is always true.
+func isTruthy(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.TrueExpr, *ast.NumberExpr, *ast.StringExpr, *ast.TableExpr:
+		return true
+	}
+	return false
+}
+
+// isFalsy reports whether a loop condition is a constant that is always false.
+func isFalsy(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.FalseExpr, *ast.NilExpr:
+		return true
+	}
+	return false
+}
+
+// isMultiValue reports whether an expression in the last argument position may expand to
+// several values.
+func isMultiValue(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.FuncCallExpr, *ast.Comma3Expr:
+		return true
+	}
+	return false
+}
+
+// describeCounts formats accepted argument counts: "1 argument", "3 or 4 arguments".
+func describeCounts(counts []int) string {
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		parts[i] = fmt.Sprint(c)
+	}
+	s := parts[len(parts)-1]
+	if len(parts) > 1 {
+		s = strings.Join(parts[:len(parts)-1], ", ") + " or " + s
+	}
+	if len(counts) == 1 && counts[0] == 1 {
+		return s + " argument"
+	}
+	return s + " arguments"
+}
+
+// closest returns the candidate nearest to name if it is a likely typo of it.
+func closest(name string, candidates map[string]bool) string {
+	best, bestDist := "", 3
+	for c := range candidates {
+		if d := editDistance(name, c); d < bestDist || d == bestDist && d < 3 && c < best {
+			best, bestDist = c, d
+		}
+	}
+	if bestDist > 2 || bestDist >= len(name) {
+		return ""
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,39 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+)
+
+func lintMessages(t *testing.T, e *Engine, code string) string {
+	t.Helper()
+	var msgs []string
+	for _, d := range e.LintPattern("test.lua", code) {
+		msgs = append(msgs, d.Message)
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func TestLintSandboxedGlobals(t *testing.T) {
+	cfg := defaultLuaConfig(t)
+	e := &Engine{patternsDir: t.TempDir(), luaCfg: cfg, limits: newLimits(cfg)}
+
+	for _, name := range []string{"module", "setfenv", "getfenv", "dofile"} {
+		if got := lintMessages(t, e, name+`("os")`); !strings.Contains(got, name+" is not available in sandboxed patterns") {
+			t.Errorf("%s: lint messages %q, want a sandbox warning", name, got)
+		}
+	}
+	// io is blocked, so it must not be suggested for a misspelled global.
+	got := lintMessages(t, e, `local f = ioo`)
+	if !strings.Contains(got, `unknown global "ioo"`) || strings.Contains(got, `did you mean "io"`) {
+		t.Errorf("lint messages %q, want no suggestion of io", got)
+	}
+	if got := lintMessages(t, e, `local x = mth.floor(1)`); !strings.Contains(got, `did you mean "math"?`) {
+		t.Errorf("lint messages %q, want math suggested", got)
+	}
+
+	e.luaCfg.TrustAllPatterns = true
+	if got := lintMessages(t, e, `local f = ioo`); !strings.Contains(got, `did you mean "io"?`) {
+		t.Errorf("trusted: lint messages %q, want io suggested", got)
+	}
+}
@@ -0,0 +1,266 @@
+package lua
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Parameter types that can be declared in a pattern header.
+const (
+	ParamNumber  = "number"
+	ParamInteger = "integer"
+	ParamBoolean = "boolean"
+	ParamString  = "string"
+	ParamColor   = "color"
+	ParamChoice  = "choice"
+)
+
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var colorPattern = regexp.MustCompile(`^#?([0-9A-Fa-f]{6})$`)
+
+// PatternParam is a typed parameter declared by a pattern. Default always holds a valid value.
+type PatternParam struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Label   string      `json:"label,omitempty"`
+	Default interface{} `json:"default"`
+	Min     *float64    `json:"min,omitempty"`
+	Max     *float64    `json:"max,omitempty"`
+	Choices []string    `json:"choices,omitempty"`
+}
+
+// parseParam parses the part of an "@param" line after the tag:
+// "<name> <type> [default=..] [min=..] [max=..] [choices=a,b,c] [label=".."]".
+func parseParam(s string) (PatternParam, error) {
+	fields, err := splitFields(s)
+	if err != nil {
+		return PatternParam{}, err
+	}
+	if len(fields) < 2 {
+		return PatternParam{}, fmt.Errorf("@param needs a name and a type")
+	}
+	p := PatternParam{Name: fields[0], Type: fields[1]}
+	if !paramNamePattern.MatchString(p.Name) {
+		return p, fmt.Errorf("invalid parameter name %q", p.Name)
+	}
+	switch p.Type {
+	case ParamNumber, ParamInteger, ParamBoolean, ParamString, ParamColor, ParamChoice:
+	default:
+		return p, fmt.Errorf("parameter %q: unknown type %q", p.Name, p.Type)
+	}
+
+	var rawDefault *string
+	for _, f := range fields[2:] {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok {
+			return p, fmt.Errorf("parameter %q: expected key=value, got %q", p.Name, f)
+		}
+		switch key {
+		case "default":
+			rawDefault = &value
+		case "label":
+			p.Label = value
+		case "min", "max":
+			if p.Type != ParamNumber && p.Type != ParamInteger {
+				return p, fmt.Errorf("parameter %q: %s only applies to numbers", p.Name, key)
+			}
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+				return p, fmt.Errorf("parameter %q: invalid %s %q", p.Name, key, value)
+			}
+			if key == "min" {
+				p.Min = &n
+			} else {
+				p.Max = &n
+			}
+		case "choices":
+			if p.Type != ParamChoice {
+				return p, fmt.Errorf("parameter %q: choices only applies to the choice type", p.Name)
+			}
+			for _, c := range strings.Split(value, ",") {
+				if c = strings.TrimSpace(c); c != "" {
+					p.Choices = append(p.Choices, c)
+				}
+			}
+		default:
+			return p, fmt.Errorf("parameter %q: unknown attribute %q", p.Name, key)
+		}
+	}
+
+	if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+		return p, fmt.Errorf("parameter %q: min is greater than max", p.Name)
+	}
+	if p.Type == ParamChoice && len(p.Choices) == 0 {
+		return p, fmt.Errorf("parameter %q: choice parameters need choices=a,b,...", p.Name)
+	}
+
+	if rawDefault == nil {
+		p.Default = p.zeroValue()
+		return p, nil
+	}
+	if p.Default, err = p.coerce(*rawDefault); err != nil {
+		return p, fmt.Errorf("invalid default: %w", err)
+	}
+	return p, nil
+}
+
+// zeroValue is the default used when the declaration has none.
+func (p PatternParam) zeroValue() interface{} {
+	switch p.Type {
+	case ParamNumber, ParamInteger:
+		if p.Min != nil && *p.Min > 0 {
+			return *p.Min
+		}
+		if p.Max != nil && *p.Max < 0 {
+			return *p.Max
+		}
+		return 0.0
+	case ParamBoolean:
+		return false
+	case ParamColor:
+		return "#ffffff"
+	case ParamChoice:
+		return p.Choices[0]
+	}
+	return ""
+}
+
+// coerce converts a raw value (from JSON, or a string from MQTT and schedules) to the
+// parameter's type and checks it against the declared constraints.
+func (p PatternParam) coerce(raw interface{}) (interface{}, error) {
+	switch p.Type {
+	case ParamNumber, ParamInteger:
+		var n float64
+		switch v := raw.(type) {
+		case float64:
+			n = v
+		case int:
+			n = float64(v)
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %q: %q is not a number", p.Name, v)
+			}
+			n = parsed
+		default:
+			return nil, fmt.Errorf("parameter %q: expected a number", p.Name)
+		}
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, fmt.Errorf("parameter %q: expected a finite number", p.Name)
+		}
+		if p.Type == ParamInteger && n != math.Trunc(n) {
+			return nil, fmt.Errorf("parameter %q: %v is not an integer", p.Name, n)
+		}
+		if p.Min != nil && n < *p.Min {
+			return nil, fmt.Errorf("parameter %q: %v is below the minimum %v", p.Name, n, *p.Min)
+		}
+		if p.Max != nil && n > *p.Max {
+			return nil, fmt.Errorf("parameter %q: %v is above the maximum %v", p.Name, n, *p.Max)
+		}
+		return n, nil
+
+	case ParamBoolean:
+		switch v := raw.(type) {
+		case bool:
+			return v, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "true", "on", "yes", "1":
+				return true, nil
+			case "false", "off", "no", "0":
+				return false, nil
+			}
+			return nil, fmt.Errorf("parameter %q: %q is not a boolean", p.Name, v)
+		}
+		return nil, fmt.Errorf("parameter %q: expected a boolean", p.Name)
+
+	case ParamColor:
+		s, ok := raw.(string)
+		m := colorPattern.FindStringSubmatch(strings.TrimSpace(s))
+		if !ok || m == nil {
+			return nil, fmt.Errorf("parameter %q: expected a color like #ff8800", p.Name)
+		}
+		return "#" + strings.ToLower(m[1]), nil
+
+	case ParamChoice:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("parameter %q: expected one of %s", p.Name, strings.Join(p.Choices, ", "))
+		}
+		for _, c := range p.Choices {
+			if c == s {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("parameter %q: %q is not one of %s", p.Name, s, strings.Join(p.Choices, ", "))
+	}
+
+	s, ok := raw.(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter %q: expected a string", p.Name)
+	}
+	return s, nil
+}
+
+// resolveParams validates values against the declared parameters and fills in defaults.
+// Unknown names are an error, so typos are not silently ignored.
+func resolveParams(declared []PatternParam, values map[string]interface{}) (map[string]interface{}, error) {
+	known := make(map[string]bool, len(declared))
+	for _, p := range declared {
+		known[p.Name] = true
+	}
+	var unknown []string
+	for name := range values {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown parameter %q", unknown[0])
+	}
+
+	resolved := make(map[string]interface{}, len(declared))
+	for _, p := range declared {
+		raw, ok := values[p.Name]
+		if !ok || raw == nil {
+			resolved[p.Name] = p.Default
+			continue
+		}
+		v, err := p.coerce(raw)
+		if err != nil {
+			return nil, err
+		}
+		resolved[p.Name] = v
+	}
+	return resolved, nil
+}
+
+// paramsTable builds the global params table seen by the script. Colors become tables with
+// r, g, b and hex fields that can also be indexed as {r, g, b}.
+func paramsTable(L *lua.LState, values map[string]interface{}, declared []PatternParam) *lua.LTable {
+	t := L.NewTable()
+	for _, p := range declared {
+		switch v := values[p.Name].(type) {
+		case float64:
+			t.RawSetString(p.Name, lua.LNumber(v))
+		case bool:
+			t.RawSetString(p.Name, lua.LBool(v))
+		case string:
+			if p.Type != ParamColor {
+				t.RawSetString(p.Name, lua.LString(v))
+				continue
+			}
+			c, _ := parseHexColor(v)
+			t.RawSetString(p.Name, newColorTable(L, c))
+		}
+	}
+	return t
+}
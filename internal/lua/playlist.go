@@ -0,0 +1,406 @@
+package lua
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// minItemDuration is the shortest item duration that can be configured.
+	minItemDuration = time.Second
+	// minItemTime is how long an item without a duration is shown at least, so a playlist
+	// of patterns that return immediately does not spin.
+	minItemTime = time.Second
+)
+
+// PlaylistItem is one entry of a playlist.
+type PlaylistItem struct {
+	Pattern  string                 `json:"pattern"`
+	Duration string                 `json:"duration,omitempty"` // e.g. "10m"; empty runs until the pattern ends
+	Params   map[string]interface{} `json:"params,omitempty"`
+}
+
+// Playlist is an ordered list of patterns run one after another.
+type Playlist struct {
+	DisplayName string         `json:"displayName,omitempty"`
+	Shuffle     bool           `json:"shuffle"`
+	Loop        bool           `json:"loop"`
+	Items       []PlaylistItem `json:"items"`
+}
+
+// Title returns the display name, or the playlist's key.
+func (p Playlist) Title(name string) string {
+	if p.DisplayName != "" {
+		return p.DisplayName
+	}
+	return name
+}
+
+// playlistStore keeps the playlists in memory and persists them to a JSON file.
+type playlistStore struct {
+	mu        sync.RWMutex
+	file      string
+	playlists map[string]Playlist
+}
+
+func newPlaylistStore(file string) *playlistStore {
+	s := &playlistStore{file: file, playlists: make(map[string]Playlist)}
+	if file == "" {
+		return s
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("Failed to read playlist file", "file", file, "err", err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.playlists); err != nil {
+		logger.Error("Failed to parse playlist file", "file", file, "err", err)
+		return s
+	}
+	logger.Info("Loading playlists", "count", len(s.playlists), "file", file)
+	return s
+}
+
+// save writes the playlists to the file. Caller holds mu.
+func (s *playlistStore) save() error {
+	if s.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.playlists, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.file, data, 0644)
+}
+
+// playlistRun is the position of the running playlist, announced with each item.
+type playlistRun struct {
+	name  string
+	title string
+	index int
+	count int
+	// order is the play order of the items, shuffled or not; index is a position in it.
+	order []int
+}
+
+func (r *playlistRun) status() map[string]interface{} {
+	return map[string]interface{}{
+		"name":        r.name,
+		"displayName": r.title,
+		"index":       r.index,
+		"count":       r.count,
+		"order":       append([]int(nil), r.order...),
+	}
+}
+
+// GetPlaylists returns a copy of all playlists by name.
+func (e *Engine) GetPlaylists() map[string]Playlist {
+	e.playlists.mu.RLock()
+	defer e.playlists.mu.RUnlock()
+	out := make(map[string]Playlist, len(e.playlists.playlists))
+	for name, pl := range e.playlists.playlists {
+		out[name] = pl
+	}
+	return out
+}
+
+// SavePlaylist validates and stores a playlist, replacing any with the same name.
+func (e *Engine) SavePlaylist(name string, pl Playlist) error {
+	if !moduleNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid playlist name %q (use letters, digits, _ and -)", name)
+	}
+	if err := e.validatePlaylist(pl); err != nil {
+		return err
+	}
+	e.playlists.mu.Lock()
+	defer e.playlists.mu.Unlock()
+	e.playlists.playlists[name] = pl
+	return e.playlists.save()
+}
+
+// DeletePlaylist removes a playlist.
+func (e *Engine) DeletePlaylist(name string) error {
+	e.playlists.mu.Lock()
+	defer e.playlists.mu.Unlock()
+	if _, ok := e.playlists.playlists[name]; !ok {
+		return fmt.Errorf("playlist %q not found", name)
+	}
+	delete(e.playlists.playlists, name)
+	return e.playlists.save()
+}
+
+// validatePlaylist checks that every item names a runnable pattern with valid parameters and
+// a valid duration.
+func (e *Engine) validatePlaylist(pl Playlist) error {
+	if len(pl.Items) == 0 {
+		return fmt.Errorf("playlist has no items")
+	}
+	for i, item := range pl.Items {
+		if _, err := parseItemDuration(item.Duration); err != nil {
+			return fmt.Errorf("item %d: %w", i+1, err)
+		}
+		clean, err := sanitizeFilename(item.Pattern)
+		if err != nil {
+			return fmt.Errorf("item %d: %w", i+1, err)
+		}
+		if isLibraryModule(clean) {
+			return fmt.Errorf("item %d: %s is a library module", i+1, item.Pattern)
+		}
+		info, err := e.GetPatternInfo(clean)
+		if err != nil {
+			return fmt.Errorf("item %d: pattern %q not found", i+1, item.Pattern)
+		}
+		if _, err := resolveParams(info.Params, item.Params); err != nil {
+			return fmt.Errorf("item %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func parseItemDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q (e.g. 30s, 10m)", s)
+	}
+	if d < minItemDuration {
+		return 0, fmt.Errorf("duration %q is shorter than %s", s, minItemDuration)
+	}
+	return d, nil
+}
+
+// RunPlaylist starts the named playlist in place of the running pattern.
+func (e *Engine) RunPlaylist(name string) error {
+	return e.RunPlaylistAt(name, 0, nil)
+}
+
+// RunPlaylistAt is like RunPlaylist but starts at the given position of the given play order,
+// e.g. to resume a playlist where it was interrupted (see the "order" of its status). Without
+// an order that fits the playlist, a new one is made; a position past the end starts from the
+// beginning.
+func (e *Engine) RunPlaylistAt(name string, index int, order []int) error {
+	e.playlists.mu.RLock()
+	pl, ok := e.playlists.playlists[name]
+	e.playlists.mu.RUnlock()
+	if !ok {
+		err := fmt.Errorf("playlist %q not found", name)
+		e.reportError(name, "error", err)
+		return err
+	}
+	e.cmdChan <- engineCmd{kind: cmdRunPlaylist, name: name, playlist: pl, index: index, order: order}
+	return nil
+}
+
+// NextPlaylistItem skips to the next item of the running playlist, if any.
+func (e *Engine) NextPlaylistItem() {
+	e.skipPlaylistItem(1)
+}
+
+// PreviousPlaylistItem goes back to the previous item of the running playlist, if any.
+func (e *Engine) PreviousPlaylistItem() {
+	e.skipPlaylistItem(-1)
+}
+
+func (e *Engine) skipPlaylistItem(step int) {
+	if e.playlist.Load() == nil {
+		return
+	}
+	select {
+	case e.skipChan <- step:
+	default:
+		// A skip is already pending.
+	}
+}
+
+// executePlaylist runs the items of a playlist in the worker's context until it ends or ctx
+// is canceled, starting at position start of order (see RunPlaylistAt). Items run through
+// execute like patterns and crossfade into each other; the playlist stays "running" between
+// them, so no idle state is announced until the playlist ends.
+func (e *Engine) executePlaylist(name string, pl Playlist, start int, order []int, ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	// Drop a skip requested before this playlist started.
+	select {
+	case <-e.skipChan:
+	default:
+	}
+
+	logger.Info("Starting playlist", "playlist", name, "items", len(pl.Items), "shuffle", pl.Shuffle, "loop", pl.Loop)
+	run := &playlistRun{name: name, title: pl.Title(name), count: len(pl.Items)}
+	e.playlist.Store(run)
+	defer func() {
+		e.playlist.Store(nil)
+		logger.Info("Playlist finished", "playlist", name)
+		e.endPattern(ctx, false)
+	}()
+
+	if !isPermutation(order, len(pl.Items)) {
+		order = playlistOrder(len(pl.Items), pl.Shuffle)
+	}
+	if start < 0 || start >= len(order) {
+		start = 0
+	}
+	run.order = order
+	failures := 0
+	for pos := start; ctx.Err() == nil; {
+		run.index = pos
+		step, ok := e.playItem(ctx, pl.Items[order[pos]])
+		if ok {
+			failures = 0
+		} else if failures++; failures >= len(order) {
+			logger.Error("Stopping playlist: none of its items can run", "playlist", name)
+			return
+		}
+
+		pos += step
+		switch {
+		case pos < 0:
+			pos = 0
+			if pl.Loop {
+				pos = len(order) - 1
+			}
+		case pos >= len(order):
+			if !pl.Loop {
+				return
+			}
+			pos = 0
+			if pl.Shuffle {
+				order = playlistOrder(len(order), true)
+				run.order = order
+			}
+		}
+	}
+}
+
+// playItem runs one playlist item until its duration expires, the pattern ends, or the user
+// skips. It returns the step to the next item and false if the item could not be started or
+// failed while running.
+func (e *Engine) playItem(ctx context.Context, item PlaylistItem) (int, bool) {
+	duration, err := parseItemDuration(item.Duration)
+	if err != nil {
+		e.reportError(item.Pattern, "error", err)
+		return 1, false
+	}
+	path, err := e.GetPatternPath(item.Pattern)
+	if err != nil {
+		e.reportError(item.Pattern, "error", err)
+		return 1, false
+	}
+	info, err := e.GetPatternInfo(item.Pattern)
+	if err != nil {
+		e.reportError(item.Pattern, "error", err)
+		return 1, false
+	}
+	params, err := resolveParams(info.Params, item.Params)
+	if err != nil {
+		e.reportError(item.Pattern, "invalid_params", err)
+		return 1, false
+	}
+
+	// Without a duration, the pattern's @max_runtime still ends the item.
+	limit := duration
+	if limit == 0 && info.MaxRuntime != "" {
+		limit, _ = parseRunDuration(info.MaxRuntime)
+	}
+
+	itemCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if limit > 0 {
+		timer := time.AfterFunc(limit, cancel)
+		defer timer.Stop()
+	}
+
+	skip := make(chan int, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case step := <-e.skipChan:
+			skip <- step
+			cancel()
+		case <-itemCtx.Done():
+		}
+	}()
+
+	startedAt := time.Now()
+	_, err = e.execute(item.Pattern, params, nil, e.isTrusted(item.Pattern, cmdRunFile), func(L *lua.LState) error {
+		L.SetGlobal("params", paramsTable(L, params, info.Params))
+		return L.DoFile(path)
+	}, itemCtx)
+
+	// A pattern that ends on its own keeps showing its last frame for the rest of the item.
+	// One that failed has been reported; go on to the next item.
+	hold := minItemTime
+	if duration > 0 {
+		hold = duration
+	}
+	if remaining := hold - time.Since(startedAt); err == nil && remaining > 0 {
+		cancellableSleep(itemCtx, remaining)
+	}
+	cancel()
+	wg.Wait()
+
+	select {
+	case step := <-skip:
+		return step, err == nil
+	default:
+		return 1, err == nil
+	}
+}
+
+// playlistOrder returns the item indexes in play order.
+func playlistOrder(n int, shuffle bool) []int {
+	if shuffle {
+		return rand.Perm(n)
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+// isPermutation reports whether order holds each item index below n exactly once.
+func isPermutation(order []int, n int) bool {
+	if len(order) != n {
+		return false
+	}
+	seen := make([]bool, n)
+	for _, i := range order {
+		if i < 0 || i >= n || seen[i] {
+			return false
+		}
+		seen[i] = true
+	}
+	return true
+}
+
+// PlaylistInfo is a playlist as listed for clients.
+type PlaylistInfo struct {
+	Name string `json:"name"`
+	Playlist
+}
+
+// GetPlaylistList returns all playlists sorted by name.
+func (e *Engine) GetPlaylistList() []PlaylistInfo {
+	playlists := e.GetPlaylists()
+	list := make([]PlaylistInfo, 0, len(playlists))
+	for name, pl := range playlists {
+		list = append(list, PlaylistInfo{Name: name, Playlist: pl})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
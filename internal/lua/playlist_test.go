@@ -0,0 +1,127 @@
+package lua
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bledom-controller/internal/core"
+)
+
+// playlistEngine returns an engine that runs the given patterns on a recording strip.
+func playlistEngine(t *testing.T, patterns map[string]string) (*Engine, core.Subscriber) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, code := range patterns {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	luaCfg := defaultLuaConfig(t)
+	sim := &simulation{start: testStart, now: testStart, end: testStart.Add(time.Hour), cancel: func() {}, rand: rand.New(rand.NewSource(1))}
+	sim.strip = &recorder{sim: sim}
+	eb := core.NewEventBus()
+	e := &Engine{
+		bleController: sim.strip,
+		patternsDir:   dir,
+		eventBus:      eb,
+		state:         core.NewState(),
+		luaCfg:        luaCfg,
+		limits:        newLimits(luaCfg),
+		out:           &output{ble: sim.strip},
+		skipChan:      make(chan int, 1),
+		sim:           sim,
+	}
+	sim.state = e.state
+	return e, eb.Subscribe(core.PatternChangedEvent, core.PatternErrorEvent)
+}
+
+// playPlaylist runs pl from position start of order and returns the patterns started and the
+// errors reported.
+func playPlaylist(t *testing.T, e *Engine, sub core.Subscriber, pl Playlist, start int, order []int) (started, failed []string) {
+	t.Helper()
+	done := make(chan struct{})
+	go e.executePlaylist("test", pl, start, order, context.Background(), done)
+	for {
+		select {
+		case ev := <-sub:
+			payload, _ := ev.Payload.(map[string]interface{})
+			switch ev.Type {
+			case core.PatternChangedEvent:
+				if name, _ := payload["running"].(string); name != "" {
+					started = append(started, name)
+				}
+			case core.PatternErrorEvent:
+				name, _ := payload["pattern"].(string)
+				failed = append(failed, name)
+			}
+		case <-done:
+			return started, failed
+		case <-time.After(5 * time.Second):
+			t.Fatalf("playlist still running after 5s; started %v, failed %v", started, failed)
+		}
+	}
+}
+
+// A looping playlist whose patterns all fail at runtime must stop instead of cycling forever.
+func TestPlaylistStopsWhenEveryItemFails(t *testing.T) {
+	e, sub := playlistEngine(t, map[string]string{
+		"a.lua": `error("broken")`,
+		"b.lua": `sleep(10) error("broken too")`,
+	})
+	pl := Playlist{Loop: true, Items: []PlaylistItem{{Pattern: "a.lua"}, {Pattern: "b.lua"}}}
+	if _, failed := playPlaylist(t, e, sub, pl, 0, nil); len(failed) != 2 {
+		t.Errorf("errors reported for %v, want one per item", failed)
+	}
+}
+
+func TestPlaylistStartsAtIndex(t *testing.T) {
+	e, sub := playlistEngine(t, map[string]string{
+		"a.lua": `sleep(10)`,
+		"b.lua": `sleep(10)`,
+		"c.lua": `error("broken")`,
+	})
+	pl := Playlist{Items: []PlaylistItem{{Pattern: "a.lua"}, {Pattern: "b.lua"}, {Pattern: "c.lua"}}}
+	started, _ := playPlaylist(t, e, sub, pl, 2, nil)
+	if len(started) != 1 || started[0] != "c.lua" {
+		t.Errorf("started %v, want only the last item", started)
+	}
+}
+
+// A shuffled playlist resumes in the order it was playing, not in a new one.
+func TestPlaylistResumesShuffledOrder(t *testing.T) {
+	patterns := map[string]string{}
+	var items []PlaylistItem
+	for _, name := range []string{"a.lua", "b.lua", "c.lua", "d.lua"} {
+		patterns[name] = `error("quick")`
+		items = append(items, PlaylistItem{Pattern: name})
+	}
+	e, sub := playlistEngine(t, patterns)
+	pl := Playlist{Shuffle: true, Items: items}
+	started, _ := playPlaylist(t, e, sub, pl, 2, []int{3, 1, 0, 2})
+	if len(started) != 2 || started[0] != "a.lua" || started[1] != "c.lua" {
+		t.Errorf("started %v, want the rest of the stored order: a.lua, c.lua", started)
+	}
+}
+
+func TestIsPermutation(t *testing.T) {
+	for _, tc := range []struct {
+		order []int
+		n     int
+		want  bool
+	}{
+		{[]int{2, 0, 1}, 3, true},
+		{nil, 0, true},
+		{nil, 3, false},
+		{[]int{0, 1}, 3, false},
+		{[]int{0, 0, 1}, 3, false},
+		{[]int{0, 1, 3}, 3, false},
+	} {
+		if got := isPermutation(tc.order, tc.n); got != tc.want {
+			t.Errorf("isPermutation(%v, %d) = %v", tc.order, tc.n, got)
+		}
+	}
+}
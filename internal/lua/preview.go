@@ -0,0 +1,87 @@
+package lua
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"bledom-controller/internal/ble"
+	"bledom-controller/internal/core"
+)
+
+// previewInterval is the shortest time between two preview frames; writes in between are
+// merged into the next frame.
+const previewInterval = 100 * time.Millisecond
+
+// previewStrip passes script writes on to the strip and publishes what the strip shows as
+// PreviewFrameEvents, at most one per previewInterval. The last write is always published,
+// so a preview never stays on an intermediate frame.
+type previewStrip struct {
+	strip
+	eventBus *core.EventBus
+
+	mu      sync.Mutex
+	last    time.Time
+	pending bool
+}
+
+func newPreviewStrip(s strip, eb *core.EventBus) *previewStrip {
+	return &previewStrip{strip: s, eventBus: eb}
+}
+
+func (p *previewStrip) SetColor(r, g, b int) {
+	p.strip.SetColor(r, g, b)
+	p.frameChanged()
+}
+
+func (p *previewStrip) SetBrightness(val int) {
+	p.strip.SetBrightness(val)
+	p.frameChanged()
+}
+
+func (p *previewStrip) SetPower(isOn bool) {
+	p.strip.SetPower(isOn)
+	p.frameChanged()
+}
+
+// frameChanged publishes the frame now, or schedules it if one went out too recently.
+func (p *previewStrip) frameChanged() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending {
+		return
+	}
+	wait := previewInterval - time.Since(p.last)
+	if wait <= 0 {
+		p.publishLocked()
+		return
+	}
+	p.pending = true
+	time.AfterFunc(wait, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.pending = false
+		p.publishLocked()
+	})
+}
+
+// publishLocked publishes the strip's current state. p.mu must be held.
+func (p *previewStrip) publishLocked() {
+	p.last = time.Now()
+	if p.eventBus == nil {
+		return
+	}
+	p.eventBus.Publish(core.Event{Type: core.PreviewFrameEvent, Payload: frameStatus(p.strip.GetState())})
+}
+
+// frameStatus describes a strip state for a preview_frame message.
+func frameStatus(bs ble.State) map[string]interface{} {
+	return map[string]interface{}{
+		"isOn":       bs.IsOn,
+		"r":          bs.R,
+		"g":          bs.G,
+		"b":          bs.B,
+		"hex":        fmt.Sprintf("#%02X%02X%02X", bs.R, bs.G, bs.B),
+		"brightness": bs.Brightness,
+	}
+}
@@ -0,0 +1,45 @@
+package lua
+
+import (
+	"testing"
+	"time"
+
+	"bledom-controller/internal/ble"
+	"bledom-controller/internal/core"
+)
+
+// memStrip is a strip that only remembers its state.
+type memStrip struct{ state ble.State }
+
+func (m *memStrip) SetColor(r, g, b int)  { m.state.R, m.state.G, m.state.B = r, g, b }
+func (m *memStrip) SetBrightness(val int) { m.state.Brightness = val }
+func (m *memStrip) SetPower(isOn bool)    { m.state.IsOn = isOn }
+func (m *memStrip) GetState() ble.State   { return m.state }
+
+func TestPreviewStripThrottlesAndSendsLastFrame(t *testing.T) {
+	eb := core.NewEventBus()
+	sub := eb.Subscribe(core.PreviewFrameEvent)
+	p := newPreviewStrip(&memStrip{}, eb)
+
+	for i := 0; i <= 10; i++ {
+		p.SetColor(i, 0, 0)
+	}
+	var frames []map[string]interface{}
+	deadline := time.After(3 * previewInterval)
+	for len(frames) < 2 {
+		select {
+		case ev := <-sub:
+			frames = append(frames, ev.Payload.(map[string]interface{}))
+		case <-deadline:
+			t.Fatalf("got %d frames, want 2", len(frames))
+		}
+	}
+	if frames[0]["r"] != 0 || frames[1]["r"] != 10 || frames[1]["hex"] != "#0A0000" {
+		t.Errorf("frames %v, want the first write and then the last", frames)
+	}
+	select {
+	case ev := <-sub:
+		t.Errorf("extra frame %v", ev.Payload)
+	case <-time.After(2 * previewInterval):
+	}
+}
@@ -0,0 +1,110 @@
+package lua
+
+import (
+	"fmt"
+	"path/filepath"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// safeLibs are the standard libraries opened for sandboxed patterns.
+var safeLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+	{lua.CoroutineLibName, lua.OpenCoroutine},
+}
+
+// safeOSFunctions are the os functions available to sandboxed patterns; they only read the clock.
+var safeOSFunctions = []string{"time", "date", "clock", "difftime"}
+
+// blockedGlobals are functions that can read or execute arbitrary files, or reach libraries
+// and environments outside the sandbox: module() returns any loaded library, the full os
+// included, and getfenv/setfenv swap a function's globals. require is replaced by a loader
+// restricted to the lib/ directory (see installRequire).
+var blockedGlobals = []string{"dofile", "loadfile", "module", "getfenv", "setfenv"}
+
+// blockedLibs are whole libraries that are unavailable in the sandbox.
+var blockedLibs = []string{lua.IoLibName, lua.DebugLibName, lua.LoadLibName, lua.ChannelLibName}
+
+// newState creates a Lua state for a pattern with the given stack limits. Trusted patterns get
+// every standard library; all others get a sandbox without file, process or debug access.
+// Both can require modules from libDir.
+func newState(trusted bool, opts lua.Options, libDir string) *lua.LState {
+	if trusted {
+		L := lua.NewState(opts)
+		if pkg, ok := L.GetGlobal(lua.LoadLibName).(*lua.LTable); ok {
+			path := filepath.Join(libDir, "?.lua") + ";" + lua.LVAsString(pkg.RawGetString("path"))
+			pkg.RawSetString("path", lua.LString(path))
+		}
+		return L
+	}
+
+	opts.SkipOpenLibs = true
+	L := lua.NewState(opts)
+	for _, lib := range safeLibs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	for _, name := range blockedGlobals {
+		L.SetGlobal(name, blockedFunction(L, name))
+	}
+	installRequire(L, libDir)
+	for _, name := range blockedLibs {
+		L.SetGlobal(name, blockedTable(L, name, L.NewTable()))
+	}
+
+	// os keeps only the clock functions; everything else raises an error when accessed.
+	full := L.NewTable()
+	L.Push(L.NewFunction(lua.OpenOs))
+	L.Push(lua.LString(lua.OsLibName))
+	L.Call(1, 1)
+	if t, ok := L.Get(-1).(*lua.LTable); ok {
+		full = t
+	}
+	L.Pop(1)
+	os := L.NewTable()
+	for _, name := range safeOSFunctions {
+		os.RawSetString(name, full.RawGetString(name))
+	}
+	L.SetGlobal(lua.OsLibName, blockedTable(L, lua.OsLibName, os))
+	// OpenOs registered the full table as a loaded module; leave only the subset there too.
+	if loaded, ok := L.GetField(L.Get(lua.RegistryIndex), "_LOADED").(*lua.LTable); ok {
+		loaded.RawSetString(lua.OsLibName, os)
+	}
+
+	return L
+}
+
+// blockedError builds the message raised when a sandboxed pattern uses a blocked function.
+func blockedError(name string) string {
+	return fmt.Sprintf("%s is not available in sandboxed patterns (add the pattern to lua.trusted_patterns in config.json to allow it)", name)
+}
+
+// blockedFunction returns a function that raises a sandbox error when called.
+func blockedFunction(L *lua.LState, name string) *lua.LFunction {
+	return L.NewFunction(func(L *lua.LState) int {
+		L.RaiseError("%s", blockedError(name))
+		return 0
+	})
+}
+
+// blockedTable sets a metatable on t so reading any missing field raises a sandbox error
+// naming the field, e.g. "os.execute is not available ...".
+func blockedTable(L *lua.LState, lib string, t *lua.LTable) *lua.LTable {
+	mt := L.NewTable()
+	mt.RawSetString("__index", L.NewFunction(func(L *lua.LState) int {
+		key := L.CheckAny(2)
+		L.RaiseError("%s", blockedError(lib+"."+key.String()))
+		return 0
+	}))
+	mt.RawSetString("__metatable", lua.LString("sandboxed"))
+	L.SetMetatable(t, mt)
+	return t
+}
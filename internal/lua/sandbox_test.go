@@ -0,0 +1,59 @@
+package lua
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestSandboxBlocksEscapes(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "escaped")
+	for _, tc := range []struct {
+		code, blocked string
+	}{
+		{`os.execute("touch ` + marker + `")`, "os.execute"},
+		{`io.open("` + marker + `", "w")`, "io.open"},
+		{`local f = function() module("os") execute("touch ` + marker + `") end f()`, "module"},
+		{`dofile("/etc/passwd")`, "dofile"},
+		{`loadfile("/etc/passwd")`, "loadfile"},
+		{`debug.getregistry()`, "debug.getregistry"},
+		{`setfenv(1, {})`, "setfenv"},
+		{`getfenv(1)`, "getfenv"},
+	} {
+		L := newState(false, lua.Options{}, t.TempDir())
+		err := L.DoString(tc.code)
+		L.Close()
+		want := tc.blocked + " is not available in sandboxed patterns"
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want %q", tc.code, err, want)
+		}
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("a sandboxed script created a file")
+	}
+}
+
+func TestSandboxKeepsClockAndLoadedOSSubset(t *testing.T) {
+	L := newState(false, lua.Options{}, t.TempDir())
+	defer L.Close()
+	L.SetGlobal("loaded", L.GetField(L.Get(lua.RegistryIndex), "_LOADED"))
+	// Reading a missing field of the sandboxed os raises an error, so look with rawget.
+	code := `
+assert(type(os.time()) == "number" and type(os.clock()) == "number")
+assert(rawget(loaded.os, "execute") == nil, "the loaded os module is the full library")
+`
+	if err := L.DoString(code); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrustedStateKeepsFullLibraries(t *testing.T) {
+	L := newState(true, lua.Options{}, t.TempDir())
+	defer L.Close()
+	if err := L.DoString(`assert(type(os.execute) == "function" and type(io.open) == "function")`); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,455 @@
+package lua
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bledom-controller/internal/ble"
+	"bledom-controller/internal/config"
+	"bledom-controller/internal/core"
+
+	"github.com/robfig/cron/v3"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// TestRun describes a headless run of a pattern (see RunHeadless).
+type TestRun struct {
+	Pattern  string
+	Params   map[string]interface{}
+	Duration time.Duration // virtual time after which the pattern is stopped
+	Start    time.Time     // virtual wall-clock time at the start, seen by os.time() and os.date()
+	Seed     int64         // seed of math.random
+	Events   []TestEvent
+}
+
+// TestEvent is a system event delivered to a headless run at a virtual time. Event is a hook
+// name of on(): power_changed (Value "on" or "off"), color_changed (Value "#rrggbb"),
+// brightness_changed (Value 0-100) or mqtt (a message with payload Value on Topic).
+type TestEvent struct {
+	At    time.Duration
+	Event string
+	Topic string
+	Value string
+}
+
+// RunHeadless runs a pattern against a virtual clock and a recording strip and returns the
+// timeline: one line per strip write, print() call and injected event, stamped with the
+// virtual time, and a last line saying how the run ended. sleep() and the built-in effects
+// return at once, so a run takes about as long as the script computes. The run ends when the
+// script returns or fails, or after run.Duration. Setup problems, such as an unknown pattern
+// or invalid parameters, are returned as an error; script failures end the timeline.
+func RunHeadless(patternsDir string, luaCfg config.LuaConfig, run TestRun) ([]string, error) {
+	if run.Duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+	events := append([]TestEvent(nil), run.Events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+	for _, ev := range events {
+		if _, err := ev.coreEvent(""); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sim := &simulation{
+		start:  run.Start,
+		now:    run.Start,
+		end:    run.Start.Add(run.Duration),
+		cancel: cancel,
+		rand:   rand.New(rand.NewSource(run.Seed)),
+		events: events,
+	}
+	st := core.NewState()
+	sim.strip = &recorder{sim: sim, state: ble.State{
+		IsOn: st.Power, R: st.ColorR, G: st.ColorG, B: st.ColorB,
+		Brightness: st.Brightness, Speed: st.Speed,
+	}}
+	e := &Engine{
+		bleController: sim.strip,
+		patternsDir:   patternsDir,
+		state:         st,
+		luaCfg:        luaCfg,
+		limits:        newLimits(luaCfg),
+		out:           &output{ble: sim.strip},
+		sim:           sim,
+	}
+	sim.state = st
+
+	path, err := e.GetPatternPath(run.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	if clean, _ := sanitizeFilename(run.Pattern); isLibraryModule(clean) {
+		return nil, fmt.Errorf("%s is a library module", run.Pattern)
+	}
+	info, err := e.GetPatternInfo(run.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	params, err := resolveParams(info.Params, run.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	reason, err := e.execute(run.Pattern, params, nil, e.isTrusted(run.Pattern, cmdRunFile), func(L *lua.LState) error {
+		L.SetGlobal("params", paramsTable(L, params, info.Params))
+		return L.DoFile(path)
+	}, ctx)
+	switch {
+	case err != nil:
+		msg, _ := e.describeFailure(reason, err)
+		sim.record("error %s: %s", reason, msg)
+	case ctx.Err() != nil:
+		sim.record("stopped")
+	default:
+		sim.record("returned")
+	}
+	return sim.strip.lines, nil
+}
+
+// simulation is the virtual clock of a headless run. Time only moves when the script sleeps;
+// timer hooks fire and injected events arrive as it passes their time.
+type simulation struct {
+	start, now, end time.Time
+	cancel          context.CancelFunc
+	rand            *rand.Rand
+	strip           *recorder
+	state           *core.State
+
+	timers []*simTimer
+	// events are the injected events still to come; arrived have reached the strip but not
+	// yet the script's hooks.
+	events  []TestEvent
+	arrived []TestEvent
+}
+
+// simTimer is a tick or cron hook on the virtual clock.
+type simTimer struct {
+	hk   *hook
+	next time.Time
+	// interval is the tick interval; cron timers use sched instead.
+	interval time.Duration
+	sched    cron.Schedule
+}
+
+func (t *simTimer) reschedule(now time.Time) {
+	if t.sched != nil {
+		t.next = t.sched.Next(now)
+		return
+	}
+	for !t.next.After(now) {
+		t.next = t.next.Add(t.interval)
+	}
+}
+
+func (s *simulation) addTicker(hk *hook, interval time.Duration) {
+	s.timers = append(s.timers, &simTimer{hk: hk, next: s.now.Add(interval), interval: interval})
+}
+
+func (s *simulation) addCron(hk *hook, sched cron.Schedule) {
+	s.timers = append(s.timers, &simTimer{hk: hk, next: sched.Next(s.now), sched: sched})
+}
+
+// record adds a timeline line at the current virtual time.
+func (s *simulation) record(format string, args ...interface{}) {
+	elapsed := s.now.Sub(s.start)
+	line := fmt.Sprintf("%d.%03ds", elapsed/time.Second, elapsed%time.Second/time.Millisecond)
+	s.strip.lines = append(s.strip.lines, fmt.Sprintf("%9s  %s", line, fmt.Sprintf(format, args...)))
+}
+
+// sleep advances the clock by d without running hooks. It reports true, and stops the
+// script, once the run's time is up.
+func (s *simulation) sleep(d time.Duration) bool {
+	target := s.now.Add(max(d, 0))
+	if target.After(s.end) {
+		target = s.end
+	}
+	for len(s.events) > 0 && !s.events[0].at(s).After(target) {
+		s.now = s.events[0].at(s)
+		s.arrive()
+	}
+	s.now = target
+	return s.timeUp()
+}
+
+// wait is hookSet.wait on the virtual clock: it advances by d (until the end of the run when
+// d < 0), calling the hooks of timers and events in time order.
+func (s *simulation) wait(h *hookSet, d time.Duration) bool {
+	if h.dispatching {
+		return s.sleep(d)
+	}
+	target := s.end
+	if d >= 0 && s.now.Add(d).Before(s.end) {
+		target = s.now.Add(d)
+	}
+	for {
+		// Deliver what arrived while the script could not take it, then timers that are due.
+		for len(s.arrived) > 0 {
+			ev := s.arrived[0]
+			s.arrived = s.arrived[1:]
+			s.dispatch(h, ev)
+		}
+		if t := s.dueTimer(s.now); t != nil {
+			t.reschedule(s.now)
+			h.call(t.hk.fn)
+			continue
+		}
+		if h.ctx.Err() != nil {
+			return true
+		}
+
+		next := target
+		var timer *simTimer
+		if t := s.dueTimer(target); t != nil {
+			next, timer = t.next, t
+		}
+		if len(s.events) > 0 && !s.events[0].at(s).After(next) {
+			s.now = s.events[0].at(s)
+			s.arrive()
+			continue
+		}
+		s.now = next
+		if timer == nil {
+			return s.timeUp()
+		}
+	}
+}
+
+// dueTimer returns the timer that fires first at or before t, or nil.
+func (s *simulation) dueTimer(t time.Time) *simTimer {
+	var due *simTimer
+	for _, timer := range s.timers {
+		if !timer.next.After(t) && (due == nil || timer.next.Before(due.next)) {
+			due = timer
+		}
+	}
+	return due
+}
+
+func (s *simulation) timeUp() bool {
+	if s.now.Before(s.end) {
+		return false
+	}
+	s.cancel()
+	return true
+}
+
+// arrive applies the next injected event to the strip and user state, as the agent would,
+// and queues it for the script's hooks.
+func (s *simulation) arrive() {
+	ev := s.events[0]
+	s.events = s.events[1:]
+	if ev.Event == "mqtt" {
+		s.record("event mqtt %s %s", ev.Topic, ev.Value)
+	} else {
+		s.record("event %s %s", ev.Event, ev.Value)
+	}
+	event, _ := ev.coreEvent("")
+	payload, _ := event.Payload.(map[string]interface{})
+	switch ev.Event {
+	case "power_changed":
+		on := payload["isOn"].(bool)
+		s.strip.state.IsOn = on
+		s.state.SetPower(on)
+	case "color_changed":
+		r, g, b := payload["r"].(int), payload["g"].(int), payload["b"].(int)
+		s.strip.state.R, s.strip.state.G, s.strip.state.B = r, g, b
+		s.state.SetColor(r, g, b)
+		s.state.SetUserColor(r, g, b)
+	case "brightness_changed":
+		v := payload["brightness"].(int)
+		s.strip.state.Brightness = v
+		s.state.SetBrightness(v)
+	}
+	s.arrived = append(s.arrived, ev)
+}
+
+// dispatch delivers an event to the script's hooks. An MQTT message goes to every hook whose
+// topic filter matches.
+func (s *simulation) dispatch(h *hookSet, ev TestEvent) {
+	if ev.Event != "mqtt" {
+		event, _ := ev.coreEvent("")
+		h.dispatchEvent(event)
+		return
+	}
+	seen := make(map[string]bool)
+	for _, hk := range h.hooks {
+		if hk.event != "mqtt" || seen[hk.filter] || !topicMatches(hk.filter, ev.Topic) {
+			continue
+		}
+		seen[hk.filter] = true
+		event, _ := ev.coreEvent(hk.filter)
+		h.dispatchEvent(event)
+	}
+}
+
+func (ev TestEvent) at(s *simulation) time.Time {
+	return s.start.Add(ev.At)
+}
+
+// coreEvent returns the EventBus event the agent publishes for ev. filter is the MQTT topic
+// filter the message was received on.
+func (ev TestEvent) coreEvent(filter string) (core.Event, error) {
+	switch ev.Event {
+	case "power_changed":
+		if ev.Value != "on" && ev.Value != "off" {
+			return core.Event{}, fmt.Errorf("power_changed: want on or off, got %q", ev.Value)
+		}
+		return core.Event{Type: core.PowerChangedEvent, Payload: map[string]interface{}{"isOn": ev.Value == "on"}}, nil
+	case "color_changed":
+		c, err := parseHexColor(ev.Value)
+		if err != nil {
+			return core.Event{}, fmt.Errorf("color_changed: %w", err)
+		}
+		r, g, b := c.ints()
+		return core.Event{Type: core.ColorChangedEvent, Payload: map[string]interface{}{"r": r, "g": g, "b": b}}, nil
+	case "brightness_changed":
+		v, err := strconv.Atoi(ev.Value)
+		if err != nil || v < 0 || v > 100 {
+			return core.Event{}, fmt.Errorf("brightness_changed: want 0-100, got %q", ev.Value)
+		}
+		return core.Event{Type: core.StateChangedEvent, Payload: map[string]interface{}{"brightness": v}}, nil
+	case "mqtt":
+		if ev.Topic == "" {
+			return core.Event{}, fmt.Errorf("mqtt: topic expected")
+		}
+		return core.Event{Type: core.MQTTMessageEvent, Payload: map[string]interface{}{
+			"filter": filter, "topic": ev.Topic, "payload": ev.Value,
+		}}, nil
+	}
+	return core.Event{}, fmt.Errorf("unknown event %q (one of power_changed, color_changed, brightness_changed, mqtt)", ev.Event)
+}
+
+// topicMatches reports whether an MQTT topic matches a filter with + and # wildcards.
+func topicMatches(filter, topic string) bool {
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+// installClock replaces os.time, os.clock, os.date and math.random so they follow the virtual
+// clock and the run's seed. os.date reports UTC, so runs do not depend on the machine's zone.
+func (s *simulation) installClock(L *lua.LState) {
+	if osTable, ok := L.GetGlobal(lua.OsLibName).(*lua.LTable); ok {
+		osDate := osTable.RawGetString("date")
+		osTime := osTable.RawGetString("time")
+		osTable.RawSetString("time", L.NewFunction(func(L *lua.LState) int {
+			if L.GetTop() == 0 || L.Get(1) == lua.LNil {
+				L.Push(lua.LNumber(s.now.Unix()))
+				return 1
+			}
+			return callThrough(L, osTime)
+		}))
+		osTable.RawSetString("clock", L.NewFunction(func(L *lua.LState) int {
+			L.Push(lua.LNumber(s.now.Sub(s.start).Seconds()))
+			return 1
+		}))
+		osTable.RawSetString("date", L.NewFunction(func(L *lua.LState) int {
+			format := "%c"
+			if L.GetTop() >= 1 {
+				format = L.CheckString(1)
+			}
+			when := lua.LValue(lua.LNumber(s.now.Unix()))
+			if L.GetTop() >= 2 {
+				when = L.Get(2)
+			}
+			L.SetTop(0)
+			L.Push(lua.LString("!" + strings.TrimLeft(format, "!")))
+			L.Push(when)
+			return callThrough(L, osDate)
+		}))
+	}
+	if mathTable, ok := L.GetGlobal(lua.MathLibName).(*lua.LTable); ok {
+		mathTable.RawSetString("random", L.NewFunction(func(L *lua.LState) int {
+			switch L.GetTop() {
+			case 0:
+				L.Push(lua.LNumber(s.rand.Float64()))
+			case 1:
+				L.Push(lua.LNumber(s.rand.Intn(L.CheckInt(1)) + 1))
+			default:
+				lo, hi := L.CheckInt(1), L.CheckInt(2)
+				L.Push(lua.LNumber(s.rand.Intn(hi-lo+1) + lo))
+			}
+			return 1
+		}))
+		mathTable.RawSetString("randomseed", L.NewFunction(func(L *lua.LState) int {
+			s.rand.Seed(L.CheckInt64(1))
+			return 0
+		}))
+	}
+}
+
+// callThrough calls fn with the arguments on the stack and returns its results.
+func callThrough(L *lua.LState, fn lua.LValue) int {
+	args := make([]lua.LValue, L.GetTop())
+	for i := range args {
+		args[i] = L.Get(i + 1)
+	}
+	L.SetTop(0)
+	L.Push(fn)
+	for _, arg := range args {
+		L.Push(arg)
+	}
+	L.Call(len(args), lua.MultRet)
+	return L.GetTop()
+}
+
+// recorder is the strip of a headless run: it keeps the state and records every write.
+type recorder struct {
+	sim   *simulation
+	state ble.State
+	lines []string
+}
+
+func (r *recorder) SetColor(red, green, blue int) {
+	r.state.R, r.state.G, r.state.B = red, green, blue
+	r.sim.record("color #%02x%02x%02x", red, green, blue)
+}
+
+func (r *recorder) SetBrightness(val int) {
+	r.state.Brightness = val
+	r.sim.record("brightness %d", val)
+}
+
+func (r *recorder) SetPower(isOn bool) {
+	r.state.IsOn = isOn
+	if isOn {
+		r.sim.record("power on")
+	} else {
+		r.sim.record("power off")
+	}
+}
+
+func (r *recorder) GetState() ble.State {
+	return r.state
+}
+
+// printRecorder puts what a headless run prints on its timeline.
+type printRecorder struct {
+	sim *simulation
+}
+
+func (p printRecorder) Enabled(context.Context, slog.Level) bool { return true }
+
+func (p printRecorder) Handle(_ context.Context, r slog.Record) error {
+	p.sim.record("print %s", r.Message)
+	return nil
+}
+
+func (p printRecorder) WithAttrs([]slog.Attr) slog.Handler { return p }
+
+func (p printRecorder) WithGroup(string) slog.Handler { return p }
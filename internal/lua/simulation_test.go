@@ -0,0 +1,121 @@
+package lua
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"bledom-controller/internal/config"
+)
+
+var testStart = time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// headless writes code as test.lua and runs it headless with the given settings.
+func headless(t *testing.T, code string, luaCfg config.LuaConfig, run TestRun) []string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "test.lua"), []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run.Pattern = "test.lua"
+	if run.Start.IsZero() {
+		run.Start = testStart
+	}
+	lines, err := RunHeadless(dir, luaCfg, run)
+	if err != nil {
+		t.Fatalf("RunHeadless: %v", err)
+	}
+	return lines
+}
+
+func defaultLuaConfig(t *testing.T) config.LuaConfig {
+	t.Helper()
+	cfg, err := config.Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Lua
+}
+
+func TestRunHeadlessTimeline(t *testing.T) {
+	code := `
+print("start")
+set_color(255, 0, 0)
+sleep(250)
+set_color(0, 0, 255)
+sleep(1000)
+`
+	got := headless(t, code, defaultLuaConfig(t), TestRun{Duration: time.Second})
+	want := []string{
+		"   0.000s  print start",
+		"   0.000s  color #ff0000",
+		"   0.250s  color #0000ff",
+		"   1.000s  stopped",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("timeline:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRunHeadlessReturnsAndErrors(t *testing.T) {
+	cfg := defaultLuaConfig(t)
+	if got := headless(t, `sleep(100)`, cfg, TestRun{Duration: time.Second}); got[len(got)-1] != "   0.100s  returned" {
+		t.Errorf("last line %q, want the script to return at 0.100s", got[len(got)-1])
+	}
+	got := headless(t, "sleep(200)\nerror('boom')", cfg, TestRun{Duration: time.Second})
+	if last := got[len(got)-1]; !strings.HasPrefix(last, "   0.200s  error error:") || !strings.Contains(last, "boom") {
+		t.Errorf("last line %q, want the error at 0.200s", last)
+	}
+}
+
+func TestRunHeadlessEvents(t *testing.T) {
+	code := `
+on("mqtt", "home/#", function(payload, topic) print(topic .. "=" .. payload) end)
+while true do sleep(1000) end
+`
+	run := TestRun{Duration: 3 * time.Second, Events: []TestEvent{{At: 1500 * time.Millisecond, Event: "mqtt", Topic: "home/door", Value: "open"}}}
+	got := headless(t, code, defaultLuaConfig(t), run)
+	want := []string{
+		"   1.500s  event mqtt home/door open",
+		"   1.500s  print home/door=open",
+		"   3.000s  stopped",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("timeline:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRunHeadlessIsDeterministic(t *testing.T) {
+	code := `for i = 1, 5 do set_color(math.random(0, 255), math.random(0, 255), 0) sleep(10) end`
+	cfg := defaultLuaConfig(t)
+	run := TestRun{Duration: time.Second, Seed: 7}
+	if a, b := headless(t, code, cfg, run), headless(t, code, cfg, run); !reflect.DeepEqual(a, b) {
+		t.Errorf("two runs with the same seed differ:\n%s\n---\n%s", strings.Join(a, "\n"), strings.Join(b, "\n"))
+	}
+}
+
+// The instruction budget is per second of the virtual clock: a pattern that sleeps is not
+// charged for running its virtual minutes in a fraction of a real second.
+func TestRunHeadlessInstructionBudgetUsesVirtualClock(t *testing.T) {
+	cfg := defaultLuaConfig(t)
+	cfg.MaxInstructionsPerSecond = 200000
+	code := `
+while true do
+  local x = 0
+  for i = 1, 2000 do x = x + i end
+  sleep(100)
+end
+`
+	got := headless(t, code, cfg, TestRun{Duration: 2 * time.Minute})
+	if last := got[len(got)-1]; last != " 120.000s  stopped" {
+		t.Errorf("last line %q, want the run to be stopped at 120s", last)
+	}
+
+	got = headless(t, `while true do end`, cfg, TestRun{Duration: time.Minute})
+	if last := got[len(got)-1]; !strings.Contains(last, "error instruction_limit") {
+		t.Errorf("last line %q, want a busy loop to hit the instruction limit", last)
+	}
+}
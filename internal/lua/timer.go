@@ -0,0 +1,188 @@
+package lua
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// End actions of a time-limited run. Any other value names the pattern to run next.
+const (
+	ThenRestore  = "restore"
+	ThenPowerOff = "off"
+)
+
+// minRunLimit is the shortest time limit a run can be given.
+const minRunLimit = time.Second
+
+// RunLimit bounds how long a pattern runs and says what happens when the time is up. The
+// zero value runs the pattern until it ends or is stopped, or for its @max_runtime.
+type RunLimit struct {
+	Duration string `json:"duration,omitempty"` // e.g. "30m"
+	Until    string `json:"until,omitempty"`    // "23:30" (the next such time) or an RFC 3339 time
+	Then     string `json:"then,omitempty"`     // ThenRestore (default), ThenPowerOff or a pattern file name
+}
+
+// runTimer is a resolved RunLimit: when the run ends and what follows.
+type runTimer struct {
+	endsAt time.Time
+	then   string
+}
+
+// status describes the timer for pattern_status. remaining is in whole seconds from now.
+func (t runTimer) status() map[string]interface{} {
+	return map[string]interface{}{
+		"endsAt":    t.endsAt,
+		"remaining": remainingSeconds(t.endsAt),
+		"then":      t.then,
+	}
+}
+
+// remainingSeconds returns the seconds left until endsAt, rounded up and never negative.
+func remainingSeconds(endsAt time.Time) int {
+	left := time.Until(endsAt)
+	if left <= 0 {
+		return 0
+	}
+	return int((left + time.Second - 1) / time.Second)
+}
+
+// TimerStatus returns a copy of a pattern_status timer with its remaining time counted from
+// now, for clients that join while the run is in progress.
+func TimerStatus(timer map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(timer))
+	for k, v := range timer {
+		out[k] = v
+	}
+	if endsAt, ok := timer["endsAt"].(time.Time); ok {
+		out["remaining"] = remainingSeconds(endsAt)
+	}
+	return out
+}
+
+// resolveTimer turns a run limit, or the pattern's @max_runtime when the limit sets no end,
+// into a timer. It returns the zero timer when the run is unlimited.
+func (e *Engine) resolveTimer(limit RunLimit, info PatternInfo, now time.Time) (runTimer, error) {
+	var t runTimer
+	switch {
+	case limit.Duration != "" && limit.Until != "":
+		return t, fmt.Errorf("give either a duration or an end time, not both")
+	case limit.Duration != "":
+		d, err := parseRunDuration(limit.Duration)
+		if err != nil {
+			return t, err
+		}
+		t.endsAt = now.Add(d)
+	case limit.Until != "":
+		endsAt, err := parseEndTime(limit.Until, now)
+		if err != nil {
+			return t, err
+		}
+		t.endsAt = endsAt
+	case info.MaxRuntime != "":
+		d, err := parseRunDuration(info.MaxRuntime)
+		if err != nil {
+			return t, fmt.Errorf("@max_runtime: %w", err)
+		}
+		t.endsAt = now.Add(d)
+	default:
+		if limit.Then != "" {
+			return t, fmt.Errorf("an end action needs a duration or an end time")
+		}
+		return t, nil
+	}
+
+	t.then = strings.TrimSpace(limit.Then)
+	switch t.then {
+	case "":
+		t.then = ThenRestore
+	case ThenRestore, ThenPowerOff:
+	default:
+		clean, err := sanitizeFilename(t.then)
+		if err != nil {
+			return t, fmt.Errorf("end action must be %s, %s or a pattern file: %w", ThenRestore, ThenPowerOff, err)
+		}
+		if isLibraryModule(clean) {
+			return t, fmt.Errorf("end action %s is a library module", t.then)
+		}
+		if _, err := e.GetPatternInfo(clean); err != nil {
+			return t, fmt.Errorf("end action: pattern %q not found", t.then)
+		}
+	}
+	return t, nil
+}
+
+func parseRunDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q (e.g. 30s, 10m, 1h30m)", s)
+	}
+	if d < minRunLimit {
+		return 0, fmt.Errorf("duration %q is shorter than %s", s, minRunLimit)
+	}
+	return d, nil
+}
+
+// parseEndTime accepts a local "15:04" clock time, meaning its next occurrence, or an
+// RFC 3339 time in the future.
+func parseEndTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if clock, err := time.ParseInLocation("15:04", s, now.Location()); err == nil {
+		t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid end time %q (use HH:MM or an RFC 3339 time)", s)
+	}
+	if t.Sub(now) < minRunLimit {
+		return time.Time{}, fmt.Errorf("end time %s is in the past", s)
+	}
+	return t, nil
+}
+
+// ResumePattern starts a pattern again after it was interrupted, e.g. by a disconnect. timer
+// is the pattern_status timer of the interrupted run, if it had one: the run keeps its end
+// time and end action, and if the end time has passed meanwhile only the end action is
+// performed.
+func (e *Engine) ResumePattern(name string, params, timer map[string]interface{}) error {
+	endsAt, ok := timer["endsAt"].(time.Time)
+	if !ok {
+		return e.RunPattern(name, params, RunLimit{})
+	}
+	then, _ := timer["then"].(string)
+	if time.Until(endsAt) >= minRunLimit {
+		return e.RunPattern(name, params, RunLimit{Until: endsAt.Format(time.RFC3339), Then: then})
+	}
+	logger.Info("Time of the interrupted pattern ran out meanwhile", "pattern", name, "ended_at", endsAt)
+	e.cmdChan <- engineCmd{kind: cmdTimeUp, name: name, timer: runTimer{endsAt: endsAt, then: then}}
+	return nil
+}
+
+// executeTimeUp performs the end action of a run whose time ran out while it was not running.
+func (e *Engine) executeTimeUp(cmd engineCmd, ctx context.Context, done chan struct{}) {
+	defer close(done)
+	e.timeUp(ctx, cmd.name, cmd.timer)
+}
+
+// timeUp performs a timer's end action once the pattern has been stopped for it.
+func (e *Engine) timeUp(ctx context.Context, name string, t runTimer) {
+	logger.Info("Pattern time is up", "pattern", name, "then", t.then)
+	switch t.then {
+	case ThenRestore:
+		e.restore(ctx)
+	case ThenPowerOff:
+		e.out.SetPower(false)
+	default:
+		// The worker replaces this job with the next pattern, which announces itself.
+		if err := e.RunPattern(t.then, nil, RunLimit{}); err == nil {
+			return
+		}
+		e.restore(ctx)
+	}
+	e.announceIdle(ctx)
+}
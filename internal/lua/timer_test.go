@@ -0,0 +1,41 @@
+package lua
+
+import (
+	"testing"
+	"time"
+
+	"bledom-controller/internal/core"
+)
+
+// A run whose end time passed while the strip was disconnected only gets its end action.
+func TestResumePatternAfterEndTime(t *testing.T) {
+	e, sub := playlistEngine(t, map[string]string{"a.lua": `set_color(255, 0, 0) while true do sleep(100) end`})
+	e.cmdChan = make(chan engineCmd, 10)
+	e.stopChan = make(chan bool, 1)
+	go e.runLoop()
+	defer close(e.cmdChan)
+
+	timer := map[string]interface{}{"endsAt": time.Now().Add(-time.Minute), "then": ThenPowerOff}
+	if err := e.ResumePattern("a.lua", nil, timer); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case ev := <-sub:
+			if ev.Type != core.PatternChangedEvent {
+				continue
+			}
+			running, _ := ev.Payload.(map[string]interface{})["running"].(string)
+			if running != "" {
+				t.Fatalf("pattern %s was started", running)
+			}
+			lines := e.sim.strip.lines
+			if len(lines) != 1 || lines[0] != "   0.000s  power off" {
+				t.Errorf("strip writes %q, want the strip powered off", lines)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("no idle status after resuming")
+		}
+	}
+}
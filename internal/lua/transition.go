@@ -0,0 +1,275 @@
+package lua
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"bledom-controller/internal/ble"
+	"bledom-controller/internal/config"
+	"bledom-controller/internal/core"
+)
+
+// What the strip does when a pattern ends on its own, declared with "@on_end" in the script
+// header.
+const (
+	OnEndRestore = "restore"
+	OnEndKeep    = "keep"
+)
+
+// transitionTick is how often a transition writes an intermediate frame.
+const transitionTick = 50 * time.Millisecond
+
+// Causes with which the worker cancels a running job; they decide what happens to the strip
+// and who announces that nothing runs any more.
+var (
+	// errStopped: the pattern was stopped; a restore job follows.
+	errStopped = errors.New("stopped")
+	// errInterrupted: the strip was taken over (a color, power or hardware effect was chosen).
+	errInterrupted = errors.New("interrupted")
+	// errReplaced: another pattern starts and crossfades from the current frame.
+	errReplaced = errors.New("replaced")
+)
+
+// transitions are the crossfade settings from the configuration.
+type transitions struct {
+	start  time.Duration
+	stop   time.Duration
+	easing func(float64) float64
+	rest   *config.RestState
+}
+
+func newTransitions(cfg config.TransitionConfig) transitions {
+	t := transitions{rest: cfg.Rest, easing: easings["linear"]}
+	t.start, _ = time.ParseDuration(cfg.Start)
+	t.stop, _ = time.ParseDuration(cfg.Stop)
+	if fn, ok := easings[cfg.Easing]; ok {
+		t.easing = fn
+	} else if cfg.Easing != "" {
+		logger.Warn("Unknown transition easing, using linear", "easing", cfg.Easing)
+	}
+	return t
+}
+
+// output sits between scripts and the strip. While a pattern starts it crossfades from what
+// the strip showed to what the script writes, so every pattern fades in without changes to
+// the script.
+type output struct {
+	ble strip
+
+	mu     sync.Mutex
+	fading bool
+	// color and brightness are the latest values the script wrote during the crossfade.
+	color      rgb
+	brightness int
+}
+
+// SetColor sets the strip color, or the crossfade's target while one runs.
+func (o *output) SetColor(r, g, b int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.fading {
+		o.color = rgb{float64(r), float64(g), float64(b)}
+		return
+	}
+	o.ble.SetColor(r, g, b)
+}
+
+// SetBrightness sets the strip brightness, or the crossfade's target while one runs.
+func (o *output) SetBrightness(v int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.fading {
+		o.brightness = v
+		return
+	}
+	o.ble.SetBrightness(v)
+}
+
+// SetPower switches the strip on or off. Power is not faded.
+func (o *output) SetPower(on bool) {
+	o.ble.SetPower(on)
+}
+
+// State returns the strip state as the script sees it: during a crossfade, the color and
+// brightness it wrote rather than the blend on the strip.
+func (o *output) State() ble.State {
+	bs := o.ble.GetState()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.fading {
+		bs.R, bs.G, bs.B = o.color.ints()
+		bs.Brightness = o.brightness
+	}
+	return bs
+}
+
+// startCrossfade blends from the current strip state to what the script writes over d, then
+// hands the strip to the script. Writes are held back from the moment it returns. The
+// returned channel is closed once the crossfade is done, or canceled with ctx, in which case
+// the strip is left as it is. Nothing is blended while the strip is off.
+func (o *output) startCrossfade(ctx context.Context, d time.Duration, easing func(float64) float64) <-chan struct{} {
+	done := make(chan struct{})
+	bs := o.ble.GetState()
+	if d <= 0 || !bs.IsOn {
+		close(done)
+		return done
+	}
+	from := rgb{float64(bs.R), float64(bs.G), float64(bs.B)}
+	fromBrightness := bs.Brightness
+
+	o.mu.Lock()
+	o.fading, o.color, o.brightness = true, from, fromBrightness
+	o.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		shownR, shownG, shownB := from.ints()
+		shownBrightness := fromBrightness
+		start := time.Now()
+		ticker := time.NewTicker(transitionTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				o.mu.Lock()
+				o.fading = false
+				o.mu.Unlock()
+				return
+			case <-ticker.C:
+			}
+
+			progress := float64(time.Since(start)) / float64(d)
+			o.mu.Lock()
+			if progress >= 1 {
+				// Hand over: write the script's latest values and let its writes through.
+				o.fading = false
+				o.ble.SetColor(o.color.ints())
+				o.ble.SetBrightness(o.brightness)
+				o.mu.Unlock()
+				return
+			}
+			to, toBrightness := o.color, o.brightness
+			o.mu.Unlock()
+
+			t := easing(progress)
+			if r, g, b := lerpPerceptual(from, to, t).ints(); r != shownR || g != shownG || b != shownB {
+				o.ble.SetColor(r, g, b)
+				shownR, shownG, shownB = r, g, b
+			}
+			if b := lerpInt(fromBrightness, toBrightness, t); b != shownBrightness {
+				o.ble.SetBrightness(b)
+				shownBrightness = b
+			}
+		}
+	}()
+	return done
+}
+
+// fadeTo fades the strip to color and brightness over d. It reports false if ctx was
+// canceled first.
+func (o *output) fadeTo(ctx context.Context, color rgb, brightness int, d time.Duration, easing func(float64) float64) bool {
+	bs := o.ble.GetState()
+	from := rgb{float64(bs.R), float64(bs.G), float64(bs.B)}
+	fromBrightness := bs.Brightness
+
+	shownR, shownG, shownB := from.ints()
+	shownBrightness := fromBrightness
+	start := time.Now()
+	for elapsed := time.Duration(0); elapsed < d; elapsed = time.Since(start) {
+		t := easing(float64(elapsed) / float64(d))
+		if r, g, b := lerpPerceptual(from, color, t).ints(); r != shownR || g != shownG || b != shownB {
+			o.ble.SetColor(r, g, b)
+			shownR, shownG, shownB = r, g, b
+		}
+		if b := lerpInt(fromBrightness, brightness, t); b != shownBrightness {
+			o.ble.SetBrightness(b)
+			shownBrightness = b
+		}
+		if cancellableSleep(ctx, transitionTick) {
+			return false
+		}
+	}
+	o.ble.SetColor(color.ints())
+	o.ble.SetBrightness(brightness)
+	return true
+}
+
+func lerpInt(a, b int, t float64) int {
+	return clampChannel(float64(a) + t*float64(b-a))
+}
+
+// restState returns what the strip returns to after a pattern: the configured rest state,
+// with the values it leaves out taken from what the user last chose.
+func (e *Engine) restState() (color rgb, brightness int, power bool) {
+	st := core.NewState()
+	if e.state != nil {
+		*st = e.state.Clone()
+	}
+	color = rgb{float64(st.UserColorR), float64(st.UserColorG), float64(st.UserColorB)}
+	brightness, power = st.Brightness, st.Power
+	if rest := e.transitions.rest; rest != nil {
+		if c, err := parseHexColor(rest.Color); rest.Color != "" && err == nil {
+			color = c
+		}
+		if rest.Brightness > 0 {
+			brightness = rest.Brightness
+		}
+		if rest.Power != nil {
+			power = *rest.Power
+		}
+	}
+	return color, brightness, power
+}
+
+// restore fades the strip back to the rest state after a pattern. The strip is switched on
+// first if it should end up on, and off once the fade is done if it should end up off.
+func (e *Engine) restore(ctx context.Context) {
+	color, brightness, power := e.restState()
+	isOn := e.bleController.GetState().IsOn
+	if !power && !isOn {
+		return
+	}
+	logger.Debug("Restoring rest state", "color", color.hex(), "brightness", brightness, "power", power)
+	if power && !isOn {
+		e.out.SetPower(true)
+	}
+	if !e.out.fadeTo(ctx, color, brightness, e.transitions.stop, e.transitions.easing) {
+		return
+	}
+	if !power {
+		e.out.SetPower(false)
+	}
+}
+
+// executeRestore is the job the worker runs after stopping a pattern.
+func (e *Engine) executeRestore(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	e.restore(ctx)
+	e.announceIdle(ctx)
+}
+
+// endPattern runs when a job's pattern is over. If the pattern ended on its own and does not
+// keep its last frame, the strip fades back to the rest state first.
+func (e *Engine) endPattern(ctx context.Context, keepLastFrame bool) {
+	if context.Cause(ctx) == nil && !keepLastFrame {
+		e.restore(ctx)
+	}
+	e.announceIdle(ctx)
+}
+
+// announceIdle publishes that no pattern runs, unless the job was stopped or replaced: then
+// the restore job or the next pattern announces itself.
+func (e *Engine) announceIdle(ctx context.Context) {
+	switch context.Cause(ctx) {
+	case errStopped, errReplaced:
+		return
+	}
+	if e.eventBus != nil {
+		e.eventBus.Publish(core.Event{
+			Type:    core.PatternChangedEvent,
+			Payload: map[string]interface{}{"running": ""},
+		})
+	}
+}
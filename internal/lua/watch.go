@@ -0,0 +1,105 @@
+package lua
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSettle is how long the watcher waits after the last change before reporting, so a
+// burst of changes such as a git checkout is reported once.
+const watchSettle = 300 * time.Millisecond
+
+// WatchPatterns watches the patterns directory and its lib/ subdirectory until ctx is done.
+// Once changes settle, onChange is called with the names of the .lua files that were
+// created, written, renamed or removed, such as "police.lua" and "lib/util.lua", or "lib"
+// when the shared modules directory itself was added or removed.
+func (e *Engine) WatchPatterns(ctx context.Context, onChange func(changed []string)) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := w.Add(e.patternsDir); err != nil {
+		w.Close()
+		return err
+	}
+	libDir := filepath.Join(e.patternsDir, libDirName)
+	if err := w.Add(libDir); err != nil && !os.IsNotExist(err) {
+		logger.Warn("Not watching shared modules", "dir", libDir, "err", err)
+	}
+
+	go func() {
+		defer w.Close()
+		pending := make(map[string]bool)
+		settle := time.NewTimer(watchSettle)
+		settle.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				settle.Stop()
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Name == libDir {
+					// The whole directory was added or removed, as by a git checkout.
+					if ev.Has(fsnotify.Create) {
+						if err := w.Add(libDir); err != nil {
+							logger.Warn("Not watching shared modules", "dir", libDir, "err", err)
+						}
+					}
+					pending[libDirName] = true
+				} else if name, ok := e.watchedName(ev); ok {
+					pending[name] = true
+				} else {
+					continue
+				}
+				settle.Reset(watchSettle)
+			case <-settle.C:
+				if len(pending) == 0 {
+					continue
+				}
+				changed := make([]string, 0, len(pending))
+				for name := range pending {
+					changed = append(changed, name)
+				}
+				sort.Strings(changed)
+				clear(pending)
+				onChange(changed)
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("Pattern watcher error", "err", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// watchedName returns the pattern or module name of a file event, ignoring permission changes,
+// other files and hidden editor files.
+func (e *Engine) watchedName(ev fsnotify.Event) (string, bool) {
+	if ev.Op == fsnotify.Chmod {
+		return "", false
+	}
+	rel, err := filepath.Rel(e.patternsDir, ev.Name)
+	if err != nil {
+		return "", false
+	}
+	name := filepath.ToSlash(rel)
+	base := filepath.Base(rel)
+	if filepath.Ext(base) != ".lua" || strings.HasPrefix(base, ".") {
+		return "", false
+	}
+	if dir := filepath.Dir(name); dir != "." && dir != libDirName {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,149 @@
+// Package metrics defines the Prometheus metrics exported by the BLEDOM controller.
+//
+// Metric names are part of the public interface (dashboards and alerts depend on them):
+// rename or remove them only with a changelog entry. The full list is documented in README.md.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bledom"
+
+// Registry holds all controller metrics plus the standard Go and process collectors.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler returns the HTTP handler serving the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// --- BLE ---
+
+var (
+	BLEConnected = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "ble", Name: "connected",
+		Help: "Whether the LED strip is currently connected (1) or not (0).",
+	})
+	BLELastConnectionChange = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "ble", Name: "last_connection_change_timestamp_seconds",
+		Help: "Unix time of the last BLE connect or disconnect.",
+	})
+	BLEConnectAttempts = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ble", Name: "connect_attempts_total",
+		Help: "BLE connection attempts by result (success, scan_timeout, scan_error, connect_error, discovery_error).",
+	}, []string{"result"})
+	BLEDisconnects = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ble", Name: "disconnects_total",
+		Help: "Number of times an established BLE connection was lost or reset.",
+	})
+	BLERSSI = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "ble", Name: "rssi_dbm",
+		Help: "Signal strength of the connected strip at discovery time, in dBm.",
+	})
+	BLEFramesWritten = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ble", Name: "frames_written_total",
+		Help: "Command frames successfully written to the device.",
+	})
+	BLEFramesDropped = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ble", Name: "frames_dropped_total",
+		Help: "Command frames that were not delivered, by reason (queue_full, not_connected, write_error).",
+	}, []string{"reason"})
+	BLELimiterWait = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "ble", Name: "limiter_wait_seconds",
+		Help:    "Time command frames spent waiting for the rate limiter.",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	})
+)
+
+// --- Lua ---
+
+var (
+	LuaPatternRunning = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "lua", Name: "pattern_running",
+		Help: "Whether a Lua pattern is currently running (1) or not (0).",
+	})
+	LuaPatternStarts = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "lua", Name: "pattern_starts_total",
+		Help: "Lua pattern executions started, by pattern name.",
+	}, []string{"pattern"})
+	LuaPatternErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "lua", Name: "pattern_errors_total",
+		Help: "Lua pattern executions that ended with an error, by pattern name.",
+	}, []string{"pattern"})
+	LuaPatternTerminations = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "lua", Name: "pattern_terminations_total",
+		Help: "Lua pattern executions terminated for exceeding a resource limit, by reason (instruction_limit, memory_limit, stack_limit).",
+	}, []string{"reason"})
+	LuaPatternsAbandoned = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "lua", Name: "patterns_abandoned_total",
+		Help: "Lua pattern executions that did not stop when canceled and were left running.",
+	})
+	LuaPatternRuntime = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "lua", Name: "pattern_runtime_seconds",
+		Help:    "Wall-clock duration of Lua pattern executions.",
+		Buckets: []float64{0.1, 1, 10, 60, 300, 900, 3600, 4 * 3600, 12 * 3600},
+	})
+	LuaAutomationsRunning = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "lua", Name: "automations_running",
+		Help: "Number of background automation scripts currently running.",
+	})
+	LuaAutomationRestarts = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "lua", Name: "automation_restarts_total",
+		Help: "Automation scripts restarted after ending, by automation name.",
+	}, []string{"automation"})
+)
+
+// --- Scheduler ---
+
+var SchedulerExecutions = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace, Subsystem: "scheduler", Name: "executions_total",
+	Help: "Scheduled command executions by outcome (dispatched, skipped_disabled, unsupported, invalid).",
+}, []string{"outcome"})
+
+// --- MQTT ---
+
+var (
+	MQTTConnected = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "mqtt", Name: "connected",
+		Help: "Whether the MQTT client is connected to the broker (1) or not (0).",
+	})
+	MQTTPublishFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "mqtt", Name: "publish_failures_total",
+		Help: "MQTT publishes that failed, by reason (error, timeout).",
+	}, []string{"reason"})
+)
+
+// --- Event bus ---
+
+var EventBusDrops = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace, Subsystem: "eventbus", Name: "dropped_events_total",
+	Help: "Events dropped because a subscriber's channel was full, by subscriber.",
+}, []string{"subscriber"})
+
+// --- Web server ---
+
+var (
+	WebSocketClients = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "websocket", Name: "clients",
+		Help: "Number of connected WebSocket clients.",
+	})
+	WebSocketEvictions = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "websocket", Name: "evictions_total",
+		Help: "WebSocket clients disconnected because their send queue overflowed.",
+	})
+)
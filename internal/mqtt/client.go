@@ -2,33 +2,56 @@
 package mqtt
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"bledom-controller/internal/config"
 	"bledom-controller/internal/core"
+	"bledom-controller/internal/logging"
+	"bledom-controller/internal/lua"
+	"bledom-controller/internal/metrics"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+var logger = logging.Logger("mqtt")
+
+func init() {
+	// Route the paho library's own diagnostics through the mqtt logger.
+	mqtt.ERROR = slog.NewLogLogger(logger.Handler(), slog.LevelError)
+	mqtt.CRITICAL = slog.NewLogLogger(logger.Handler(), slog.LevelError)
+	mqtt.WARN = slog.NewLogLogger(logger.Handler(), slog.LevelWarn)
+}
+
 // Client handles communication with an MQTT broker.
 type Client struct {
 	client mqtt.Client
 	cfg    *config.Config
 	prefix string
 
-	eventBus        *core.EventBus
-	commandChannel  core.CommandChannel
-	state           *core.State
-	patternListFunc func() ([]string, error)
+	eventBus         *core.EventBus
+	commandChannel   core.CommandChannel
+	state            *core.State
+	patternListFunc  func() ([]lua.PatternInfo, error)
+	playlistListFunc func() []lua.PlaylistInfo
+
+	errMu   sync.Mutex
+	lastErr error
+
+	// scriptTopics counts the pattern hooks per extra topic filter.
+	topicsMu     sync.Mutex
+	scriptTopics map[string]int
 }
 
 // NewClient creates a new MQTT client with robust reconnection logic.
-func NewClient(cfg *config.Config, eb *core.EventBus, st *core.State, cmdChan core.CommandChannel, patternListFunc func() ([]string, error)) *Client {
+func NewClient(cfg *config.Config, eb *core.EventBus, st *core.State, cmdChan core.CommandChannel, patternListFunc func() ([]lua.PatternInfo, error), playlistListFunc func() []lua.PlaylistInfo) *Client {
 	if !cfg.MQTT.Enabled {
 		return nil
 	}
@@ -64,22 +87,26 @@ func NewClient(cfg *config.Config, eb *core.EventBus, st *core.State, cmdChan co
 	opts.SetWill(prefix+"/availability", "offline", 1, true)
 
 	c := &Client{
-		cfg:             cfg,
-		prefix:          prefix,
-		eventBus:        eb,
-		state:           st,
-		commandChannel:  cmdChan,
-		patternListFunc: patternListFunc,
+		cfg:              cfg,
+		prefix:           prefix,
+		eventBus:         eb,
+		state:            st,
+		commandChannel:   cmdChan,
+		patternListFunc:  patternListFunc,
+		playlistListFunc: playlistListFunc,
+		scriptTopics:     make(map[string]int),
 	}
 
 	opts.SetOnConnectHandler(c.onConnect)
 
 	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
-		log.Printf("[MQTT] Connection lost: %v. Retrying in background...", err)
+		metrics.MQTTConnected.Set(0)
+		c.recordError(err)
+		logger.Warn("Connection lost, retrying in background", "err", err)
 	})
 
 	opts.SetReconnectingHandler(func(client mqtt.Client, options *mqtt.ClientOptions) {
-		log.Println("[MQTT] Attempting to reconnect...")
+		logger.Info("Attempting to reconnect")
 	})
 
 	c.client = mqtt.NewClient(opts)
@@ -96,12 +123,13 @@ func (c *Client) listenEvents() {
 		return
 	}
 
-	sub := c.eventBus.Subscribe(
+	sub := c.eventBus.SubscribeAs("mqtt",
 		core.StateChangedEvent,
 		core.DeviceConnectedEvent,
 		core.PatternChangedEvent,
 		core.PowerChangedEvent,
 		core.ColorChangedEvent,
+		core.MQTTSubscriptionEvent,
 	)
 
 	for event := range sub {
@@ -150,7 +178,10 @@ func (c *Client) listenEvents() {
 					if state == "" {
 						state = "IDLE"
 					}
+					playlist, _ := payload["playlist"].(map[string]interface{})
+					playlistName, _ := playlist["name"].(string)
 					c.Publish("pattern/state", state, true)
+					c.Publish("pattern/effect", c.effectName(pattern, playlistName), true)
 				}
 			}
 		case core.PowerChangedEvent:
@@ -163,6 +194,10 @@ func (c *Client) listenEvents() {
 					c.Publish("power/state", powerStr, true)
 				}
 			}
+		case core.MQTTSubscriptionEvent:
+			if payload, ok := event.Payload.(map[string]interface{}); ok {
+				c.handleSubscription(payload)
+			}
 		case core.ColorChangedEvent:
 			if payload, ok := event.Payload.(map[string]interface{}); ok {
 				if hex, okHex := payload["hex"].(string); okHex {
@@ -185,22 +220,43 @@ func (c *Client) Connect() error {
 	if c.client == nil {
 		return nil
 	}
-	log.Printf("[MQTT] Starting connection loop to %s...", c.cfg.MQTT.Broker)
+	// Never log the password; the broker and username are enough to diagnose connection problems.
+	logger.Info("Starting connection loop", "broker", c.cfg.MQTT.Broker, "username", c.cfg.MQTT.Username, "client_id", c.cfg.MQTT.ClientID)
 
 	token := c.client.Connect()
 	// Wait for the first handshake attempt.
 	if token.Wait() && token.Error() != nil {
-		log.Printf("[MQTT] Initial connection error: %v", token.Error())
+		c.recordError(token.Error())
+		logger.Error("Initial connection failed", "broker", c.cfg.MQTT.Broker, "err", token.Error())
 		return token.Error()
 	}
 
 	return nil
 }
 
+// Health returns nil while connected to the broker, otherwise the most recent connection error.
+func (c *Client) Health() error {
+	if c.client != nil && c.client.IsConnected() {
+		return nil
+	}
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.lastErr != nil {
+		return fmt.Errorf("not connected: %w", c.lastErr)
+	}
+	return errors.New("not connected")
+}
+
+func (c *Client) recordError(err error) {
+	c.errMu.Lock()
+	c.lastErr = err
+	c.errMu.Unlock()
+}
+
 // Disconnect gracefully closes the MQTT connection, sending an offline status first.
 func (c *Client) Disconnect() {
 	if c.client != nil && c.client.IsConnected() {
-		log.Println("[MQTT] Disconnecting...")
+		logger.Info("Disconnecting")
 
 		// 1. Explicitly send offline status before disconnecting
 		token := c.client.Publish(c.prefix+"/availability", 0, true, "offline")
@@ -208,15 +264,16 @@ func (c *Client) Disconnect() {
 		// Wait for publication with timeout
 		if token.WaitTimeout(2 * time.Second) {
 			if token.Error() != nil {
-				log.Printf("[MQTT] Warning: failed to publish offline status: %v", token.Error())
+				logger.Warn("Failed to publish offline status", "err", token.Error())
 			}
 		} else {
-			log.Println("[MQTT] Warning: timed out publishing offline status")
+			logger.Warn("Timed out publishing offline status")
 		}
 
 		// 2. Close connection
 		c.client.Disconnect(250)
-		log.Println("[MQTT] Disconnected.")
+		metrics.MQTTConnected.Set(0)
+		logger.Info("Disconnected")
 	}
 }
 
@@ -232,34 +289,40 @@ func (c *Client) Publish(subtopic string, payload interface{}, retained bool) {
 	token := c.client.Publish(topic, 0, retained, msg)
 	if token.WaitTimeout(5 * time.Second) {
 		if token.Error() != nil {
-			log.Printf("[MQTT] Publish error to %s: %v", topic, token.Error())
+			metrics.MQTTPublishFailures.WithLabelValues("error").Inc()
+			logger.Warn("Publish failed", "topic", topic, "err", token.Error())
 		}
 	} else {
-		log.Printf("[MQTT] Timeout publishing to %s", topic)
+		metrics.MQTTPublishFailures.WithLabelValues("timeout").Inc()
+		logger.Warn("Publish timed out", "topic", topic)
 	}
 }
 
 // onConnect is the library callback triggered when the MQTT connection is established.
 func (c *Client) onConnect(client mqtt.Client) {
-	log.Println("[MQTT] Connected to broker.")
+	logger.Info("Connected to broker", "broker", c.cfg.MQTT.Broker)
+	metrics.MQTTConnected.Set(1)
 
 	// Topic subscriptions
 	topics := map[string]mqtt.MessageHandler{
-		"power/set":      c.handlePower,
-		"brightness/set": c.handleBrightness,
-		"color/set":      c.handleColor,
-		"pattern/run":    c.handlePatternRun,
-		"pattern/stop":   c.handlePatternStop,
+		"power/set":         c.handlePower,
+		"brightness/set":    c.handleBrightness,
+		"color/set":         c.handleColor,
+		"pattern/run":       c.handlePatternRun,
+		"pattern/stop":      c.handlePatternStop,
+		"playlist/next":     c.handlePlaylistSkip(core.CmdPlaylistNext),
+		"playlist/previous": c.handlePlaylistSkip(core.CmdPlaylistPrevious),
 	}
 
 	for sub, handler := range topics {
 		topic := fmt.Sprintf("%s/%s", c.prefix, sub)
 		if token := client.Subscribe(topic, 1, handler); token.Wait() && token.Error() != nil {
-			log.Printf("[MQTT] Error subscribing to %s: %v", topic, token.Error())
+			logger.Error("Subscribe failed", "topic", topic, "err", token.Error())
 		} else {
-			log.Printf("[MQTT] Subscribed to %s", topic)
+			logger.Debug("Subscribed", "topic", topic)
 		}
 	}
+	c.resubscribeScriptTopics(client)
 
 	// Send Discovery and Online status
 	go func() {
@@ -276,14 +339,7 @@ func (c *Client) PublishHADiscovery() {
 	// Wait a moment to ensure subscriptions are processed
 	time.Sleep(1 * time.Second)
 
-	patterns := []string{}
-	if c.patternListFunc != nil {
-		if list, err := c.patternListFunc(); err == nil {
-			patterns = list
-		} else {
-			log.Printf("[MQTT] Could not get pattern list for HA Discovery: %v", err)
-		}
-	}
+	effects, _ := c.effects()
 
 	safeID := strings.ReplaceAll(c.cfg.MQTT.ClientID, " ", "_")
 	// Sanitize ID
@@ -317,8 +373,8 @@ func (c *Client) PublishHADiscovery() {
 
 		// effects
 		"effect_command_topic": fmt.Sprintf("%s/pattern/run", c.prefix),
-		"effect_state_topic":   fmt.Sprintf("%s/pattern/state", c.prefix),
-		"effect_list":          patterns,
+		"effect_state_topic":   fmt.Sprintf("%s/pattern/effect", c.prefix),
+		"effect_list":          effects,
 
 		// availability
 		"availability_mode": "all",
@@ -347,7 +403,7 @@ func (c *Client) PublishHADiscovery() {
 
 	jsonPayload, _ := json.Marshal(payload)
 	c.client.Publish(discoveryTopic, 0, true, jsonPayload)
-	log.Printf("[MQTT] HA Discovery sent to %s", discoveryTopic)
+	logger.Info("HA discovery sent", "topic", discoveryTopic)
 }
 
 func (c *Client) publishStateSnapshot() {
@@ -368,6 +424,8 @@ func (c *Client) publishStateSnapshot() {
 	} else {
 		c.Publish("pattern/state", st.RunningPattern, true)
 	}
+	playlistName, _ := st.RunningPlaylist["name"].(string)
+	c.Publish("pattern/effect", c.effectName(st.RunningPattern, playlistName), true)
 }
 
 // --- Handlers ---
@@ -443,13 +501,56 @@ func (c *Client) handleColor(client mqtt.Client, msg mqtt.Message) {
 }
 
 // handlePatternRun processes incoming Lua pattern execution commands from MQTT.
+// The payload is a pattern file name, a playlist name, a Home Assistant effect name, or a
+// JSON object {"name": "...", "params": {...}} that may also limit the run with "duration" or
+// "until" and "then". Params and limits are ignored for playlists.
 func (c *Client) handlePatternRun(client mqtt.Client, msg mqtt.Message) {
 	name := string(msg.Payload())
+	var params map[string]interface{}
+	var limit lua.RunLimit
+	if raw := bytes.TrimSpace(msg.Payload()); len(raw) > 0 && raw[0] == '{' {
+		var req struct {
+			Name   string                 `json:"name"`
+			Params map[string]interface{} `json:"params"`
+			lua.RunLimit
+		}
+		if err := json.Unmarshal(raw, &req); err != nil {
+			logger.Warn("Invalid pattern run payload", "topic", msg.Topic(), "err", err)
+			return
+		}
+		name, params, limit = req.Name, req.Params, req.RunLimit
+	}
+	target := c.resolveEffect(name)
+	if target.playlist != "" {
+		c.commandChannel <- core.Command{
+			Type:    core.CmdRunPlaylist,
+			Payload: map[string]interface{}{"name": target.playlist},
+		}
+		return
+	}
+	payload := map[string]interface{}{"name": target.pattern}
+	if params != nil {
+		payload["params"] = params
+	}
+	if limit.Duration != "" {
+		payload["duration"] = limit.Duration
+	}
+	if limit.Until != "" {
+		payload["until"] = limit.Until
+	}
+	if limit.Then != "" {
+		payload["then"] = limit.Then
+	}
 	c.commandChannel <- core.Command{
-		Type: core.CmdRunPattern,
-		Payload: map[string]interface{}{
-			"name": name,
-		},
+		Type:    core.CmdRunPattern,
+		Payload: payload,
+	}
+}
+
+// handlePlaylistSkip returns a handler that moves the running playlist with the given command.
+func (c *Client) handlePlaylistSkip(cmd core.CommandType) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		c.commandChannel <- core.Command{Type: cmd}
 	}
 }
 
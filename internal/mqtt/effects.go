@@ -0,0 +1,80 @@
+package mqtt
+
+// effect is what a Home Assistant effect runs: a pattern file or a playlist.
+type effect struct {
+	pattern  string
+	playlist string
+}
+
+// effects returns the Home Assistant effect names for the available patterns and playlists,
+// patterns first, and a map from each effect name back to what it runs. Effects use the
+// display name; when two share one, the later falls back to its file name, or to the
+// playlist's name with a " (playlist)" suffix.
+func (c *Client) effects() ([]string, map[string]effect) {
+	names := []string{}
+	targets := make(map[string]effect)
+	if c.patternListFunc != nil {
+		patterns, err := c.patternListFunc()
+		if err != nil {
+			logger.Warn("Could not get pattern list", "err", err)
+		}
+		for _, p := range patterns {
+			name := p.Title()
+			if _, taken := targets[name]; taken {
+				name = p.Name
+			}
+			names = append(names, name)
+			targets[name] = effect{pattern: p.Name}
+		}
+	}
+	if c.playlistListFunc != nil {
+		for _, p := range c.playlistListFunc() {
+			name := p.Title(p.Name)
+			if _, taken := targets[name]; taken {
+				name = p.Name + " (playlist)"
+			}
+			names = append(names, name)
+			targets[name] = effect{playlist: p.Name}
+		}
+	}
+	return names, targets
+}
+
+// effectName returns the effect name for a running playlist or, outside one, a pattern file,
+// or "IDLE" when nothing runs.
+func (c *Client) effectName(pattern, playlist string) string {
+	if pattern == "" {
+		return "IDLE"
+	}
+	want, fallback := effect{pattern: pattern}, pattern
+	if playlist != "" {
+		want, fallback = effect{playlist: playlist}, playlist
+	}
+	_, targets := c.effects()
+	for name, target := range targets {
+		if target == want {
+			return name
+		}
+	}
+	return fallback
+}
+
+// resolveEffect maps an effect name, pattern file name or playlist name to what it runs.
+// Unknown names are taken to be pattern files, so the engine reports them.
+func (c *Client) resolveEffect(name string) effect {
+	_, targets := c.effects()
+	for _, target := range targets {
+		if target.pattern == name {
+			return target
+		}
+	}
+	if target, ok := targets[name]; ok {
+		return target
+	}
+	for _, target := range targets {
+		if target.playlist == name {
+			return target
+		}
+	}
+	return effect{pattern: name}
+}
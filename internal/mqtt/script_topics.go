@@ -0,0 +1,76 @@
+package mqtt
+
+import (
+	"strings"
+
+	"bledom-controller/internal/core"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// handleSubscription subscribes or unsubscribes a topic requested by a pattern's on("mqtt", ...)
+// hook. Topics are reference counted, since a pattern may register the same filter more than once.
+func (c *Client) handleSubscription(payload map[string]interface{}) {
+	filter, _ := payload["topic"].(string)
+	subscribe, _ := payload["subscribe"].(bool)
+	if filter == "" {
+		return
+	}
+	if filter == c.prefix || strings.HasPrefix(filter, c.prefix+"/") || strings.HasPrefix(filter, "#") {
+		logger.Warn("Ignoring pattern subscription to a reserved topic", "topic", filter)
+		return
+	}
+
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+	if subscribe {
+		c.scriptTopics[filter]++
+		if c.scriptTopics[filter] == 1 && c.client.IsConnected() {
+			c.subscribeScriptTopic(c.client, filter)
+		}
+		return
+	}
+
+	if c.scriptTopics[filter] == 0 {
+		return
+	}
+	c.scriptTopics[filter]--
+	if c.scriptTopics[filter] > 0 {
+		return
+	}
+	delete(c.scriptTopics, filter)
+	if c.client.IsConnected() {
+		if token := c.client.Unsubscribe(filter); token.Wait() && token.Error() != nil {
+			logger.Warn("Unsubscribe failed", "topic", filter, "err", token.Error())
+		} else {
+			logger.Debug("Unsubscribed", "topic", filter)
+		}
+	}
+}
+
+// resubscribeScriptTopics restores the pattern subscriptions after a (re)connect.
+func (c *Client) resubscribeScriptTopics(client mqtt.Client) {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+	for filter := range c.scriptTopics {
+		c.subscribeScriptTopic(client, filter)
+	}
+}
+
+func (c *Client) subscribeScriptTopic(client mqtt.Client, filter string) {
+	handler := func(client mqtt.Client, msg mqtt.Message) {
+		c.eventBus.Publish(core.Event{
+			Type: core.MQTTMessageEvent,
+			Payload: map[string]interface{}{
+				"filter":  filter,
+				"topic":   msg.Topic(),
+				"payload": string(msg.Payload()),
+			},
+		})
+	}
+	if token := client.Subscribe(filter, 0, handler); token.Wait() && token.Error() != nil {
+		logger.Error("Subscribe failed", "topic", filter, "err", token.Error())
+	} else {
+		logger.Debug("Subscribed", "topic", filter)
+	}
+}
@@ -0,0 +1,146 @@
+package patterntest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bledom-controller/internal/config"
+)
+
+// patternsDir holds the bundled patterns and their golden timelines.
+const patternsDir = "../../patterns"
+
+func luaConfig(t *testing.T) config.LuaConfig {
+	t.Helper()
+	cfg, err := config.Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Lua
+}
+
+// TestBundledPatterns checks every bundled pattern against its golden timelines.
+func TestBundledPatterns(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if code := Main([]string{"test"}, patternsDir, luaConfig(t), &out, &errOut); code != 0 {
+		t.Fatalf("pattern test exited with %d:\n%s%s", code, out.String(), errOut.String())
+	}
+}
+
+// writePattern writes a pattern and, if golden is not empty, its golden file into a new directory.
+func writePattern(t *testing.T, name, code, golden string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if golden != "" {
+		testdata := filepath.Join(dir, TestDataDir)
+		if err := os.MkdirAll(testdata, 0755); err != nil {
+			t.Fatal(err)
+		}
+		base := strings.TrimSuffix(name, ".lua")
+		if err := os.WriteFile(filepath.Join(testdata, base+".golden"), []byte(golden), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const blinkCode = `
+set_color(255, 0, 0)
+sleep(500)
+set_color(0, 0, 0)
+sleep(500)
+`
+
+func TestMainReportsDifference(t *testing.T) {
+	golden := "# duration: 1s\n   0.000s  color #ff0000\n   0.500s  color #00ff00\n   1.000s  returned\n"
+	dir := writePattern(t, "blink.lua", blinkCode, golden)
+	var out bytes.Buffer
+	if code := Main([]string{"test", "-dir", dir}, "", luaConfig(t), &out, &out); code != 1 {
+		t.Fatalf("exit code %d, want 1:\n%s", code, out.String())
+	}
+	for _, want := range []string{"differs at timeline line 2", "want:    0.500s  color #00ff00", "got:     0.500s  color #000000", "FAIL: 1 of 1 cases"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestMainUpdateCreatesGolden(t *testing.T) {
+	dir := writePattern(t, "blink.lua", blinkCode, "")
+	cfg := luaConfig(t)
+	var out bytes.Buffer
+	if code := Main([]string{"test", "-dir", dir, "blink.lua"}, "", cfg, &out, &out); code != 1 {
+		t.Fatalf("without a golden file: exit code %d, want 1:\n%s", code, out.String())
+	}
+	out.Reset()
+	if code := Main([]string{"test", "-update", "-dir", dir, "blink.lua"}, "", cfg, &out, &out); code != 0 {
+		t.Fatalf("-update: exit code %d:\n%s", code, out.String())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, TestDataDir, "blink.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "# duration: 5s\n") || !strings.HasSuffix(string(data), "   1.000s  returned\n") {
+		t.Errorf("golden file:\n%s", data)
+	}
+	out.Reset()
+	if code := Main([]string{"test", "-dir", dir}, "", cfg, &out, &out); code != 0 {
+		t.Fatalf("against the new golden file: exit code %d:\n%s", code, out.String())
+	}
+}
+
+func TestReadGoldenHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "police.fast.golden")
+	golden := `# Double speed.
+# duration: 2s
+# param: speed=2
+# seed: 9
+# start: 2026-01-01T21:00:00Z
+# event: 1.5s mqtt home/doorbell ring twice
+   0.000s  power on
+`
+	if err := os.WriteFile(path, []byte(golden), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := readGolden(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := g.run
+	if run.Pattern != "police.lua" || run.Duration.String() != "2s" || run.Seed != 9 || run.Start.Hour() != 21 {
+		t.Errorf("run settings: %+v", run)
+	}
+	if run.Params["speed"] != "2" {
+		t.Errorf("params: %v", run.Params)
+	}
+	if len(run.Events) != 1 || run.Events[0].Topic != "home/doorbell" || run.Events[0].Value != "ring twice" {
+		t.Errorf("events: %+v", run.Events)
+	}
+	if len(g.timeline) != 1 || len(g.header) != 6 {
+		t.Errorf("timeline %q, header %q", g.timeline, g.header)
+	}
+}
+
+func TestReadGoldenRejectsBadHeaders(t *testing.T) {
+	for _, golden := range []string{
+		"# duration: forever\n",
+		"# param: speed\n",
+		"# start: tomorrow\n",
+		"# event: 1s mqtt\n",
+		"   0.000s  power on\n# duration: 1s\n",
+	} {
+		path := filepath.Join(t.TempDir(), "x.golden")
+		if err := os.WriteFile(path, []byte(golden), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readGolden(path); err == nil {
+			t.Errorf("readGolden accepted %q", golden)
+		}
+	}
+}
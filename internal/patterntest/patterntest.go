@@ -0,0 +1,295 @@
+// Package patterntest checks patterns against golden timelines recorded by headless runs.
+//
+// A golden file lives in the testdata directory next to the patterns, named after the pattern
+// ("police.golden" for police.lua) or a case of it ("police.fast.golden"). Its header sets up
+// the run with "# key: value" lines; other "#" lines are comments:
+//
+//	# Double speed, checked for two seconds.
+//	# duration: 2s
+//	# param: speed=2
+//	# seed: 1
+//	# start: 2026-01-01T21:00:00Z
+//	# event: 1.5s mqtt home/doorbell ring
+//
+// The rest of the file is the expected timeline (see lua.RunHeadless).
+package patterntest
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"bledom-controller/internal/config"
+	"bledom-controller/internal/lua"
+)
+
+// TestDataDir is the directory under the patterns directory that holds golden files.
+const TestDataDir = "testdata"
+
+// Defaults for runs whose golden file does not set them.
+const (
+	defaultDuration = 5 * time.Second
+	defaultSeed     = 1
+)
+
+// defaultStart is the virtual time at which runs start unless a golden file sets one.
+var defaultStart = time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// golden is a parsed golden file.
+type golden struct {
+	path     string
+	header   []string
+	run      lua.TestRun
+	timeline []string
+}
+
+// Main runs "pattern test [-update] [name.lua ...]" and returns the exit code: 0 when every
+// case passes, 1 when one fails, 2 on a usage error. Without names, every pattern with a
+// golden file is checked. With -update, golden timelines are rewritten from the current
+// output, and named patterns without one get a golden file with the default settings.
+func Main(args []string, patternsDir string, luaCfg config.LuaConfig, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintln(stderr, "usage: bledom-controller pattern test [-update] [-dir patterns] [name.lua ...]")
+		return 2
+	}
+	fs := flag.NewFlagSet("pattern test", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	update := fs.Bool("update", false, "rewrite golden timelines from the current output")
+	dir := fs.String("dir", patternsDir, "patterns directory")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	paths, err := goldenFiles(*dir, fs.Args(), *update)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if len(paths) == 0 {
+		fmt.Fprintf(stderr, "no golden files in %s\n", filepath.Join(*dir, TestDataDir))
+		return 1
+	}
+
+	failed := 0
+	for _, path := range paths {
+		if !check(path, *dir, luaCfg, *update, stdout) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(stdout, "FAIL: %d of %d cases\n", failed, len(paths))
+		return 1
+	}
+	fmt.Fprintf(stdout, "ok: %d cases\n", len(paths))
+	return 0
+}
+
+// goldenFiles returns the golden files of the named patterns, or all of them. With create,
+// a named pattern without one gets a new golden file path.
+func goldenFiles(dir string, names []string, create bool) ([]string, error) {
+	testdata := filepath.Join(dir, TestDataDir)
+	if len(names) == 0 {
+		paths, err := filepath.Glob(filepath.Join(testdata, "*.golden"))
+		sort.Strings(paths)
+		return paths, err
+	}
+	var paths []string
+	for _, name := range names {
+		base := strings.TrimSuffix(filepath.Base(name), ".lua")
+		cases, err := filepath.Glob(filepath.Join(testdata, base+".*golden"))
+		if err != nil {
+			return nil, err
+		}
+		cases = filterCases(cases, base)
+		if len(cases) == 0 {
+			if !create {
+				return nil, fmt.Errorf("%s: no golden file in %s (run with -update to create one)", name, testdata)
+			}
+			cases = []string{filepath.Join(testdata, base+".golden")}
+		}
+		sort.Strings(cases)
+		paths = append(paths, cases...)
+	}
+	return paths, nil
+}
+
+// filterCases keeps base.golden and base.<case>.golden.
+func filterCases(paths []string, base string) []string {
+	var out []string
+	for _, p := range paths {
+		name := filepath.Base(p)
+		if name == base+".golden" || strings.HasPrefix(name, base+".") && strings.HasSuffix(name, ".golden") {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// patternName returns the pattern a golden file belongs to: "police.fast.golden" -> police.lua.
+func patternName(path string) string {
+	name, _, _ := strings.Cut(filepath.Base(path), ".")
+	return name + ".lua"
+}
+
+// check runs one case and reports the result. With update, the golden file is rewritten.
+func check(path, dir string, luaCfg config.LuaConfig, update bool, out io.Writer) bool {
+	g, err := readGolden(path)
+	if os.IsNotExist(err) && update {
+		g = &golden{path: path, header: []string{"# Default parameters.", "# duration: " + defaultDuration.String()}}
+		g.run = lua.TestRun{Pattern: patternName(path), Duration: defaultDuration, Start: defaultStart, Seed: defaultSeed}
+	} else if err != nil {
+		fmt.Fprintf(out, "FAIL %s: %v\n", path, err)
+		return false
+	}
+
+	got, err := lua.RunHeadless(dir, luaCfg, g.run)
+	if err != nil {
+		fmt.Fprintf(out, "FAIL %s: %v\n", path, err)
+		return false
+	}
+
+	if update {
+		g.timeline = got
+		if err := g.write(); err != nil {
+			fmt.Fprintf(out, "FAIL %s: %v\n", path, err)
+			return false
+		}
+		fmt.Fprintf(out, "updated %s (%d lines)\n", path, len(got))
+		return true
+	}
+
+	if line, want, have, ok := compare(g.timeline, got); !ok {
+		fmt.Fprintf(out, "FAIL %s: differs at timeline line %d\n", path, line)
+		fmt.Fprintf(out, "    want: %s\n", want)
+		fmt.Fprintf(out, "    got:  %s\n", have)
+		return false
+	}
+	fmt.Fprintf(out, "ok   %s\n", path)
+	return true
+}
+
+// compare returns the first line (counted in the timeline) where want and got differ.
+func compare(want, got []string) (int, string, string, bool) {
+	for i := 0; i < len(want) || i < len(got); i++ {
+		w, g := "(end of timeline)", "(end of timeline)"
+		if i < len(want) {
+			w = want[i]
+		}
+		if i < len(got) {
+			g = got[i]
+		}
+		if w != g {
+			return i + 1, w, g, false
+		}
+	}
+	return 0, "", "", true
+}
+
+func readGolden(path string) (*golden, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g := &golden{
+		path: path,
+		run:  lua.TestRun{Pattern: patternName(path), Duration: defaultDuration, Start: defaultStart, Seed: defaultSeed},
+	}
+	for i, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		line = strings.TrimRight(line, " \t")
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			if len(g.timeline) > 0 {
+				return nil, fmt.Errorf("line %d: header lines must come before the timeline", i+1)
+			}
+			g.header = append(g.header, line)
+			if err := g.setOption(strings.TrimSpace(strings.TrimPrefix(line, "#"))); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		default:
+			g.timeline = append(g.timeline, line)
+		}
+	}
+	return g, nil
+}
+
+// setOption applies a "key: value" header line; other text is a comment.
+func (g *golden) setOption(text string) error {
+	key, value, ok := strings.Cut(text, ":")
+	if !ok {
+		return nil
+	}
+	value = strings.TrimSpace(value)
+	switch key {
+	case "duration":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		g.run.Duration = d
+	case "param":
+		name, v, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("param: want name=value, got %q", value)
+		}
+		if g.run.Params == nil {
+			g.run.Params = make(map[string]interface{})
+		}
+		g.run.Params[name] = v
+	case "seed":
+		var seed int64
+		if _, err := fmt.Sscan(value, &seed); err != nil {
+			return fmt.Errorf("invalid seed %q", value)
+		}
+		g.run.Seed = seed
+	case "start":
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("start: want an RFC 3339 time, got %q", value)
+		}
+		g.run.Start = t
+	case "event":
+		ev, err := parseEvent(value)
+		if err != nil {
+			return err
+		}
+		g.run.Events = append(g.run.Events, ev)
+	}
+	return nil
+}
+
+// parseEvent parses "<time> <event> <value>", or "<time> mqtt <topic> <payload>".
+func parseEvent(s string) (lua.TestEvent, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return lua.TestEvent{}, fmt.Errorf("event: want <time> <event> <value>, got %q", s)
+	}
+	at, err := time.ParseDuration(fields[0])
+	if err != nil || at < 0 {
+		return lua.TestEvent{}, fmt.Errorf("event: invalid time %q", fields[0])
+	}
+	ev := lua.TestEvent{At: at, Event: fields[1], Value: strings.Join(fields[2:], " ")}
+	if ev.Event == "mqtt" {
+		ev.Topic, ev.Value = fields[2], strings.Join(fields[3:], " ")
+	}
+	return ev, nil
+}
+
+func (g *golden) write() error {
+	if err := os.MkdirAll(filepath.Dir(g.path), 0755); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, line := range g.header {
+		b.WriteString(line + "\n")
+	}
+	for _, line := range g.timeline {
+		b.WriteString(line + "\n")
+	}
+	return os.WriteFile(g.path, []byte(b.String()), 0644)
+}
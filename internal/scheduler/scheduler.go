@@ -2,17 +2,20 @@ package scheduler
 
 import (
 	"encoding/json"
-	"log"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"bledom-controller/internal/core"
+	"bledom-controller/internal/logging"
+	"bledom-controller/internal/metrics"
 
 	"github.com/robfig/cron/v3"
 )
 
+var logger = logging.Logger("scheduler")
+
 // ScheduleEntry defines the structure for a saved schedule.
 type ScheduleEntry struct {
 	Spec    string `json:"spec"`
@@ -45,6 +48,7 @@ type Scheduler struct {
 	mu             sync.RWMutex
 	schedulesFile  string
 	onChange       func()
+	running        bool
 }
 
 // NewScheduler creates and loads a scheduler.
@@ -67,13 +71,26 @@ func (s *Scheduler) SetOnChange(fn func()) {
 // Start begins the cron job ticker.
 func (s *Scheduler) Start() {
 	s.cron.Start()
-	log.Println("Cron scheduler started.")
+	s.mu.Lock()
+	s.running = true
+	s.mu.Unlock()
+	logger.Info("Cron scheduler started")
 }
 
 // Stop halts the cron job ticker.
 func (s *Scheduler) Stop() {
 	s.cron.Stop()
-	log.Println("Cron scheduler stopped.")
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+	logger.Info("Cron scheduler stopped")
+}
+
+// Running reports whether the cron ticker has been started and not stopped.
+func (s *Scheduler) Running() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.running
 }
 
 // Add creates a new cron job.
@@ -83,12 +100,12 @@ func (s *Scheduler) Add(spec, command string) {
 	id, err := s.addJobLocked(entry)
 	if err != nil {
 		s.mu.Unlock()
-		log.Printf("Error adding schedule '%s' '%s': %v", spec, command, err)
+		logger.Error("Failed to add schedule", "spec", spec, "command", command, "err", err)
 		return
 	}
 	s.save()
 	s.mu.Unlock()
-	log.Printf("Added schedule (ID %d): %s -> %s", id, spec, command)
+	logger.Info("Added schedule", "id", id, "spec", spec, "command", command)
 	s.notifyChange()
 }
 
@@ -101,7 +118,7 @@ func (s *Scheduler) Remove(id int) {
 	delete(s.store, entryID)
 	s.save()
 	s.mu.Unlock()
-	log.Printf("Removed schedule (ID %d)", id)
+	logger.Info("Removed schedule", "id", id)
 	s.notifyChange()
 }
 
@@ -113,7 +130,7 @@ func (s *Scheduler) Update(id int, spec, command string) {
 	entry, ok := s.store[entryID]
 	if !ok {
 		s.mu.Unlock()
-		log.Printf("Schedule (ID %d) not found for update.", id)
+		logger.Warn("Schedule not found for update", "id", id)
 		return
 	}
 
@@ -127,7 +144,7 @@ func (s *Scheduler) Update(id int, spec, command string) {
 	newID, err := s.addJobLocked(newEntry)
 	if err != nil {
 		s.mu.Unlock()
-		log.Printf("Error updating schedule '%s' '%s': %v", spec, command, err)
+		logger.Error("Failed to update schedule", "spec", spec, "command", command, "err", err)
 		return
 	}
 
@@ -136,7 +153,7 @@ func (s *Scheduler) Update(id int, spec, command string) {
 	s.save()
 	s.mu.Unlock()
 
-	log.Printf("Updated schedule (ID %d -> %d): %s -> %s", id, newID, spec, command)
+	logger.Info("Updated schedule", "id", id, "new_id", newID, "spec", spec, "command", command)
 	s.notifyChange()
 }
 
@@ -147,14 +164,14 @@ func (s *Scheduler) SetEnabled(id int, enabled bool) {
 	entry, ok := s.store[entryID]
 	if !ok {
 		s.mu.Unlock()
-		log.Printf("Schedule (ID %d) not found for enable toggle.", id)
+		logger.Warn("Schedule not found for enable toggle", "id", id)
 		return
 	}
 	entry.Enabled = enabled
 	s.store[entryID] = entry
 	s.save()
 	s.mu.Unlock()
-	log.Printf("Set schedule (ID %d) enabled=%v", id, enabled)
+	logger.Info("Set schedule enabled", "id", id, "enabled", enabled)
 	s.notifyChange()
 }
 
@@ -174,7 +191,7 @@ func (s *Scheduler) SetAllEnabled(enabled bool) {
 	}
 	s.mu.Unlock()
 	if changed {
-		log.Printf("Set all schedules enabled=%v", enabled)
+		logger.Info("Set all schedules enabled", "enabled", enabled)
 		s.notifyChange()
 	}
 }
@@ -186,7 +203,7 @@ func (s *Scheduler) RunNow(id int) {
 	entry, ok := s.store[entryID]
 	s.mu.RUnlock()
 	if !ok {
-		log.Printf("Schedule (ID %d) not found for run now.", id)
+		logger.Warn("Schedule not found for run now", "id", id)
 		return
 	}
 	s.execute(entryID, entry.Command, true)
@@ -221,6 +238,7 @@ func (s *Scheduler) execute(id cron.EntryID, command string, force bool) {
 		entry, ok := s.store[id]
 		s.mu.RUnlock()
 		if !ok || !entry.Enabled {
+			metrics.SchedulerExecutions.WithLabelValues("skipped_disabled").Inc()
 			return
 		}
 	}
@@ -235,26 +253,63 @@ func (s *Scheduler) execute(id cron.EntryID, command string, force bool) {
 	s.mu.Unlock()
 	s.notifyChange()
 
-	log.Printf("Executing scheduled command: %s", command)
+	logger.Info("Executing scheduled command", "command", command)
 	parts := strings.Fields(command)
 	if len(parts) == 0 {
+		metrics.SchedulerExecutions.WithLabelValues("invalid").Inc()
 		return
 	}
 	switch parts[0] {
 	case "power":
+		metrics.SchedulerExecutions.WithLabelValues("dispatched").Inc()
 		if len(parts) > 1 && parts[1] == "on" {
 			s.commandChannel <- core.Command{Type: core.CmdSetPower, Payload: map[string]interface{}{"isOn": true}}
 		} else {
 			s.commandChannel <- core.Command{Type: core.CmdSetPower, Payload: map[string]interface{}{"isOn": false}}
 		}
 	case "pattern":
-		if len(parts) > 1 {
-			s.commandChannel <- core.Command{Type: core.CmdRunPattern, Payload: map[string]interface{}{"name": parts[1]}}
+		if len(parts) < 2 {
+			metrics.SchedulerExecutions.WithLabelValues("invalid").Inc()
+			return
+		}
+		// Remaining fields are parameter values: "pattern police.lua speed=2 color=#ff0000",
+		// except for=, until= and then=, which limit the run: "pattern police.lua for=30m then=off".
+		// Those are Lua keywords, so no pattern reads a parameter by that name.
+		params := make(map[string]interface{}, len(parts)-2)
+		payload := map[string]interface{}{"name": parts[1], "params": params}
+		for _, kv := range parts[2:] {
+			key, value, ok := strings.Cut(kv, "=")
+			if !ok || key == "" {
+				metrics.SchedulerExecutions.WithLabelValues("invalid").Inc()
+				logger.Warn("Invalid pattern parameter in schedule", "command", command, "param", kv)
+				return
+			}
+			switch key {
+			case "for":
+				payload["duration"] = value
+			case "until", "then":
+				payload[key] = value
+			default:
+				params[key] = value
+			}
+		}
+		metrics.SchedulerExecutions.WithLabelValues("dispatched").Inc()
+		s.commandChannel <- core.Command{Type: core.CmdRunPattern, Payload: payload}
+	case "playlist":
+		if len(parts) != 2 {
+			metrics.SchedulerExecutions.WithLabelValues("invalid").Inc()
+			return
 		}
+		metrics.SchedulerExecutions.WithLabelValues("dispatched").Inc()
+		s.commandChannel <- core.Command{Type: core.CmdRunPlaylist, Payload: map[string]interface{}{"name": parts[1]}}
 	case "lua":
 		// LUA dynamic execute disabled in schedule to pure command struct mappings.
 		// It could be re-implemented similarly if there's a CmdExecuteLua type.
-		log.Printf("Lua dynamic code from schedule is deprecated via pure commands: %s", command)
+		metrics.SchedulerExecutions.WithLabelValues("unsupported").Inc()
+		logger.Warn("Lua code in schedules is no longer supported", "command", command)
+	default:
+		metrics.SchedulerExecutions.WithLabelValues("invalid").Inc()
+		logger.Warn("Unknown scheduled command", "command", command)
 	}
 }
 
@@ -271,7 +326,7 @@ func (s *Scheduler) save() {
 	}
 	data, err := json.MarshalIndent(fileStore, "", "  ")
 	if err != nil {
-		log.Printf("Error marshalling schedules: %v", err)
+		logger.Error("Failed to marshal schedules", "err", err)
 		return
 	}
 	os.WriteFile(s.schedulesFile, data, 0644)
@@ -286,17 +341,17 @@ func (s *Scheduler) load() {
 	}
 	data, err := os.ReadFile(s.schedulesFile)
 	if err != nil {
-		log.Printf("Error reading schedule file: %v", err)
+		logger.Error("Failed to read schedule file", "file", s.schedulesFile, "err", err)
 		return
 	}
 
 	tempStore := make(map[cron.EntryID]scheduleFileEntry)
 	if err := json.Unmarshal(data, &tempStore); err != nil {
-		log.Printf("Error unmarshalling schedule file: %v", err)
+		logger.Error("Failed to parse schedule file", "file", s.schedulesFile, "err", err)
 		return
 	}
 
-	log.Printf("Loading %d schedules from file '%s'...", len(tempStore), s.schedulesFile)
+	logger.Info("Loading schedules", "count", len(tempStore), "file", s.schedulesFile)
 	for _, entry := range tempStore {
 		jobEntry := entry
 		enabled := true
@@ -310,7 +365,7 @@ func (s *Scheduler) load() {
 			LastRun: jobEntry.LastRun,
 		}
 		if _, err := s.addJobLocked(storeEntry); err != nil {
-			log.Printf("Error re-adding schedule from file: %v", err)
+			logger.Error("Failed to restore schedule from file", "spec", jobEntry.Spec, "err", err)
 			continue
 		}
 	}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"bledom-controller/internal/lua"
+)
+
+// handleExportPatterns sends patterns as a bundle for download.
+//
+// Query parameters:
+//   - name: a pattern to export, repeatable (default: all patterns)
+//   - format: "zip" (default) or "tar.gz"
+func (s *Server) handleExportPatterns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = lua.BundleZip
+	}
+	names := r.URL.Query()["name"]
+
+	var buf bytes.Buffer
+	manifest, err := s.luaEngine.ExportPatterns(&buf, names, format)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, fs.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	filename := "patterns-" + manifest.Created.Format("20060102-150405")
+	if len(names) == 1 {
+		filename = strings.TrimSuffix(manifest.Files[0].Name, ".lua")
+	}
+	contentType := "application/zip"
+	if format == lua.BundleTarGz {
+		contentType = "application/gzip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+"."+format))
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(buf.Bytes())
+	logger.Info("Exported patterns", "files", len(manifest.Files), "format", format)
+}
+
+// handleImportPatterns imports a bundle sent as the request body and replies with what
+// happened to each file: 200 when imported, 409 when files conflict and nothing was written,
+// 400 when the bundle is invalid.
+//
+// Query parameters:
+//   - on_conflict: "skip", "overwrite" or "rename" (default: report conflicts, import nothing)
+//   - author: recorded in the pattern history (default: the client's address)
+func (s *Server) handleImportPatterns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !s.isAllowedOrigin(origin) {
+		logger.Warn("Pattern import blocked: origin not in allowed list", "origin", origin)
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, lua.MaxBundleSize))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("bundle larger than %d MiB", lua.MaxBundleSize>>20)})
+		return
+	}
+
+	q := r.URL.Query()
+	author := q.Get("author")
+	if author == "" {
+		author = remoteHost(r.RemoteAddr)
+	}
+	result, err := s.luaEngine.ImportPatterns(data, q.Get("on_conflict"), author)
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, lua.ErrImportConflict):
+		status = http.StatusConflict
+	case errors.Is(err, lua.ErrInvalidBundle):
+		status = http.StatusBadRequest
+	case err != nil && result == nil:
+		status = http.StatusBadRequest
+	case err != nil:
+		status = http.StatusInternalServerError
+	}
+	if err != nil {
+		logger.Warn("Pattern import failed", "err", err)
+	} else {
+		// Do not wait for the patterns watcher, which may be off or slow to notice.
+		s.broadcastPatternLists()
+	}
+
+	body := map[string]interface{}{"files": []lua.ImportedFile{}}
+	if result != nil {
+		body["files"] = result.Files
+	}
+	if err != nil {
+		body["error"] = err.Error()
+	}
+	writeJSON(w, status, body)
+}
+
+// broadcastPatternLists sends the runnable patterns, the library modules and the deleted
+// patterns to all clients.
+func (s *Server) broadcastPatternLists() {
+	if patterns, err := s.luaEngine.GetPatternList(); err == nil {
+		s.Hub.Broadcast(NewMessage("pattern_list", patterns))
+	}
+	if modules, err := s.luaEngine.GetLibraryList(); err == nil {
+		s.Hub.Broadcast(NewMessage("library_list", modules))
+	}
+	if deleted, err := s.luaEngine.DeletedPatterns(); err == nil {
+		s.Hub.Broadcast(NewMessage("deleted_patterns", deleted))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"bledom-controller/internal/core"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is the time allowed to write a single message to the peer.
+	writeWait = 10 * time.Second
+	// pongWait is the time allowed to read the next pong message from the peer.
+	pongWait = 60 * time.Second
+	// pingPeriod is how often pings are sent; it must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+	// maxMessageSize bounds incoming messages (pattern source code is the largest payload).
+	maxMessageSize = 1 << 20
+	// clientSendQueueSize is the number of outgoing messages buffered per client before eviction.
+	clientSendQueueSize = 64
+)
+
+// subscribeCommand is the client message type used to select topics; it is handled by the server, not the orchestrator.
+const subscribeCommand = "subscribe"
+
+// client is a single WebSocket connection with its own outgoing message queue.
+type client struct {
+	conn *websocket.Conn
+	send chan Message
+
+	topicsMu sync.RWMutex
+	topics   topicSet
+}
+
+func newClient(conn *websocket.Conn, topics topicSet) *client {
+	return &client{
+		conn:   conn,
+		send:   make(chan Message, clientSendQueueSize),
+		topics: topics,
+	}
+}
+
+// wants reports whether the client is subscribed to messages of msgType.
+func (c *client) wants(msgType string) bool {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+	return c.topics.allows(msgType)
+}
+
+// setTopics replaces the client's subscriptions and returns the topics that were newly added.
+func (c *client) setTopics(topics topicSet) topicSet {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+	added := topicSet{}
+	for t := range topics {
+		if !c.topics[t] {
+			added[t] = true
+		}
+	}
+	c.topics = topics
+	return added
+}
+
+// writePump drains the send queue to the connection and keeps it alive with pings.
+// It is the only goroutine that writes to the connection.
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the queue (disconnect or eviction).
+				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteJSON(message); err != nil {
+				logger.Warn("WebSocket write failed", "remote", c.conn.RemoteAddr().String(), "err", err)
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readPump reads commands from the connection and forwards them to the orchestrator until the connection fails.
+// Subscribe messages are passed to onSubscribe with the requested topic names; replies to a
+// command go through reply.
+func (c *client) readPump(commandChannel core.CommandChannel, onSubscribe func(topics []string), reply func(Message)) {
+	c.conn.SetReadLimit(maxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		// Read incoming message from client
+		_, msgBytes, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var rawCmd incomingCommand
+		if err := json.Unmarshal(msgBytes, &rawCmd); err != nil {
+			logger.Warn("Invalid client command", "remote", c.conn.RemoteAddr().String(), "err", err)
+			continue
+		}
+
+		if rawCmd.Type == subscribeCommand {
+			onSubscribe(payloadStrings(rawCmd.Payload, "topics"))
+			continue
+		}
+
+		// Wrap as internal command and send to orchestrator
+		cmd := core.Command{
+			Type:    core.CommandType(rawCmd.Type),
+			Payload: rawCmd.Payload,
+			Source:  remoteHost(c.conn.RemoteAddr().String()),
+			Reply: func(msgType string, payload interface{}) {
+				reply(NewMessage(msgType, payload))
+			},
+		}
+
+		if commandChannel != nil {
+			commandChannel <- cmd
+		}
+	}
+}
+
+// payloadStrings extracts a list of strings from a JSON array field in a command payload.
+func payloadStrings(payload map[string]interface{}, key string) []string {
+	raw, ok := payload[key].([]interface{})
+	if !ok {
+		return nil
+	}
+	out := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if str, ok := v.(string); ok {
+			out = append(out, str)
+		}
+	}
+	return out
+}
+
+// remoteHost returns the host of a remote address, without the port that changes with every
+// connection.
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
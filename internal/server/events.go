@@ -0,0 +1,95 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// eventHistorySize bounds the number of broadcast messages kept for SSE resumption.
+const eventHistorySize = 256
+
+// streamEvent is a broadcast message tagged with a monotonically increasing ID.
+type streamEvent struct {
+	ID      uint64
+	Message Message
+}
+
+// eventStream records broadcast messages in a bounded history and fans them out to stream subscribers.
+type eventStream struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []streamEvent
+	subscribers map[chan streamEvent]struct{}
+}
+
+// newEventStream creates an empty eventStream. IDs start at the current time in microseconds,
+// so an ID a client kept from before a restart is older than the history and gets a snapshot.
+func newEventStream() *eventStream {
+	return &eventStream{
+		nextID:      uint64(time.Now().UnixMicro()),
+		history:     make([]streamEvent, 0, eventHistorySize),
+		subscribers: make(map[chan streamEvent]struct{}),
+	}
+}
+
+// publish appends a message to the history and delivers it to all subscribers without blocking.
+func (es *eventStream) publish(msg Message) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	ev := streamEvent{ID: es.nextID, Message: msg}
+	es.nextID++
+
+	if len(es.history) == eventHistorySize {
+		copy(es.history, es.history[1:])
+		es.history = es.history[:eventHistorySize-1]
+	}
+	es.history = append(es.history, ev)
+
+	for ch := range es.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Slow stream consumer. Rather than block the hub or leave a gap nobody notices,
+			// close its stream; the client reconnects and replays from its last event ID.
+			logger.Warn("SSE subscriber too slow, closing its stream", "event", ev.ID)
+			delete(es.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe registers a new subscriber and returns the events recorded after lastID. The
+// replay and the registration happen atomically so no event is missed or duplicated. When the
+// events after lastID cannot be replayed, resync is true and the subscriber needs a snapshot of
+// the current state instead: for a new client (lastID 0), when the history no longer reaches
+// back to lastID, or when lastID is from before a server restart reset the IDs. The channel is
+// closed if the subscriber falls too far behind.
+func (es *eventStream) subscribe(lastID uint64) (ch chan streamEvent, replay []streamEvent, resync bool) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	ch = make(chan streamEvent, 64)
+	es.subscribers[ch] = struct{}{}
+
+	oldest := es.nextID
+	if len(es.history) > 0 {
+		oldest = es.history[0].ID
+	}
+	if lastID == 0 || lastID >= es.nextID || lastID+1 < oldest {
+		return ch, nil, true
+	}
+	for _, ev := range es.history {
+		if ev.ID > lastID {
+			replay = append(replay, ev)
+		}
+	}
+	return ch, replay, false
+}
+
+// unsubscribe removes a subscriber, unless publish already closed it.
+func (es *eventStream) unsubscribe(ch chan streamEvent) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	delete(es.subscribers, ch)
+}
@@ -0,0 +1,62 @@
+package server
+
+import "testing"
+
+func publishN(es *eventStream, n int) {
+	for i := 0; i < n; i++ {
+		es.publish(NewMessage("test", i))
+	}
+}
+
+func TestEventStreamReplay(t *testing.T) {
+	es := newEventStream()
+	first := es.nextID
+	publishN(es, 10)
+
+	_, replay, resync := es.subscribe(first + 6)
+	if resync || len(replay) != 3 || replay[0].ID != first+7 {
+		t.Fatalf("replay %v, resync %v; want events %d-%d", replay, resync, first+7, first+9)
+	}
+	if _, replay, resync := es.subscribe(first + 9); resync || len(replay) != 0 {
+		t.Errorf("up-to-date client: replay %v, resync %v", replay, resync)
+	}
+}
+
+func TestEventStreamResync(t *testing.T) {
+	es := newEventStream()
+	first := es.nextID
+	publishN(es, eventHistorySize+10)
+
+	for name, lastID := range map[string]uint64{
+		"new client":         0,
+		"history wrapped":    first + 5,
+		"before a restart":   first - 100,
+		"ID from the future": es.nextID + 5,
+	} {
+		if _, replay, resync := es.subscribe(lastID); !resync || replay != nil {
+			t.Errorf("%s: replay of %d events, resync %v; want a snapshot", name, len(replay), resync)
+		}
+	}
+	// The oldest kept event follows this ID, so nothing is missing.
+	if _, replay, resync := es.subscribe(es.history[0].ID - 1); resync || len(replay) != eventHistorySize {
+		t.Errorf("edge of history: replay of %d events, resync %v", len(replay), resync)
+	}
+}
+
+func TestEventStreamClosesSlowSubscriber(t *testing.T) {
+	es := newEventStream()
+	slow, _, _ := es.subscribe(0)
+	publishN(es, cap(slow)+1)
+
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != cap(slow) {
+		t.Errorf("received %d events before the close, want %d", n, cap(slow))
+	}
+	if _, ok := es.subscribers[slow]; ok {
+		t.Error("closed subscriber still registered")
+	}
+	es.unsubscribe(slow) // must not panic
+}
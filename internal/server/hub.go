@@ -1,28 +1,46 @@
 package server
 
 import (
-	"log"
 	"sync"
 
-	"github.com/gorilla/websocket"
+	"bledom-controller/internal/metrics"
 )
 
 // Hub maintains the set of active clients and broadcasts messages to them.
+//
+// The hub never writes to a connection itself: each client owns a buffered send queue drained by
+// its own writer goroutine, so a stalled client can only fill its own queue and is then evicted.
 type Hub struct {
-	clients    map[*websocket.Conn]bool
+	clients    map[*client]bool
 	mu         sync.Mutex
 	broadcast  chan Message
-	register   chan *websocket.Conn
-	unregister chan *websocket.Conn
+	register   chan *client
+	unregister chan *client
+	direct     chan directMessage
+
+	// events records every broadcast for Server-Sent Events streaming and resumption.
+	events *eventStream
+	// snapshot builds the messages describing the current state, sent to new clients.
+	snapshot func() []Message
+}
+
+// directMessage is a batch of messages addressed to a single client rather than broadcast.
+type directMessage struct {
+	client   *client
+	messages []Message
 }
 
-// NewHub initializes and returns a new Hub instance.
-func NewHub() *Hub {
+// NewHub initializes and returns a new Hub instance. snapshot, if not nil, builds the
+// messages a client receives when it registers.
+func NewHub(snapshot func() []Message) *Hub {
 	return &Hub{
-		clients:    make(map[*websocket.Conn]bool),
-		broadcast:  make(chan Message),
-		register:   make(chan *websocket.Conn),
-		unregister: make(chan *websocket.Conn),
+		clients:    make(map[*client]bool),
+		broadcast:  make(chan Message, 256),
+		register:   make(chan *client),
+		unregister: make(chan *client),
+		direct:     make(chan directMessage, 16),
+		events:     newEventStream(),
+		snapshot:   snapshot,
 	}
 }
 
@@ -30,26 +48,50 @@ func NewHub() *Hub {
 func (h *Hub) Run() {
 	for {
 		select {
-		case client := <-h.register:
+		case c := <-h.register:
+			// Build the snapshot here, between broadcasts: every broadcast handled before it
+			// is reflected in it, and every later one is queued after it.
+			var snapshot []Message
+			if h.snapshot != nil {
+				snapshot = h.snapshot()
+			}
+			h.mu.Lock()
+			h.clients[c] = true
+			for _, msg := range snapshot {
+				if c.wants(msg.Type) && !h.enqueueLocked(c, msg) {
+					break
+				}
+			}
+			metrics.WebSocketClients.Set(float64(len(h.clients)))
+			h.mu.Unlock()
+			logger.Info("WebSocket client connected", "remote", c.conn.RemoteAddr().String(), "clients", len(h.clients))
+		case c := <-h.unregister:
 			h.mu.Lock()
-			h.clients[client] = true
+			if _, ok := h.clients[c]; ok {
+				delete(h.clients, c)
+				close(c.send)
+				metrics.WebSocketClients.Set(float64(len(h.clients)))
+				logger.Info("WebSocket client disconnected", "remote", c.conn.RemoteAddr().String(), "clients", len(h.clients))
+			}
 			h.mu.Unlock()
-			log.Println("[Server] WebSocket client connected.")
-		case client := <-h.unregister:
+		case d := <-h.direct:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				client.Close()
-				log.Println("[Server] WebSocket client disconnected.")
+			if _, ok := h.clients[d.client]; ok {
+				for _, message := range d.messages {
+					if !h.enqueueLocked(d.client, message) {
+						break
+					}
+				}
 			}
 			h.mu.Unlock()
 		case message := <-h.broadcast:
+			if !webSocketOnly(message.Type) {
+				h.events.publish(message)
+			}
 			h.mu.Lock()
-			for client := range h.clients {
-				if err := client.WriteJSON(message); err != nil {
-					log.Printf("[Server] WebSocket broadcast error: %v", err)
-					client.Close()
-					delete(h.clients, client)
+			for c := range h.clients {
+				if c.wants(message.Type) {
+					h.enqueueLocked(c, message)
 				}
 			}
 			h.mu.Unlock()
@@ -57,6 +99,29 @@ func (h *Hub) Run() {
 	}
 }
 
+// enqueueLocked queues a message for a client without blocking, evicting the client if its
+// queue is full. It returns false if the client was evicted. h.mu must be held.
+func (h *Hub) enqueueLocked(c *client, message Message) bool {
+	select {
+	case c.send <- message:
+		return true
+	default:
+		// The client's queue is full: it is not keeping up, so evict it
+		// instead of letting it hold back everyone else.
+		logger.Warn("WebSocket client send queue full, evicting", "remote", c.conn.RemoteAddr().String())
+		delete(h.clients, c)
+		close(c.send)
+		metrics.WebSocketEvictions.Inc()
+		metrics.WebSocketClients.Set(float64(len(h.clients)))
+		return false
+	}
+}
+
+// sendTo queues messages for a single registered client.
+func (h *Hub) sendTo(c *client, messages ...Message) {
+	h.direct <- directMessage{client: c, messages: messages}
+}
+
 // Broadcast enqueues a message for delivery to all connected WebSocket clients.
 func (h *Hub) Broadcast(msg Message) {
 	h.broadcast <- msg
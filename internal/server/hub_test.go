@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testConn returns the server side of a WebSocket connection.
+func testConn(t *testing.T) *websocket.Conn {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	conn := <-conns
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// The hub builds the snapshot when it registers a client, so no broadcast falls between the
+// snapshot and the client's registration.
+func TestHubQueuesSnapshotOnRegister(t *testing.T) {
+	state := "old"
+	h := NewHub(func() []Message {
+		return []Message{NewMessage("device_state", state), NewMessage("log_history", nil)}
+	})
+	go h.Run()
+
+	// A change broadcast before the client registers must be in its snapshot.
+	state = "new"
+	h.Broadcast(NewMessage("device_state", state))
+	topics, _ := parseTopics(defaultTopics)
+	c := newClient(testConn(t), topics)
+	h.register <- c
+	h.Broadcast(NewMessage("color_update", "after"))
+
+	var got []Message
+	for len(got) < 2 {
+		select {
+		case msg := <-c.send:
+			got = append(got, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("received %v, want the snapshot and the later broadcast", got)
+		}
+	}
+	if got[0].Type != "device_state" || got[0].Payload != "new" || got[1].Type != "color_update" {
+		t.Errorf("received %+v, want the current snapshot (without logs) then the broadcast", got)
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import "bledom-controller/internal/logging"
+
+// logHistorySize is the number of recent log entries sent to clients that subscribe to the logs topic.
+const logHistorySize = 200
+
+// forwardLogs broadcasts every new log entry as a "log" message until the server shuts down.
+// Only clients subscribed to the logs topic receive them.
+func (s *Server) forwardLogs() {
+	entries, cancel := logging.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-s.closing:
+			return
+		case entry := <-entries:
+			s.Hub.Broadcast(NewMessage("log", entry))
+		}
+	}
+}
+
+// logHistoryMessage returns the recent log entries as a single "log_history" message.
+func logHistoryMessage() Message {
+	return NewMessage("log_history", logging.Recent(logHistorySize))
+}
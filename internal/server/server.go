@@ -3,20 +3,27 @@ package server
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"strings"
+	"sync"
 
+	"bledom-controller/internal/config"
 	"bledom-controller/internal/core"
+	"bledom-controller/internal/logging"
 	"bledom-controller/internal/lua"
+	"bledom-controller/internal/metrics"
 	"bledom-controller/internal/scheduler"
 
 	"github.com/gorilla/websocket"
 )
 
+var logger = logging.Logger("server")
+
 // ClientConn defines an interface for a WebSocket connection, facilitating testing.
 type ClientConn interface {
 	WriteJSON(v interface{}) error
@@ -30,9 +37,23 @@ type incomingCommand struct {
 
 // Server manages the HTTP and WebSocket endpoints and handles client coordination.
 type Server struct {
-	Hub        *Hub
-	luaEngine  *lua.Engine
-	httpServer *http.Server
+	Hub         *Hub
+	luaEngine   *lua.Engine
+	automations *lua.Automations
+	httpServer  *http.Server
+	mux         *http.ServeMux
+
+	// listenMu guards the listener state reported by Health.
+	listenMu  sync.RWMutex
+	listening bool
+	listenErr error
+
+	// TLS is active when certs is non-nil; redirectServer is the optional HTTP->HTTPS listener.
+	certs          *certReloader
+	redirectServer *http.Server
+
+	// closing is closed on shutdown so long-lived streaming handlers can return.
+	closing chan struct{}
 
 	eventBus       *core.EventBus
 	commandChannel core.CommandChannel
@@ -45,13 +66,10 @@ type Server struct {
 }
 
 // NewServer creates and initializes a new Server instance.
-func NewServer(luaEngine *lua.Engine, eb *core.EventBus, st *core.State, sched *scheduler.Scheduler, cmdChan core.CommandChannel, port string, webFilesDir string, allowedOrigins []string, enablePprof bool) (*Server, error) {
-	hub := NewHub()
-	go hub.Run()
-
+func NewServer(luaEngine *lua.Engine, automations *lua.Automations, eb *core.EventBus, st *core.State, sched *scheduler.Scheduler, cmdChan core.CommandChannel, port string, webFilesDir string, allowedOrigins []string, enablePprof bool, enableMetrics bool, tlsCfg config.TLSConfig) (*Server, error) {
 	s := &Server{
-		Hub:            hub,
 		luaEngine:      luaEngine,
+		automations:    automations,
 		eventBus:       eb,
 		state:          st,
 		scheduler:      sched,
@@ -59,7 +77,10 @@ func NewServer(luaEngine *lua.Engine, eb *core.EventBus, st *core.State, sched *
 
 		webFilesDir:    webFilesDir,
 		allowedOrigins: allowedOrigins,
+		closing:        make(chan struct{}),
 	}
+	s.Hub = NewHub(s.snapshotMessages)
+	go s.Hub.Run()
 
 	// Initialize WebSocket upgrader with standard buffers
 	s.upgrader = websocket.Upgrader{
@@ -67,40 +88,83 @@ func NewServer(luaEngine *lua.Engine, eb *core.EventBus, st *core.State, sched *
 		WriteBufferSize: 512,
 		CheckOrigin: func(r *http.Request) bool {
 			if len(s.allowedOrigins) == 0 {
-				log.Println("[Server] Warning: WebSocket CheckOrigin is disabled (allowing all).")
+				logger.Warn("WebSocket CheckOrigin is disabled (allowing all)")
 				return true
 			}
 			origin := r.Header.Get("Origin")
-			for _, allowed := range s.allowedOrigins {
-				if strings.EqualFold(origin, allowed) {
-					return true
-				}
+			if s.isAllowedOrigin(origin) {
+				return true
 			}
-			log.Printf("[Server] WebSocket connection blocked: Origin '%s' not in allowed list.", origin)
+			logger.Warn("WebSocket connection blocked: origin not in allowed list", "origin", origin)
 			return false
 		},
 	}
 
 	mux := http.NewServeMux()
+	s.mux = mux
 	staticHandler, staticSource, err := newStaticHandler(s.webFilesDir)
 	if err != nil {
 		return nil, err
 	}
 	mux.Handle("/", staticHandler)
 	mux.HandleFunc("/ws", s.handleWebSocket)
+	mux.HandleFunc("/api/v1/events", s.handleEvents)
+	mux.HandleFunc("/api/v1/patterns/export", s.handleExportPatterns)
+	mux.HandleFunc("/api/v1/patterns/import", s.handleImportPatterns)
 	if enablePprof {
 		registerPprof(mux)
-		log.Println("[Server] pprof enabled at /debug/pprof/")
+		logger.Info("pprof enabled", "path", "/debug/pprof/")
+	}
+	if enableMetrics {
+		mux.Handle("/metrics", metrics.Handler())
+		logger.Info("Prometheus metrics enabled", "path", "/metrics")
 	}
 	s.httpServer = &http.Server{Addr: ":" + port, Handler: mux}
-	log.Printf("[Server] Serving web UI from %s", staticSource)
+	s.httpServer.RegisterOnShutdown(func() { close(s.closing) })
+	logger.Info("Serving web UI", "source", staticSource)
+
+	if tlsCfg.Enabled {
+		if tlsCfg.SelfSigned {
+			if err := ensureSelfSignedCert(tlsCfg.CertFile, tlsCfg.KeyFile); err != nil {
+				return nil, fmt.Errorf("self-signed certificate: %w", err)
+			}
+		}
+		certs, err := newCertReloader(tlsCfg.CertFile, tlsCfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+		s.httpServer.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+		logger.Info("TLS enabled", "cert", tlsCfg.CertFile)
+
+		if tlsCfg.RedirectPort != "" {
+			s.redirectServer = &http.Server{Addr: ":" + tlsCfg.RedirectPort, Handler: newRedirectHandler(port)}
+		}
+	}
 
 	// Subscribe to internal events to broadcast them to clients
 	go s.listenEvents()
+	go s.forwardLogs()
 
 	return s, nil
 }
 
+// isAllowedOrigin reports whether origin is in the configured allow list (an empty list allows all).
+func (s *Server) isAllowedOrigin(origin string) bool {
+	if len(s.allowedOrigins) == 0 {
+		return true
+	}
+	for _, allowed := range s.allowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
 func registerPprof(mux *http.ServeMux) {
 	mux.HandleFunc("/debug/pprof/", pprof.Index)
 	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
@@ -121,12 +185,15 @@ func (s *Server) listenEvents() {
 		return
 	}
 
-	sub := s.eventBus.Subscribe(
+	sub := s.eventBus.SubscribeAs("server",
 		core.StateChangedEvent,
 		core.DeviceConnectedEvent,
 		core.PatternChangedEvent,
 		core.PowerChangedEvent,
 		core.ColorChangedEvent,
+		core.PatternErrorEvent,
+		core.AutomationStatusEvent,
+		core.PreviewFrameEvent,
 	)
 
 	for event := range sub {
@@ -141,41 +208,110 @@ func (s *Server) listenEvents() {
 			s.Hub.Broadcast(NewMessage("power_update", event.Payload))
 		case core.ColorChangedEvent:
 			s.Hub.Broadcast(NewMessage("color_update", event.Payload))
+		case core.PatternErrorEvent:
+			s.Hub.Broadcast(NewMessage("pattern_error", event.Payload))
+		case core.AutomationStatusEvent:
+			s.Hub.Broadcast(NewMessage("automation_list", event.Payload))
+		case core.PreviewFrameEvent:
+			s.Hub.Broadcast(NewMessage("preview_frame", event.Payload))
 		}
 	}
 }
 
-// ListenAndServe starts the HTTP server.
+// Handle registers an additional handler on the server's mux. It must be called before ListenAndServe.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Health returns nil while the HTTP listener is serving, otherwise the reason it is not.
+func (s *Server) Health() error {
+	s.listenMu.RLock()
+	defer s.listenMu.RUnlock()
+	if s.listening {
+		return nil
+	}
+	if s.listenErr != nil {
+		return s.listenErr
+	}
+	return errors.New("not listening")
+}
+
+func (s *Server) setListening(listening bool, err error) {
+	s.listenMu.Lock()
+	s.listening = listening
+	s.listenErr = err
+	s.listenMu.Unlock()
+}
+
+// ListenAndServe starts the HTTP server, or the HTTPS server plus optional redirect listener when TLS is enabled.
 func (s *Server) ListenAndServe() error {
-	return s.httpServer.ListenAndServe()
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		s.setListening(false, err)
+		return err
+	}
+	s.setListening(true, nil)
+
+	if s.certs == nil {
+		err = s.httpServer.Serve(ln)
+		s.setListening(false, err)
+		return err
+	}
+
+	if s.redirectServer != nil {
+		go func() {
+			logger.Info("Redirecting HTTP to HTTPS", "addr", s.redirectServer.Addr)
+			if err := s.redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("HTTP redirect listener failed", "err", err)
+			}
+		}()
+	}
+	err = s.httpServer.ServeTLS(ln, "", "")
+	s.setListening(false, err)
+	return err
 }
 
-// Shutdown gracefully stops the HTTP server.
+// TLSEnabled reports whether the server is serving HTTPS.
+func (s *Server) TLSEnabled() bool {
+	return s.certs != nil
+}
+
+// ReloadTLS re-reads the certificate and key files so renewed certificates apply without a restart.
+func (s *Server) ReloadTLS() error {
+	if s.certs == nil {
+		return nil
+	}
+	if err := s.certs.Reload(); err != nil {
+		return err
+	}
+	logger.Info("TLS certificate reloaded")
+	return nil
+}
+
+// Shutdown gracefully stops the HTTP server and the redirect listener.
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.redirectServer != nil {
+		_ = s.redirectServer.Shutdown(ctx)
+	}
 	return s.httpServer.Shutdown(ctx)
 }
 
-// handleWebSocket upgrades HTTP connections to WebSocket and handles client communication.
-func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := s.upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("[Server] WebSocket upgrade error: %v", err)
-		return
-	}
-	defer conn.Close()
+// snapshotMessages builds the messages describing the current state, sent to newly connected clients.
+func (s *Server) snapshotMessages() []Message {
+	var msgs []Message
 
 	if s.state != nil {
 		st := s.state.Clone()
 
-		// Send initial BLE connection status
-		_ = conn.WriteJSON(NewMessage("ble_status", map[string]interface{}{
+		// Initial BLE connection status
+		msgs = append(msgs, NewMessage("ble_status", map[string]interface{}{
 			"connected": st.IsConnected,
 			"rssi":      st.RSSI,
 		}))
 
-		// Send initial device state
+		// Initial device state
 		hex := fmt.Sprintf("#%02X%02X%02X", st.ColorR, st.ColorG, st.ColorB)
-		_ = conn.WriteJSON(NewMessage("device_state", map[string]interface{}{
+		msgs = append(msgs, NewMessage("device_state", map[string]interface{}{
 			"isOn":       st.Power,
 			"r":          st.ColorR,
 			"g":          st.ColorG,
@@ -185,50 +321,90 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			"speed":      st.Speed,
 		}))
 
-		// Send initial running pattern
-		_ = conn.WriteJSON(NewMessage("pattern_status", map[string]interface{}{
+		// Initial running pattern
+		status := map[string]interface{}{
 			"running": st.RunningPattern,
-		}))
+			"params":  st.RunningParams,
+		}
+		if st.RunningPlaylist != nil {
+			status["playlist"] = st.RunningPlaylist
+		}
+		if st.RunningTimer != nil {
+			status["timer"] = lua.TimerStatus(st.RunningTimer)
+		}
+		msgs = append(msgs, NewMessage("pattern_status", status))
 	}
 
-	// Send available pattern list
-	patterns, err := s.luaEngine.GetPatternList()
-	if err == nil {
-		_ = conn.WriteJSON(NewMessage("pattern_list", patterns))
+	// Available pattern list
+	if patterns, err := s.luaEngine.GetPatternList(); err == nil {
+		msgs = append(msgs, NewMessage("pattern_list", patterns))
+	}
+	if modules, err := s.luaEngine.GetLibraryList(); err == nil {
+		msgs = append(msgs, NewMessage("library_list", modules))
+	}
+	if deleted, err := s.luaEngine.DeletedPatterns(); err == nil {
+		msgs = append(msgs, NewMessage("deleted_patterns", deleted))
+	}
+	msgs = append(msgs, NewMessage("playlist_list", s.luaEngine.GetPlaylistList()))
+	if s.automations != nil {
+		msgs = append(msgs, NewMessage("automation_list", s.automations.List()))
 	}
 
-	// Send current schedule list
+	// Current schedule list
 	if s.scheduler != nil {
-		_ = conn.WriteJSON(NewMessage("schedule_list", s.scheduler.GetAll()))
+		msgs = append(msgs, NewMessage("schedule_list", s.scheduler.GetAll()))
 	}
 
-	s.Hub.register <- conn
+	// Recent log entries (only delivered to subscribers of the logs topic)
+	msgs = append(msgs, logHistoryMessage())
 
-	defer func() {
-		s.Hub.unregister <- conn
-	}()
+	return msgs
+}
 
-	for {
-		// Read incoming message from client
-		_, msgBytes, err := conn.ReadMessage()
-		if err != nil {
-			break
-		}
+// handleWebSocket upgrades HTTP connections to WebSocket and handles client communication.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Warn("WebSocket upgrade failed", "remote", r.RemoteAddr, "err", err)
+		return
+	}
 
-		var rawCmd incomingCommand
-		if err := json.Unmarshal(msgBytes, &rawCmd); err != nil {
-			log.Printf("[Server] Error unmarshalling client command: %v", err)
-			continue
-		}
+	// Clients may pick their topics up front with ?topics=state,ble so the initial
+	// snapshot already honors the selection; otherwise they get the defaults.
+	topics, _ := parseTopics(defaultTopics)
+	if raw := r.URL.Query().Get("topics"); raw != "" {
+		topics, _ = parseTopics(strings.Split(raw, ","))
+	}
+	c := newClient(conn, topics)
 
-		// Wrap as internal command and send to orchestrator
-		cmd := core.Command{
-			Type:    core.CommandType(rawCmd.Type),
-			Payload: rawCmd.Payload,
-		}
+	// The hub queues the initial snapshot as it registers the client (see Hub.Run).
+	s.Hub.register <- c
+	go c.writePump()
 
-		if s.commandChannel != nil {
-			s.commandChannel <- cmd
+	c.readPump(s.commandChannel, func(names []string) { s.handleSubscribe(c, names) }, func(msg Message) { s.Hub.sendTo(c, msg) })
+	s.Hub.unregister <- c
+}
+
+// handleSubscribe replaces a client's topic subscriptions, sends it a snapshot for any newly
+// added topics and acknowledges the resulting selection.
+func (s *Server) handleSubscribe(c *client, names []string) {
+	topics, unknown := parseTopics(names)
+	if len(unknown) > 0 {
+		logger.Warn("WebSocket client subscribed to unknown topics", "topics", unknown)
+	}
+	added := c.setTopics(topics)
+
+	var msgs []Message
+	if len(added) > 0 {
+		for _, msg := range s.snapshotMessages() {
+			if _, gated := messageTopics[msg.Type]; gated && added.allows(msg.Type) {
+				msgs = append(msgs, msg)
+			}
 		}
 	}
+	msgs = append(msgs, NewMessage("subscribed", map[string]interface{}{
+		"topics":  topics.list(),
+		"unknown": unknown,
+	}))
+	s.Hub.sendTo(c, msgs...)
 }
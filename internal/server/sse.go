@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseKeepAliveInterval is how often a comment line is sent to keep idle connections open through proxies.
+const sseKeepAliveInterval = 15 * time.Second
+
+// handleEvents streams hub broadcasts as Server-Sent Events.
+//
+// Query parameters:
+//   - types: comma-separated list of message types to deliver (default: all)
+//
+// Clients reconnecting with a Last-Event-ID header (or lastEventId query parameter) receive the
+// events they missed from the bounded history instead of a fresh state snapshot. If those
+// events are no longer kept, or the ID is from before a restart, they get the snapshot. A client
+// too slow to keep up has its stream ended, so it reconnects and catches up the same way.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	filter := parseTypeFilter(r.URL.Query().Get("types"))
+
+	lastIDStr := r.Header.Get("Last-Event-ID")
+	if lastIDStr == "" {
+		lastIDStr = r.URL.Query().Get("lastEventId")
+	}
+	lastID, _ := strconv.ParseUint(lastIDStr, 10, 64)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	if origin := r.Header.Get("Origin"); origin != "" && s.isAllowedOrigin(origin) {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	sub, replay, resync := s.Hub.events.subscribe(lastID)
+	defer s.Hub.events.unsubscribe(sub)
+
+	if resync {
+		if lastID != 0 {
+			logger.Info("SSE client missed events that are no longer kept, sending a snapshot", "last_event_id", lastID)
+		}
+		for _, msg := range s.snapshotMessages() {
+			if filter.allows(msg.Type) && !webSocketOnly(msg.Type) {
+				if err := writeSSE(w, 0, msg); err != nil {
+					return
+				}
+			}
+		}
+	}
+	for _, ev := range replay {
+		if filter.allows(ev.Message.Type) {
+			if err := writeSSE(w, ev.ID, ev.Message); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev, ok := <-sub:
+			if !ok {
+				// Too slow to keep up; ending the stream makes the client reconnect and replay.
+				return
+			}
+			if !filter.allows(ev.Message.Type) {
+				continue
+			}
+			if err := writeSSE(w, ev.ID, ev.Message); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE writes a single message in text/event-stream format. An id of 0 is omitted.
+func writeSSE(w http.ResponseWriter, id uint64, msg Message) error {
+	data, err := json.Marshal(msg.Payload)
+	if err != nil {
+		logger.Error("SSE marshal failed", "type", msg.Type, "err", err)
+		return nil
+	}
+	if id != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data)
+	return err
+}
+
+// typeFilter is a set of allowed message types; an empty filter allows everything.
+type typeFilter map[string]bool
+
+func parseTypeFilter(raw string) typeFilter {
+	filter := typeFilter{}
+	for _, t := range strings.Split(raw, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter[t] = true
+		}
+	}
+	return filter
+}
+
+func (f typeFilter) allows(msgType string) bool {
+	return len(f) == 0 || f[msgType]
+}
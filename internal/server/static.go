@@ -6,7 +6,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io/fs"
-	"log"
 	"mime"
 	"net/http"
 	"os"
@@ -42,7 +41,7 @@ func loadStaticSource(overrideDir string) (*staticSource, error) {
 		if info, err := os.Stat(overrideDir); err == nil && info.IsDir() {
 			return newStaticSource(os.DirFS(overrideDir), "external", overrideDir, true)
 		}
-		log.Printf("[Server] External web directory %q not found, falling back to embedded assets", overrideDir)
+		logger.Warn("External web directory not found, falling back to embedded assets", "dir", overrideDir)
 	}
 
 	staticFS, err := webassets.FS()
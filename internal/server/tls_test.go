@@ -0,0 +1,47 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnsureSelfSignedCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "certs", "cert.pem")
+	keyFile := filepath.Join(dir, "certs", "key.pem")
+
+	if err := ensureSelfSignedCert(certFile, keyFile); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if _, err := newCertReloader(certFile, keyFile); err != nil {
+		t.Fatalf("load generated pair: %v", err)
+	}
+	cert, _ := os.ReadFile(certFile)
+
+	// An existing pair is kept as is.
+	if err := ensureSelfSignedCert(certFile, keyFile); err != nil {
+		t.Fatalf("existing pair: %v", err)
+	}
+	if again, _ := os.ReadFile(certFile); string(again) != string(cert) {
+		t.Error("existing certificate was regenerated")
+	}
+
+	// A lone file is an error naming the missing one, and is not overwritten.
+	for missing, other := range map[string]string{keyFile: certFile, certFile: keyFile} {
+		data, _ := os.ReadFile(other)
+		os.Rename(missing, missing+".bak")
+		err := ensureSelfSignedCert(certFile, keyFile)
+		if err == nil || !strings.Contains(err.Error(), missing) {
+			t.Errorf("with %s missing: err = %v, want an error naming it", filepath.Base(missing), err)
+		}
+		if _, statErr := os.Stat(missing); !os.IsNotExist(statErr) {
+			t.Errorf("%s was created", filepath.Base(missing))
+		}
+		if kept, _ := os.ReadFile(other); string(kept) != string(data) {
+			t.Errorf("%s was overwritten", filepath.Base(other))
+		}
+		os.Rename(missing+".bak", missing)
+	}
+}
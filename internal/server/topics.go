@@ -0,0 +1,104 @@
+package server
+
+import (
+	"sort"
+	"strings"
+)
+
+// Subscription topics a WebSocket client can select.
+const (
+	TopicState     = "state"
+	TopicBLE       = "ble"
+	TopicPatterns  = "patterns"
+	TopicSchedules = "schedules"
+	TopicLogs      = "logs"
+	TopicPreview   = "preview"
+)
+
+// knownTopics lists every valid topic.
+var knownTopics = []string{TopicState, TopicBLE, TopicPatterns, TopicSchedules, TopicLogs, TopicPreview}
+
+// defaultTopics are delivered to clients that never subscribe; high-volume topics are opt-in.
+var defaultTopics = []string{TopicState, TopicBLE, TopicPatterns, TopicSchedules}
+
+// messageTopics maps outgoing message types to the topic that gates them.
+// Types without an entry (e.g. direct replies) are always delivered.
+var messageTopics = map[string]string{
+	"device_state":      TopicState,
+	"power_update":      TopicState,
+	"color_update":      TopicState,
+	"brightness_update": TopicState,
+	"ble_status":        TopicBLE,
+	"pattern_status":    TopicPatterns,
+	"pattern_list":      TopicPatterns,
+	"library_list":      TopicPatterns,
+	"pattern_code":      TopicPatterns,
+	"pattern_saved":     TopicPatterns,
+	"pattern_history":   TopicPatterns,
+	"pattern_diff":      TopicPatterns,
+	"deleted_patterns":  TopicPatterns,
+	"pattern_error":     TopicPatterns,
+	"automation_list":   TopicPatterns,
+	"playlist_list":     TopicPatterns,
+	"playlist_error":    TopicPatterns,
+	"schedule_list":     TopicSchedules,
+	"log":               TopicLogs,
+	"log_history":       TopicLogs,
+	"preview_frame":     TopicPreview,
+}
+
+// webSocketOnly reports whether messages of msgType skip Server-Sent Events: log lines and
+// preview frames would quickly push state changes out of the bounded resumption history.
+func webSocketOnly(msgType string) bool {
+	topic := messageTopics[msgType]
+	return topic == TopicLogs || topic == TopicPreview
+}
+
+// topicSet is a set of subscribed topics.
+type topicSet map[string]bool
+
+// parseTopics builds a topicSet from names, returning any names that are not known topics.
+func parseTopics(names []string) (topicSet, []string) {
+	set := topicSet{}
+	var unknown []string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !isKnownTopic(name) {
+			unknown = append(unknown, name)
+			continue
+		}
+		set[name] = true
+	}
+	return set, unknown
+}
+
+func isKnownTopic(name string) bool {
+	for _, t := range knownTopics {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether a message of msgType should be delivered to a subscriber of this set.
+func (ts topicSet) allows(msgType string) bool {
+	topic, ok := messageTopics[msgType]
+	if !ok {
+		return true
+	}
+	return ts[topic]
+}
+
+// list returns the subscribed topics in a stable order.
+func (ts topicSet) list() []string {
+	out := make([]string, 0, len(ts))
+	for t := range ts {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -41,3 +41,6 @@ export const DEFAULT_PRESETS = [
     '#9400D3',
     '#FF1493',
 ];
+
+// WebSocket topics the UI subscribes to; "logs" feeds the pattern editor console.
+export const WS_TOPICS = ['state', 'ble', 'patterns', 'schedules', 'logs'];
@@ -12,8 +12,17 @@ import {
     storeLastSection,
     getActiveSectionId,
     resetUiPreferences,
+    clearConsole,
+    clearEditorDiagnostics,
+    hidePatternHistory,
+    renderSelectedPattern,
+    getPatternParamValues,
+    getPatternRunLimit,
+    renderSelectedPlaylist,
+    showPlaylistError,
+    showImportResult,
 } from './ui.js';
-import { deviceAPI } from './api.js';
+import { deviceAPI, bundleAPI } from './api.js';
 import { debounce, normalizeHex, pad } from './utils.js';
 import { DEFAULT_PRESETS } from './constants.js';
 
@@ -145,24 +154,75 @@ export function initEventListeners() {
         });
     }
 
-    ui.runPatternBtn.addEventListener('click', () => { if (ui.patternSelector.value) deviceAPI.runPattern(ui.patternSelector.value); });
+    ui.runPatternBtn.addEventListener('click', () => {
+        if (ui.patternSelector.value) deviceAPI.runPattern(ui.patternSelector.value, getPatternParamValues(), getPatternRunLimit());
+    });
+    ui.patternSelector.addEventListener('change', renderSelectedPattern);
     ui.stopPatternBtn.addEventListener('click', deviceAPI.stopPattern);
 
+    ui.runPlaylistBtn.addEventListener('click', () => {
+        if (ui.playlistSelector.value) deviceAPI.runPlaylist(ui.playlistSelector.value);
+    });
+    ui.playlistSelector.addEventListener('change', renderSelectedPlaylist);
+    ui.prevPlaylistItemBtn.addEventListener('click', deviceAPI.playlistPrevious);
+    ui.nextPlaylistItemBtn.addEventListener('click', deviceAPI.playlistNext);
+    ui.savePlaylistBtn.addEventListener('click', () => {
+        const name = ui.playlistName.value.trim();
+        if (!name) { showPlaylistError('Please enter a playlist name.'); return; }
+        let playlist;
+        try {
+            playlist = JSON.parse(ui.playlistDefinition.value);
+        } catch (err) {
+            showPlaylistError(`Invalid JSON: ${err.message}`);
+            return;
+        }
+        showPlaylistError('');
+        deviceAPI.savePlaylist(name, playlist);
+    });
+    ui.deletePlaylistBtn.addEventListener('click', () => {
+        const name = ui.playlistName.value.trim();
+        if (name && confirm(`Are you sure you want to delete the playlist "${name}"?`)) {
+            deviceAPI.deletePlaylist(name);
+        }
+    });
+
     ui.loadPatternBtn.addEventListener('click', () => {
         if (ui.editorPatternSelector.value) deviceAPI.getPatternCode(ui.editorPatternSelector.value);
     });
+    ui.clearConsoleBtn.addEventListener('click', clearConsole);
+    const jumpToLine = (e) => {
+        const line = e.target.closest('.console-line[data-line]');
+        if (!line) return;
+        const lineNo = parseInt(line.dataset.line, 10) - 1;
+        ui.codeEditor.focus();
+        ui.codeEditor.setCursor({ line: lineNo, ch: 0 });
+        ui.codeEditor.scrollIntoView({ line: lineNo, ch: 0 }, 60);
+    };
+    ui.editorConsole.addEventListener('click', jumpToLine);
+    ui.editorDiagnostics.addEventListener('click', jumpToLine);
     ui.newPatternBtn.addEventListener('click', () => {
         ui.editorFilename.value = 'new-pattern.lua';
         ui.editorFilename.focus();
+        clearEditorDiagnostics();
+        hidePatternHistory();
     });
+    ui.patternHistoryBtn.addEventListener('click', () => {
+        const filename = ui.editorFilename.value.trim();
+        if (!filename || !filename.endsWith('.lua')) {
+            alert('Load or name a pattern to see its history.');
+            return;
+        }
+        deviceAPI.getPatternHistory(filename);
+    });
+    ui.closeHistoryBtn.addEventListener('click', hidePatternHistory);
     ui.savePatternBtn.addEventListener('click', () => {
         const filename = ui.editorFilename.value.trim();
         if (!filename || !filename.endsWith('.lua')) {
             alert('Filename is invalid. It must not be empty and must end with .lua');
             return;
         }
+        // The result, with any problems found in the code, arrives as pattern_saved.
         deviceAPI.savePatternCode(filename, ui.codeEditor.getValue());
-        alert(`Pattern "${filename}" saved!`);
     });
     ui.deletePatternBtn.addEventListener('click', () => {
         const filename = ui.editorPatternSelector.value;
@@ -172,6 +232,23 @@ export function initEventListeners() {
         }
     });
 
+    ui.exportPatternsBtn.addEventListener('click', () => {
+        const names = [...ui.exportPatternSelector.selectedOptions].map(o => o.value);
+        window.location.href = bundleAPI.exportUrl(names, ui.exportFormat.value);
+    });
+    ui.importPatternsBtn.addEventListener('click', () => {
+        const file = ui.importBundleFile.files[0];
+        if (!file) {
+            alert('Choose a .zip or .tar.gz bundle to import.');
+            return;
+        }
+        // The updated pattern lists arrive over the socket once the files are written.
+        const importBundle = (onConflict) => bundleAPI.importBundle(file, onConflict)
+            .then(result => showImportResult(result, importBundle))
+            .catch(err => showImportResult({ status: 0, files: [], error: err.message }, importBundle));
+        importBundle('');
+    });
+
     ui.addScheduleBtn.addEventListener('click', () => {
         const isEditing = !!ui.scheduleEditId;
         const isSimple = ui.cronSimpleMode && ui.cronSimpleMode.style.display !== 'none';
@@ -206,6 +283,10 @@ export function initEventListeners() {
                 const patternName = ui.cronPatternSelect.value;
                 if (!patternName) { alert('Please select a pattern.'); return; }
                 command = `pattern ${patternName}`;
+            } else if (command === 'playlist') {
+                const playlistName = ui.cronPlaylistSelect.value;
+                if (!playlistName) { alert('Please select a playlist.'); return; }
+                command = `playlist ${playlistName}`;
             }
             deviceAPI.addSchedule(spec, command);
         } else {
@@ -270,6 +351,7 @@ export function initEventListeners() {
     if (ui.cronCommandType) {
         ui.cronCommandType.addEventListener('change', () => {
             ui.cronPatternSelect.style.display = ui.cronCommandType.value === 'pattern' ? '' : 'none';
+            ui.cronPlaylistSelect.style.display = ui.cronCommandType.value === 'playlist' ? '' : 'none';
         });
     }
 
@@ -316,5 +398,14 @@ export function initEventListeners() {
         });
     }
 
+    if (ui.automationList) {
+        ui.automationList.addEventListener('click', e => {
+            const btn = e.target.closest('.automation-toggle-btn');
+            if (!btn) return;
+            if (btn.dataset.action === 'stop') deviceAPI.stopAutomation(btn.dataset.name);
+            else deviceAPI.startAutomation(btn.dataset.name);
+        });
+    }
+
     ui.darkModeToggle.addEventListener('click', toggleDarkMode);
 }
@@ -9,7 +9,20 @@ import {
     populateTimePickers,
     populateCronTimePickers,
     updatePatternLists,
+    updateLibraryList,
+    updateAutomationList,
+    updatePlaylistList,
+    showPlaylistError,
+    showPatternStatus,
     updateScheduleList,
+    appendConsoleEntries,
+    clearConsole,
+    showSaveResult,
+    clearEditorDiagnostics,
+    showPatternHistory,
+    hidePatternHistory,
+    showPatternDiff,
+    updateDeletedPatterns,
     initDarkMode,
     initNavigation,
     initSidebarToggle,
@@ -19,6 +32,7 @@ import {
 } from './ui.js';
 import { deviceAPI, setSocket } from './api.js';
 import { initEventListeners } from './event-listeners.js';
+import { WS_TOPICS } from './constants.js';
 
 document.addEventListener('DOMContentLoaded', () => {
     let socket;
@@ -41,7 +55,7 @@ document.addEventListener('DOMContentLoaded', () => {
 
     function connect() {
         const proto = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = `${proto}//${window.location.host}/ws`;
+        const wsUrl = `${proto}//${window.location.host}/ws?topics=${WS_TOPICS.join(',')}`;
         socket = new WebSocket(wsUrl);
         setSocket(socket);
 
@@ -117,13 +131,50 @@ document.addEventListener('DOMContentLoaded', () => {
                     break;
 
                 case 'pattern_list': updatePatternLists(msg.payload); break;
+                case 'library_list': updateLibraryList(msg.payload); break;
+                case 'automation_list': updateAutomationList(msg.payload); break;
                 case 'schedule_list': updateScheduleList(msg.payload); break;
-                case 'pattern_status': ui.patternStatus.textContent = msg.payload.running || 'Idle'; break;
+                case 'playlist_list': updatePlaylistList(msg.payload); break;
+                case 'playlist_error': showPlaylistError(msg.payload.error); break;
+                case 'pattern_status': showPatternStatus(msg.payload); break;
+
+                case 'log': appendConsoleEntries([msg.payload]); break;
+                case 'log_history':
+                    // Sent on every (re)connect, so it replaces what the console already shows.
+                    clearConsole();
+                    appendConsoleEntries(msg.payload || []);
+                    break;
+                // Pattern errors also arrive as log entries, which the console already shows;
+                // rejected parameters are shown next to the run button as well.
+                case 'pattern_error':
+                    if (msg.payload.reason === 'invalid_params') {
+                        ui.patternStatus.textContent = `Invalid parameters: ${msg.payload.error}`;
+                    }
+                    break;
+                case 'subscribed':
+                    break;
 
                 case 'pattern_code':
+                    if (msg.payload.name !== ui.editorFilename.value.trim()) hidePatternHistory();
                     ui.editorFilename.value = msg.payload.name;
                     ui.codeEditor.setValue(msg.payload.code);
+                    clearEditorDiagnostics();
+                    break;
+                // Saves are broadcast; only the result for the file being edited is shown.
+                case 'pattern_saved':
+                    if (msg.payload.name !== ui.editorFilename.value.trim()) break;
+                    showSaveResult(msg.payload);
+                    if (msg.payload.saved && !ui.patternHistory.hidden) deviceAPI.getPatternHistory(msg.payload.name);
+                    break;
+                case 'pattern_history':
+                    if (msg.payload.name === ui.editorFilename.value.trim()) {
+                        showPatternHistory(msg.payload.name, msg.payload.revisions, deviceAPI);
+                    }
+                    break;
+                case 'pattern_diff':
+                    if (msg.payload.name === ui.editorFilename.value.trim()) showPatternDiff(msg.payload);
                     break;
+                case 'deleted_patterns': updateDeletedPatterns(msg.payload, deviceAPI); break;
 
                 default:
                     console.log('Unknown message type:', msg.type, msg.payload);
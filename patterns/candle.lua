@@ -1,4 +1,8 @@
 -- candle.lua: Simulates a warm, flickering candle flame.
+-- @name Candle
+-- @tags calm, warm
+-- @loops true
+-- @palette #ff8c1a #ff6a00 #ffb347
 
 print("Starting candle flicker pattern...")
 set_power(true)
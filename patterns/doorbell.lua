@@ -0,0 +1,27 @@
+-- doorbell.lua: Flashes when the doorbell rings, then returns to the previous color.
+-- @name Doorbell Alert
+-- @tags automation, alert
+-- @loops true
+-- @param topic string default=home/doorbell label="Doorbell MQTT topic"
+-- @param flash color default=#0000ff label="Flash color"
+-- @param flashes integer default=3 min=1 max=10
+
+local function alert()
+  local before = get_state()
+  for _ = 1, params.flashes do
+    set_color(params.flash)
+    sleep(300)
+    set_color(0, 0, 0)
+    sleep(200)
+  end
+  set_color(before.color)
+  set_power(before.power)
+end
+
+on("mqtt", params.topic, function(payload)
+  print("Doorbell: " .. payload)
+  set_power(true)
+  alert()
+end)
+
+print("Waiting for " .. params.topic)
@@ -1,4 +1,8 @@
 -- effects.lua: Demonstrates the new built-in effect functions.
+-- @name Effect Showcase
+-- @tags demo
+-- @loops true
+-- @palette #00ffff #ffffff #ff0000 #0000ff
 
 print("Starting effect showcase...")
 set_power(true)
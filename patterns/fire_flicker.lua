@@ -1,4 +1,8 @@
 -- fire_flicker.lua: Simulates the warm, dancing glow of a fire.
+-- @name Fire Flicker
+-- @tags calm, warm
+-- @loops true
+-- @palette #ff4500 #ff8c00 #ffd700
 
 print("Starting fire flicker pattern...")
 
@@ -8,13 +12,8 @@ set_power(true)
 while true do
     if should_stop() then return end
 
-    local r = 200 + math.random(55)  -- 200–255 red
-    local g = math.random(100)       -- 0–100 green
-    local b = 0                      -- no blue
-    local bright = 60 + math.random(40) -- 60–100 brightness
-
-    set_color(r, g, b)
-    set_brightness(bright)
+    -- Pick a random spot in the hot half of the fire palette
+    set_color(color.gradient("fire", 0.45 + math.random() * 0.4))
+    set_brightness(60 + math.random(40)) -- 60–100 brightness
     sleep(80 + math.random(120)) -- flicker timing
 end
-
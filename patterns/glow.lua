@@ -0,0 +1,14 @@
+-- glow.lua: Breathes the color last chosen in the UI.
+-- @name Glow
+-- @tags calm
+-- @loops true
+-- @param period number default=4 min=1 max=30 label="Breath length (seconds)"
+
+print("Starting glow pattern...")
+set_power(true)
+set_color(get_user_color())
+
+while true do
+  if should_stop() then return end
+  breathe(math.floor(params.period * 1000))
+end
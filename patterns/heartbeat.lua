@@ -1,4 +1,8 @@
 -- heartbeat.lua: Pulsates with a rhythmic red-pink heartbeat.
+-- @name Heartbeat
+-- @tags calm, romantic
+-- @loops true
+-- @palette #ff0032
 
 print("Starting heartbeat pattern...")
 
@@ -0,0 +1,43 @@
+-- util.lua: Helpers shared by patterns. Load with: local util = require("util")
+local util = {}
+
+-- clamp limits v to the range [lo, hi].
+function util.clamp(v, lo, hi)
+  return math.max(lo, math.min(hi, v))
+end
+
+-- set_rgb sets the color from a {r, g, b} table (e.g. a color parameter). Does nothing for nil.
+function util.set_rgb(color)
+  if not color then return end
+  set_color(tonumber(color[1]) or 0, tonumber(color[2]) or 0, tonumber(color[3]) or 0)
+end
+
+-- set_brightness clamps br to 0-100 and applies it. Returns the value set, or nil for nil.
+function util.set_brightness(br)
+  if not br then return end
+  br = math.floor(util.clamp(tonumber(br) or 0, 0, 100))
+  set_brightness(br)
+  return br
+end
+
+-- to_minutes converts a {hour=, min=} table to minutes since midnight.
+function util.to_minutes(t)
+  if not t then return 0 end
+  return (tonumber(t.hour) or 0) * 60 + (tonumber(t.min) or 0)
+end
+
+-- now returns the local time as minutes since midnight, plus the hour and minute.
+function util.now()
+  local h = tonumber(os.date("%H")) or 0
+  local m = tonumber(os.date("%M")) or 0
+  return h * 60 + m, h, m
+end
+
+-- in_range reports whether minute cur falls in [a, b), wrapping past midnight when b < a.
+function util.in_range(cur, a, b)
+  if a == b then return false end
+  if a < b then return cur >= a and cur < b end
+  return cur >= a or cur < b
+end
+
+return util
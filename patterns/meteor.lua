@@ -1,4 +1,8 @@
 -- meteor.lua: Creates a white flash followed by a fading blue trail.
+-- @name Meteor
+-- @tags party
+-- @loops true
+-- @palette #ffffff #0000ff
 
 print("Starting meteor pattern...")
 
@@ -1,16 +1,20 @@
 -- ocean_wave.lua: A gentle blue and green color cycle that mimics waves.
+-- @name Ocean Wave
+-- @tags calm, cool
+-- @loops true
+-- @palette #0064ff #00c8a0
 
 print("Starting ocean wave pattern...")
 
 set_power(true)
 
+-- Sample the ocean palette along a slow, eased swell that wraps around.
+local t = 0
 while true do
     if should_stop() then return end
-    for i = 0, 255, 5 do
-        if should_stop() then return end
-        set_color(0, 100 + (i % 155), 200) -- green/blue mix
-        set_brightness(40 + (i % 60))      -- wave swell
-        sleep(80)
-    end
+    local swell = color.ease("in_out_sine", math.abs(1 - 2 * t)) -- 0 -> 1 -> 0
+    set_color(color.gradient("ocean", 0.3 + 0.7 * swell))
+    set_brightness(40 + math.floor(60 * swell))
+    sleep(80)
+    t = (t + 0.01) % 1
 end
-
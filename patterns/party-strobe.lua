@@ -1,4 +1,8 @@
 -- party-strobe.lua: Fast strobe through a set of vibrant colors.
+-- @name Party Strobe
+-- @tags party, fast
+-- @loops true
+-- @palette #ff0000 #00ff00 #0000ff #ffff00 #ff00ff #00ffff
 
 print("Starting party strobe...")
 set_power(true)
@@ -1,36 +1,34 @@
--- police.lua: Rapidly strobes between red and blue.
+-- police.lua: Rapidly strobes between two colors.
+-- @name Police Lights
+-- @tags party, fast
+-- @loops true
+-- @palette #ff0000 #0000ff
+-- @param speed number default=1 min=0.25 max=4 label="Speed multiplier"
+-- @param first color default=#ff0000 label="First color"
+-- @param second color default=#0000ff label="Second color"
 
 print("Starting police pattern...")
 
 set_power(true)
 set_brightness(100)
 
--- Loop forever until the user stops the pattern
-while true do
-  if should_stop() then return end
-  
-  -- Flash RED
-  set_color(255, 0, 0)
-  sleep(100) -- Wait 100 milliseconds
-  
-  set_color(0, 0, 0) -- Turn off briefly for a better strobe effect
-  sleep(50)
+local on_ms = math.floor(100 / params.speed)
+local off_ms = math.floor(50 / params.speed)
 
-  -- Check if we should stop between flashes 
-  if should_stop() then return end
+local function flash(c)
+  set_color(c.r, c.g, c.b)
+  sleep(on_ms)
 
-  -- Flash BLUE
-  set_color(0, 0, 255)
-  sleep(100)
+  set_color(0, 0, 0) -- Turn off briefly for a better strobe effect
+  sleep(off_ms)
+end
 
-  set_color(0, 0, 0)
-  sleep(50)
+-- Loop forever until the user stops the pattern
+while true do
+  if should_stop() then return end
+  flash(params.first)
 
-  -- Another check to make the pattern very responsive
+  -- Check if we should stop between flashes
   if should_stop() then return end
-  
-  -- Flash RED
-  set_color(255, 0, 0)
-  sleep(100) -- Wait 100 milliseconds
-  
+  flash(params.second)
 end
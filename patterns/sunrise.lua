@@ -1,67 +1,70 @@
 -- sunrise.lua
-local function clamp(v, lo, hi) return math.max(lo, math.min(hi, v)) end
-local function to_min(t) if not t then return 0 end; return (tonumber(t.hour) or 0) * 60 + (tonumber(t.min) or 0) end
-local function now()
-  local h = tonumber(os.date("%H")) or 0
-  local m = tonumber(os.date("%M")) or 0
-  return h * 60 + m, h, m
-end
-local function in_range(cur, a, b)
-  if a == b then return false end
-  if a < b then return cur >= a and cur < b end
-  return cur >= a or cur < b
-end
-local function safe_set_color(color)
-  if not color then return end
-  set_color(tonumber(color[1]) or 0, tonumber(color[2]) or 0, tonumber(color[3]) or 0)
-end
-local function safe_set_brightness(br)
-  if not br then return end
-  br = math.floor(clamp(tonumber(br) or 0, 0, 100))
-  set_brightness(br)
-  return br
-end
+-- @name Sunrise
+-- @description Sets the color and brightness for the time of day, fading between day, dusk and night when run at a transition hour.
+-- @tags schedule, calm
+-- @loops false
+-- @on_end keep
+-- @palette #ff0000 #00ff00 #ff1100
+-- @param morning_hour integer default=9 min=0 max=23 label="Morning starts (hour)"
+-- @param dusk_hour integer default=21 min=0 max=23 label="Dusk starts (hour)"
+-- @param night_hour integer default=0 min=0 max=23 label="Night starts (hour)"
+-- @param day_color color default=#00ff00 label="Day color"
+-- @param dusk_color color default=#ff1100 label="Dusk color"
+-- @param night_color color default=#ff0000 label="Night color"
+-- @param day_brightness integer default=100 min=0 max=100 label="Day brightness"
+-- @param dusk_brightness integer default=100 min=0 max=100 label="Dusk brightness"
+-- @param night_brightness integer default=100 min=0 max=100 label="Night brightness"
+-- @param transition_min number default=1 min=0 max=120 label="Transition length (minutes)"
+local util = require("util")
+local to_min, now, in_range = util.to_minutes, util.now, util.in_range
+local safe_set_color, safe_set_brightness = util.set_rgb, util.set_brightness
+
 local function apply_state(color, brightness, label, h, m)
   safe_set_color(color)
   local br = safe_set_brightness(brightness) or 0
-  local cname = "Custom"
-  if color and color[1]==0 and color[2]==255 then cname = "Green"
-  elseif color and color[1]==255 and color[2]==0 then cname = "Red" end
+  local cname = (color and color.hex) or "custom"
   print(string.format("%s | %02d:%02d | color=%s | br=%d%%", label, h, m, cname, br))
 end
 
--- CONFIG
-local BR_MIN = 100
-local BR_DUSK = 100
-local BR_MAX = 100
-local DEFAULT_TRANS_MS = 60 * 1000
+-- CONFIG (from the pattern parameters)
+local BR_MIN = params.night_brightness
+local BR_DUSK = params.dusk_brightness
+local BR_MAX = params.day_brightness
+local DEFAULT_TRANS_MS = math.floor(params.transition_min * 60 * 1000)
+
+local DAY = params.day_color
+local DUSK = params.dusk_color
+local NIGHT = params.night_color
+local MORNING_AT = { hour = params.morning_hour }
+local DUSK_AT = { hour = params.dusk_hour }
+local NIGHT_AT = { hour = params.night_hour }
 
 local transitions = {
   { name="morning",
-    at = { hour = 9 },
-    from = { color={255,0,0}, brightness = BR_MIN },
-    to   = { color={0,255,0}, brightness = BR_MAX },
+    at = MORNING_AT,
+    from = { color=NIGHT, brightness = BR_MIN },
+    to   = { color=DAY, brightness = BR_MAX },
     duration_ms = DEFAULT_TRANS_MS },
   { name="dusk",
-    at = { hour = 21, min = 0 },
-    from = { color={0,255,0}, brightness = BR_MAX },
-    to   = { color={255, 17, 0}, brightness = BR_DUSK },
+    at = DUSK_AT,
+    from = { color=DAY, brightness = BR_MAX },
+    to   = { color=DUSK, brightness = BR_DUSK },
     duration_ms = DEFAULT_TRANS_MS },
   { name="evening",
-    at = { hour = 0, min = 0 },
-    from = { color={255, 17, 0}, brightness = BR_DUSK },
-    to   = { color={255,0,0}, brightness = BR_MIN },
+    at = NIGHT_AT,
+    from = { color=DUSK, brightness = BR_DUSK },
+    to   = { color=NIGHT, brightness = BR_MIN },
     duration_ms = DEFAULT_TRANS_MS },
 
   { name="day_period",
-    range = { start = { hour = 9 }, finish = { hour = 21 } },
-    target = { color = {0,255,0}, brightness = BR_MAX } },
+    range = { start = MORNING_AT, finish = DUSK_AT },
+    target = { color = DAY, brightness = BR_MAX } },
   { name="dusk_period",
-    range = { start = { hour = 21 }, finish = { hour = 0 } },
-    target = { color = {255, 17, 0}, brightness = BR_DUSK } },
+    range = { start = DUSK_AT, finish = NIGHT_AT },
+    target = { color = DUSK, brightness = BR_DUSK } },
   { name="night_period",
-    range = { start = { hour = 0 }, finish = { hour = 9 } },
-    target = { color = {255,0,0}, brightness = BR_MIN } }
+    range = { start = NIGHT_AT, finish = MORNING_AT },
+    target = { color = NIGHT, brightness = BR_MIN } }
 }
 
 print("Starting sunrise pattern...")
@@ -110,4 +113,4 @@ for _, t in ipairs(transitions) do
 end
 
 -- fallback
-apply_state({255,0,0}, BR_MIN, "fallback_night", hh, mm)
+apply_state(NIGHT, BR_MIN, "fallback_night", hh, mm)
@@ -34,7 +34,7 @@ export const deviceAPI = {
         });
         sendSocketCommand('setSchedule', { hour, minute, second, weekdays, isOn, isSet });
     },
-    runPattern: (name) => sendSocketCommand('runPattern', { name }),
+    runPattern: (name, params = {}, limit = {}) => sendSocketCommand('runPattern', { name, params, ...limit }),
     stopPattern: () => sendSocketCommand('stopPattern', {}),
     addSchedule: (spec, command) => sendSocketCommand('addSchedule', { spec, command }),
     updateSchedule: (id, spec, command) => sendSocketCommand('updateSchedule', { id, spec, command }),
@@ -45,4 +45,32 @@ export const deviceAPI = {
     getPatternCode: (name) => sendSocketCommand('getPatternCode', { name }),
     savePatternCode: (name, code) => sendSocketCommand('savePatternCode', { name, code }),
     deletePattern: (name) => sendSocketCommand('deletePattern', { name }),
+    getPatternHistory: (name) => sendSocketCommand('getPatternHistory', { name }),
+    diffPatternRevisions: (name, from, to = 0) => sendSocketCommand('diffPatternRevisions', { name, from, to }),
+    restorePatternRevision: (name, id) => sendSocketCommand('restorePatternRevision', { name, id }),
+    undeletePattern: (name) => sendSocketCommand('undeletePattern', { name }),
+    startAutomation: (name) => sendSocketCommand('startAutomation', { name }),
+    stopAutomation: (name) => sendSocketCommand('stopAutomation', { name }),
+    runPlaylist: (name) => sendSocketCommand('runPlaylist', { name }),
+    playlistNext: () => sendSocketCommand('playlistNext', {}),
+    playlistPrevious: () => sendSocketCommand('playlistPrevious', {}),
+    savePlaylist: (name, playlist) => sendSocketCommand('savePlaylist', { name, playlist }),
+    deletePlaylist: (name) => sendSocketCommand('deletePlaylist', { name }),
+};
+
+// Pattern bundles are files, so they go over HTTP instead of the socket.
+export const bundleAPI = {
+    exportUrl: (names, format) => {
+        const query = new URLSearchParams();
+        names.forEach(name => query.append('name', name));
+        query.set('format', format);
+        return `/api/v1/patterns/export?${query}`;
+    },
+    // importBundle resolves to the server's report: { status, files, error }.
+    importBundle: async (file, onConflict = '') => {
+        const query = onConflict ? `?on_conflict=${encodeURIComponent(onConflict)}` : '';
+        const res = await fetch(`/api/v1/patterns/import${query}`, { method: 'POST', body: file });
+        const body = await res.json().catch(() => ({ error: res.statusText }));
+        return { status: res.status, files: body.files || [], error: body.error };
+    },
 };
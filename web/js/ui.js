@@ -44,6 +44,19 @@ export const ui = {
     runPatternBtn:           document.getElementById('runPatternBtn'),
     stopPatternBtn:          document.getElementById('stopPatternBtn'),
     patternStatus:           document.getElementById('patternStatus'),
+    patternInfo:             document.getElementById('patternInfo'),
+    patternParams:           document.getElementById('patternParams'),
+    patternStopAfter:        document.getElementById('patternStopAfter'),
+    patternThen:             document.getElementById('patternThen'),
+    playlistSelector:        document.getElementById('playlistSelector'),
+    runPlaylistBtn:          document.getElementById('runPlaylistBtn'),
+    prevPlaylistItemBtn:     document.getElementById('prevPlaylistItemBtn'),
+    nextPlaylistItemBtn:     document.getElementById('nextPlaylistItemBtn'),
+    playlistName:            document.getElementById('playlistName'),
+    playlistDefinition:      document.getElementById('playlistDefinition'),
+    playlistError:           document.getElementById('playlistError'),
+    savePlaylistBtn:         document.getElementById('savePlaylistBtn'),
+    deletePlaylistBtn:       document.getElementById('deletePlaylistBtn'),
 
     // Editor
     editorPatternSelector:   document.getElementById('editorPatternSelector'),
@@ -52,6 +65,22 @@ export const ui = {
     savePatternBtn:          document.getElementById('savePatternBtn'),
     deletePatternBtn:        document.getElementById('deletePatternBtn'),
     editorFilename:          document.getElementById('editorFilename'),
+    editorConsole:           document.getElementById('editorConsole'),
+    editorDiagnostics:       document.getElementById('editorDiagnostics'),
+    patternHistoryBtn:       document.getElementById('patternHistoryBtn'),
+    patternHistory:          document.getElementById('patternHistory'),
+    patternHistoryTitle:     document.getElementById('patternHistoryTitle'),
+    closeHistoryBtn:         document.getElementById('closeHistoryBtn'),
+    patternRevisions:        document.getElementById('patternRevisions'),
+    patternDiff:             document.getElementById('patternDiff'),
+    deletedPatterns:         document.getElementById('deletedPatterns'),
+    clearConsoleBtn:         document.getElementById('clearConsoleBtn'),
+    exportPatternSelector:   document.getElementById('exportPatternSelector'),
+    exportFormat:            document.getElementById('exportFormat'),
+    exportPatternsBtn:       document.getElementById('exportPatternsBtn'),
+    importBundleFile:        document.getElementById('importBundleFile'),
+    importPatternsBtn:       document.getElementById('importPatternsBtn'),
+    importResult:            document.getElementById('importResult'),
 
     // Scheduler
     cronTabSimple:           document.getElementById('cronTabSimple'),
@@ -64,6 +93,7 @@ export const ui = {
     deviceEveryDay:          document.getElementById('deviceEveryDay'),
     cronCommandType:         document.getElementById('cronCommandType'),
     cronPatternSelect:       document.getElementById('cronPatternSelect'),
+    cronPlaylistSelect:      document.getElementById('cronPlaylistSelect'),
     scheduleSpec:            document.getElementById('scheduleSpec'),
     scheduleCommand:         document.getElementById('scheduleCommand'),
     addScheduleBtn:          document.getElementById('addScheduleBtn'),
@@ -73,6 +103,7 @@ export const ui = {
     pauseAllSchedulesBtn:    document.getElementById('pauseAllSchedulesBtn'),
     resumeAllSchedulesBtn:   document.getElementById('resumeAllSchedulesBtn'),
     scheduleList:            document.getElementById('scheduleList'),
+    automationList:          document.getElementById('automationList'),
 
     // Advanced
     syncTimeBtn:             document.getElementById('syncTimeBtn'),
@@ -327,6 +358,276 @@ export function initCodeMirror() {
     return ui.codeEditor;
 }
 
+// ──────────────────────────────────────────────────────────────
+// Editor console
+// ──────────────────────────────────────────────────────────────
+const MAX_CONSOLE_LINES = 500;
+
+// appendConsoleEntries shows log entries produced by Lua patterns (those tagged with a pattern name).
+// Errors that carry a line number jump to that line in the editor when clicked.
+export function appendConsoleEntries(entries) {
+    const out = ui.editorConsole;
+    if (!out) return;
+    const stickToBottom = out.scrollTop + out.clientHeight >= out.scrollHeight - 4;
+
+    entries.forEach(entry => {
+        const pattern = entry.attrs && entry.attrs.pattern;
+        if (!pattern) return;
+
+        const line = document.createElement('div');
+        line.className = `console-line level-${entry.level}`;
+
+        const time = document.createElement('span');
+        time.className = 'console-time';
+        time.textContent = new Date(entry.time).toLocaleTimeString();
+        const name = document.createElement('span');
+        name.className = 'console-pattern';
+        name.textContent = `[${pattern}]`;
+
+        let text = entry.message;
+        if (entry.attrs.err) text += `: ${entry.attrs.err}`;
+        if (entry.attrs.line) {
+            line.dataset.line = entry.attrs.line;
+            line.title = `Go to line ${entry.attrs.line}`;
+        }
+        if (entry.attrs.source !== 'print') line.classList.add('console-system');
+
+        line.append(time, name, document.createTextNode(text));
+        out.appendChild(line);
+    });
+
+    while (out.childElementCount > MAX_CONSOLE_LINES) out.firstElementChild.remove();
+    if (stickToBottom) out.scrollTop = out.scrollHeight;
+}
+
+export function clearConsole() {
+    if (ui.editorConsole) ui.editorConsole.innerHTML = '';
+}
+
+// ──────────────────────────────────────────────────────────────
+// Editor diagnostics
+// ──────────────────────────────────────────────────────────────
+let diagnosticMarks = [];
+
+// showSaveResult annotates the editor with the problems found when a pattern was saved:
+// lines are highlighted, a syntax error is underlined at its column, and the list below the
+// editor jumps to a line when clicked.
+export function showSaveResult(result) {
+    clearEditorDiagnostics();
+    const box = ui.editorDiagnostics;
+    if (!box) return;
+    const diagnostics = result.diagnostics || [];
+    const editor = ui.codeEditor;
+
+    diagnostics.forEach(d => {
+        const line = Math.min(Math.max(d.line - 1, 0), editor.lastLine());
+        const handle = editor.addLineClass(line, 'background', `cm-lint-${d.severity}`);
+        diagnosticMarks.push({ clear: () => editor.removeLineClass(handle, 'background', `cm-lint-${d.severity}`) });
+        if (d.column > 0) {
+            const word = editor.findWordAt({ line, ch: d.column - 1 });
+            const to = word.head.ch > word.anchor.ch ? word.head : { line, ch: d.column };
+            diagnosticMarks.push(editor.markText(word.anchor, to, { className: 'cm-lint-mark', title: d.message }));
+        }
+    });
+
+    const summary = document.createElement('div');
+    summary.className = `diagnostics-summary ${result.saved ? 'saved' : 'rejected'}`;
+    if (!result.saved) {
+        summary.textContent = `Not saved: ${result.error}`;
+    } else if (diagnostics.length) {
+        summary.textContent = `Saved "${result.name}" with ${diagnostics.length} warning${diagnostics.length === 1 ? '' : 's'}`;
+    } else {
+        summary.textContent = `Saved "${result.name}"`;
+    }
+    box.appendChild(summary);
+
+    diagnostics.forEach(d => {
+        const item = document.createElement('div');
+        item.className = `console-line diagnostic level-${d.severity === 'error' ? 'error' : 'warn'}`;
+        item.dataset.line = d.line;
+        item.title = `Go to line ${d.line}`;
+        item.textContent = `Line ${d.line}${d.column ? `:${d.column}` : ''}: ${d.message}`;
+        box.appendChild(item);
+    });
+    box.hidden = false;
+}
+
+export function clearEditorDiagnostics() {
+    diagnosticMarks.forEach(m => m.clear());
+    diagnosticMarks = [];
+    if (ui.editorDiagnostics) {
+        ui.editorDiagnostics.innerHTML = '';
+        ui.editorDiagnostics.hidden = true;
+    }
+}
+
+// ──────────────────────────────────────────────────────────────
+// Pattern history
+// ──────────────────────────────────────────────────────────────
+const REVISION_ACTIONS = {
+    save: 'Saved',
+    delete: 'Deleted',
+    restore: 'Restored',
+    external: 'Changed on disk',
+};
+
+// showPatternHistory lists the revisions of a pattern, newest first. Each can be compared
+// with the current file or restored.
+export function showPatternHistory(name, revisions, api) {
+    const box = ui.patternHistory;
+    if (!box) return;
+    ui.patternHistoryTitle.textContent = `History of ${name}`;
+    ui.patternRevisions.innerHTML = '';
+    ui.patternDiff.hidden = true;
+
+    if (!revisions || revisions.length === 0) {
+        ui.patternRevisions.innerHTML = '<div class="hint-inline">No revisions recorded yet.</div>';
+    }
+    (revisions || []).forEach(rev => {
+        const row = document.createElement('div');
+        row.className = 'revision-item';
+
+        const label = document.createElement('span');
+        label.className = 'revision-label';
+        let text = `#${rev.id} ${REVISION_ACTIONS[rev.action] || rev.action}`;
+        if (rev.from) text += ` #${rev.from}`;
+        text += ` · ${new Date(rev.time).toLocaleString()}`;
+        if (rev.author) text += ` · ${rev.author}`;
+        label.textContent = text;
+
+        const diffBtn = document.createElement('button');
+        diffBtn.className = 'btn btn-ghost btn-sm';
+        diffBtn.innerHTML = '<span class="material-icons-round">difference</span> Diff';
+        diffBtn.title = 'Compare with the current file';
+        diffBtn.onclick = () => api.diffPatternRevisions(name, rev.id);
+
+        const restoreBtn = document.createElement('button');
+        restoreBtn.className = 'btn btn-ghost btn-sm';
+        restoreBtn.innerHTML = '<span class="material-icons-round">restore</span> Restore';
+        restoreBtn.onclick = () => {
+            if (confirm(`Restore revision #${rev.id} of "${name}"? The current code is kept in the history.`)) {
+                api.restorePatternRevision(name, rev.id);
+            }
+        };
+
+        row.append(label, diffBtn, restoreBtn);
+        ui.patternRevisions.appendChild(row);
+    });
+    box.hidden = false;
+}
+
+export function hidePatternHistory() {
+    if (ui.patternHistory) ui.patternHistory.hidden = true;
+}
+
+// showPatternDiff shows a unified diff with added and removed lines colored.
+export function showPatternDiff(result) {
+    const pre = ui.patternDiff;
+    if (!pre) return;
+    pre.innerHTML = '';
+    if (result.error) {
+        pre.textContent = result.error;
+    } else if (!result.diff) {
+        pre.textContent = `Revision #${result.from} is the same as the current file.`;
+    } else {
+        result.diff.split('\n').forEach(text => {
+            const line = document.createElement('div');
+            if (text.startsWith('@@')) line.className = 'diff-hunk';
+            else if (text.startsWith('+')) line.className = 'diff-add';
+            else if (text.startsWith('-')) line.className = 'diff-del';
+            line.textContent = text;
+            pre.appendChild(line);
+        });
+    }
+    pre.hidden = false;
+}
+
+// updateDeletedPatterns lists deleted patterns that can be brought back.
+export function updateDeletedPatterns(deleted, api) {
+    const box = ui.deletedPatterns;
+    if (!box) return;
+    box.innerHTML = '';
+    box.hidden = !deleted || deleted.length === 0;
+    if (box.hidden) return;
+
+    const title = document.createElement('div');
+    title.className = 'field-label';
+    title.textContent = 'Recently deleted';
+    box.appendChild(title);
+    deleted.forEach(p => {
+        const row = document.createElement('div');
+        row.className = 'revision-item';
+        const label = document.createElement('span');
+        label.className = 'revision-label';
+        label.textContent = `${p.name} · ${new Date(p.deletedAt).toLocaleString()}`;
+        const btn = document.createElement('button');
+        btn.className = 'btn btn-ghost btn-sm';
+        btn.innerHTML = '<span class="material-icons-round">restore_from_trash</span> Undelete';
+        btn.onclick = () => api.undeletePattern(p.name);
+        row.append(label, btn);
+        box.appendChild(row);
+    });
+}
+
+// IMPORT_STATUS describes each file's outcome in an import report.
+const IMPORT_STATUS = {
+    added: 'added',
+    overwritten: 'overwritten',
+    renamed: 'imported as',
+    unchanged: 'already up to date',
+    skipped: 'skipped',
+    conflict: 'exists with different code',
+    invalid: 'rejected',
+};
+
+// showImportResult shows what an import did with each file. When files conflict, nothing
+// was imported and resolve(onConflict) retries with the chosen handling.
+export function showImportResult(result, resolve) {
+    const box = ui.importResult;
+    if (!box) return;
+    box.innerHTML = '';
+    box.hidden = false;
+
+    const summary = document.createElement('div');
+    summary.className = 'field-label import-summary';
+    if (result.status === 409) {
+        summary.textContent = 'Some patterns already exist. Nothing was imported yet:';
+    } else if (result.error) {
+        summary.classList.add('failed');
+        summary.textContent = `Import failed: ${result.error}`;
+    } else {
+        summary.textContent = 'Import finished:';
+    }
+    box.appendChild(summary);
+
+    result.files.forEach(f => {
+        const row = document.createElement('div');
+        row.className = `import-file status-${f.status}`;
+        row.textContent = f.name;
+        const status = document.createElement('span');
+        status.className = 'import-status';
+        status.textContent = [IMPORT_STATUS[f.status] || f.status, f.as, f.error].filter(Boolean).join(' ');
+        row.appendChild(status);
+        box.appendChild(row);
+    });
+
+    if (result.status !== 409) return;
+    const actions = document.createElement('div');
+    actions.className = 'button-row';
+    [
+        ['overwrite', 'sync', 'Overwrite'],
+        ['rename', 'content_copy', 'Import as copies'],
+        ['skip', 'skip_next', 'Skip existing'],
+    ].forEach(([mode, icon, label]) => {
+        const btn = document.createElement('button');
+        btn.className = 'btn btn-ghost btn-sm';
+        btn.innerHTML = `<span class="material-icons-round">${icon}</span> ${label}`;
+        btn.onclick = () => resolve(mode);
+        actions.appendChild(btn);
+    });
+    box.appendChild(actions);
+}
+
 // ──────────────────────────────────────────────────────────────
 // Time pickers
 // ──────────────────────────────────────────────────────────────
@@ -397,20 +698,237 @@ export function renderHardwarePatterns(setHardwarePatternApi) {
 // ──────────────────────────────────────────────────────────────
 // Pattern list dropdowns + cron pattern select
 // ──────────────────────────────────────────────────────────────
+// patternInfo maps pattern names to their metadata from the last pattern_list message.
+let patternInfo = {};
+// libraryModules lists the shared modules ("lib/name.lua") from the last library_list message.
+let libraryModules = [];
+
 export function updatePatternLists(patterns) {
+    patternInfo = {};
+    (patterns || []).forEach(p => { patternInfo[p.name] = p; });
+    const names = Object.keys(patternInfo);
+
     const fill = (sel) => {
         const cur = sel.value;
         sel.innerHTML = '';
-        if (patterns && patterns.length > 0) {
-            patterns.forEach(name => sel.add(new Option(name, name)));
-            sel.value = patterns.includes(cur) ? cur : patterns[0];
+        if (names.length > 0) {
+            names.forEach(name => sel.add(new Option(patternInfo[name].displayName || name, name)));
+            sel.value = names.includes(cur) ? cur : names[0];
         } else {
             sel.innerHTML = '<option disabled>No patterns found</option>';
         }
     };
     fill(ui.patternSelector);
-    fill(ui.editorPatternSelector);
     if (ui.cronPatternSelect) fill(ui.cronPatternSelect);
+    fillThenSelector(names);
+    fillEditorSelector();
+    fillExportSelector(names);
+    renderSelectedPattern();
+}
+
+// fillThenSelector lists what can follow a time-limited run: restoring, powering off, or a pattern.
+function fillThenSelector(names) {
+    const sel = ui.patternThen;
+    if (!sel) return;
+    const cur = sel.value || 'restore';
+    sel.innerHTML = '';
+    sel.add(new Option('Restore previous state', 'restore'));
+    sel.add(new Option('Power off', 'off'));
+    if (names.length > 0) {
+        const group = document.createElement('optgroup');
+        group.label = 'Run pattern';
+        names.forEach(name => group.appendChild(new Option(patternInfo[name].displayName || name, name)));
+        sel.appendChild(group);
+    }
+    sel.value = cur === 'restore' || cur === 'off' || names.includes(cur) ? cur : 'restore';
+}
+
+export function updateLibraryList(modules) {
+    libraryModules = modules || [];
+    fillEditorSelector();
+}
+
+// fillEditorSelector lists the patterns followed by the library modules, which can be edited but not run.
+function fillEditorSelector() {
+    const sel = ui.editorPatternSelector;
+    const cur = sel.value;
+    const names = Object.keys(patternInfo);
+    sel.innerHTML = '';
+    names.forEach(name => sel.add(new Option(patternInfo[name].displayName || name, name)));
+    if (libraryModules.length > 0) {
+        const group = document.createElement('optgroup');
+        group.label = 'Library (lib/)';
+        libraryModules.forEach(name => group.appendChild(new Option(name, name)));
+        sel.appendChild(group);
+    }
+    const all = names.concat(libraryModules);
+    if (all.length === 0) {
+        sel.innerHTML = '<option disabled>No patterns found</option>';
+        return;
+    }
+    sel.value = all.includes(cur) ? cur : all[0];
+}
+
+// fillExportSelector lists the patterns that can be exported, keeping the selection.
+function fillExportSelector(names) {
+    const sel = ui.exportPatternSelector;
+    if (!sel) return;
+    const selected = new Set([...sel.selectedOptions].map(o => o.value));
+    sel.innerHTML = '';
+    names.forEach(name => {
+        const option = new Option(patternInfo[name].displayName || name, name);
+        option.selected = selected.has(name);
+        sel.add(option);
+    });
+}
+
+// renderSelectedPattern shows the metadata and parameter form of the pattern selected to run.
+export function renderSelectedPattern() {
+    renderPatternInfo();
+    renderPatternParams();
+}
+
+// renderPatternInfo shows the selected pattern's description, tags, palette and author.
+function renderPatternInfo() {
+    const box = ui.patternInfo;
+    if (!box) return;
+    const info = patternInfo[ui.patternSelector.value];
+    box.innerHTML = '';
+    if (!info) {
+        box.classList.add('hidden');
+        return;
+    }
+
+    if (info.description) {
+        const desc = document.createElement('div');
+        desc.className = 'pattern-description';
+        desc.textContent = info.description;
+        box.appendChild(desc);
+    }
+
+    const meta = document.createElement('div');
+    meta.className = 'pattern-meta';
+    if (info.palette && info.palette.length > 0) {
+        const palette = document.createElement('span');
+        palette.className = 'pattern-palette';
+        info.palette.forEach(hex => {
+            const swatch = document.createElement('span');
+            swatch.className = 'pattern-swatch';
+            swatch.style.background = hex;
+            swatch.title = hex;
+            palette.appendChild(swatch);
+        });
+        meta.appendChild(palette);
+    }
+    (info.tags || []).forEach(tag => {
+        const chip = document.createElement('span');
+        chip.className = 'pattern-tag';
+        chip.textContent = tag;
+        meta.appendChild(chip);
+    });
+    if (info.loops !== undefined) {
+        const loops = document.createElement('span');
+        loops.textContent = info.loops ? 'Runs until stopped' : 'Finishes on its own';
+        meta.appendChild(loops);
+    }
+    if (info.author) {
+        const author = document.createElement('span');
+        author.textContent = `by ${info.author}`;
+        meta.appendChild(author);
+    }
+    if (meta.childElementCount > 0) box.appendChild(meta);
+
+    box.classList.toggle('hidden', box.childElementCount === 0);
+}
+
+// renderPatternParams builds a form for the parameters declared by the selected pattern.
+// Values the user already entered are kept when the same pattern's form is re-rendered.
+function renderPatternParams() {
+    const box = ui.patternParams;
+    if (!box) return;
+    const info = patternInfo[ui.patternSelector.value];
+    const params = (info && info.params) || [];
+    const previous = box.dataset.pattern === ui.patternSelector.value ? getPatternParamValues() : {};
+
+    box.innerHTML = '';
+    box.dataset.pattern = ui.patternSelector.value;
+    box.classList.toggle('hidden', params.length === 0);
+
+    params.forEach(p => {
+        const id = `param-${p.name}`;
+        const group = document.createElement('div');
+        group.className = 'field-group';
+        const label = document.createElement('label');
+        label.className = 'field-label';
+        label.htmlFor = id;
+        label.textContent = p.label || p.name;
+
+        const value = p.name in previous ? previous[p.name] : p.default;
+        let input;
+        switch (p.type) {
+            case 'boolean':
+                input = document.createElement('input');
+                input.type = 'checkbox';
+                input.className = 'param-checkbox';
+                input.checked = !!value;
+                break;
+            case 'color':
+                input = document.createElement('input');
+                input.type = 'color';
+                input.className = 'param-color';
+                input.value = value;
+                break;
+            case 'choice':
+                input = document.createElement('select');
+                input.className = 'field-select';
+                p.choices.forEach(c => input.add(new Option(c, c)));
+                input.value = value;
+                break;
+            case 'number':
+            case 'integer':
+                input = document.createElement('input');
+                input.type = 'number';
+                input.className = 'field-input';
+                input.step = p.type === 'integer' ? '1' : 'any';
+                if (p.min !== undefined) input.min = p.min;
+                if (p.max !== undefined) input.max = p.max;
+                input.value = value;
+                break;
+            default:
+                input = document.createElement('input');
+                input.type = 'text';
+                input.className = 'field-input';
+                input.value = value;
+        }
+        input.id = id;
+        input.dataset.param = p.name;
+        input.dataset.type = p.type;
+        group.append(label, input);
+        box.appendChild(group);
+    });
+}
+
+// getPatternParamValues returns the values entered in the parameter form. The agent validates them.
+export function getPatternParamValues() {
+    const values = {};
+    if (!ui.patternParams) return values;
+    ui.patternParams.querySelectorAll('[data-param]').forEach(input => {
+        const type = input.dataset.type;
+        if (type === 'boolean') values[input.dataset.param] = input.checked;
+        else if ((type === 'number' || type === 'integer') && input.value !== '') values[input.dataset.param] = Number(input.value);
+        else values[input.dataset.param] = input.value;
+    });
+    return values;
+}
+
+// getPatternRunLimit reads the "Stop After" field: a duration ("30m") or a clock time ("23:00").
+// An empty field runs the pattern until it is stopped.
+export function getPatternRunLimit() {
+    const value = (ui.patternStopAfter?.value || '').trim();
+    if (!value) return {};
+    const limit = /^\d{1,2}:\d{2}$/.test(value) ? { until: value } : { duration: value };
+    limit.then = ui.patternThen?.value || 'restore';
+    return limit;
 }
 
 // ──────────────────────────────────────────────────────────────
@@ -512,6 +1030,171 @@ export function updateScheduleList(schedules) {
     });
 }
 
+// ──────────────────────────────────────────────────────────────
+// Automations
+// ──────────────────────────────────────────────────────────────
+export function updateAutomationList(automations) {
+    ui.automationList.innerHTML = '';
+    if (!automations || automations.length === 0) {
+        ui.automationList.innerHTML = '<li class="schedule-empty">No automations. Add .lua scripts to the automations/ directory.</li>';
+        return;
+    }
+
+    automations.forEach(item => {
+        const li = document.createElement('li');
+        li.className = 'schedule-item';
+
+        const info = document.createElement('div');
+        info.className = 'schedule-info';
+
+        const top = document.createElement('div');
+        top.className = 'schedule-top';
+        const name = document.createElement('div');
+        name.className = 'schedule-command';
+        name.textContent = item.displayName || item.name;
+        name.title = item.name;
+        const state = document.createElement('span');
+        state.className = `schedule-type automation-state automation-${item.state}`;
+        state.textContent = item.state;
+        top.append(name, state);
+        info.append(top);
+
+        if (item.description) {
+            const desc = document.createElement('div');
+            desc.className = 'schedule-human';
+            desc.textContent = item.description;
+            info.append(desc);
+        }
+        if (item.error) {
+            const err = document.createElement('div');
+            err.className = 'automation-error';
+            err.textContent = item.line ? `Line ${item.line}: ${item.error}` : item.error;
+            info.append(err);
+        }
+
+        const bottom = document.createElement('div');
+        bottom.className = 'schedule-bottom';
+        const meta = document.createElement('div');
+        meta.className = 'schedule-meta';
+        meta.innerHTML = `
+            <span class="schedule-meta-item">
+                <span class="material-icons-round">history</span>
+                Since: ${formatRunTime(item.since)}
+            </span>
+            <span class="schedule-meta-item">
+                <span class="material-icons-round">restart_alt</span>
+                ${item.restart}${item.restarts ? ` (${item.restarts} restarts)` : ''}
+            </span>`;
+
+        const actions = document.createElement('div');
+        actions.className = 'schedule-actions';
+        const active = item.state === 'running' || item.state === 'restarting';
+        const btn = document.createElement('button');
+        btn.className = 'schedule-btn automation-toggle-btn';
+        btn.dataset.name = item.name;
+        btn.dataset.action = active ? 'stop' : 'start';
+        btn.title = active ? 'Stop automation' : 'Start automation';
+        btn.innerHTML = `<span class="material-icons-round">${active ? 'stop_circle' : 'play_circle'}</span>`;
+        actions.append(btn);
+
+        if (active) {
+            const restart = document.createElement('button');
+            restart.className = 'schedule-btn automation-toggle-btn';
+            restart.dataset.name = item.name;
+            restart.dataset.action = 'start';
+            restart.title = 'Restart automation';
+            restart.innerHTML = '<span class="material-icons-round">restart_alt</span>';
+            actions.append(restart);
+        }
+
+        bottom.append(meta, actions);
+        info.append(bottom);
+        li.append(info);
+        ui.automationList.appendChild(li);
+    });
+}
+
+// ──────────────────────────────────────────────────────────────
+// Playlists
+// ──────────────────────────────────────────────────────────────
+// playlists maps playlist names to their definitions from the last playlist_list message.
+let playlists = {};
+
+export function updatePlaylistList(list) {
+    playlists = {};
+    (list || []).forEach(p => { playlists[p.name] = p; });
+    const names = Object.keys(playlists);
+
+    const fill = (sel) => {
+        const cur = sel.value;
+        sel.innerHTML = '';
+        if (names.length > 0) {
+            names.forEach(name => sel.add(new Option(playlists[name].displayName || name, name)));
+            sel.value = names.includes(cur) ? cur : names[0];
+        } else {
+            sel.innerHTML = '<option disabled>No playlists</option>';
+        }
+    };
+    fill(ui.playlistSelector);
+    if (ui.cronPlaylistSelect) fill(ui.cronPlaylistSelect);
+    renderSelectedPlaylist();
+}
+
+// renderSelectedPlaylist loads the selected playlist into the editor.
+export function renderSelectedPlaylist() {
+    showPlaylistError('');
+    const pl = playlists[ui.playlistSelector.value];
+    if (!pl) return;
+    const { name, ...definition } = pl;
+    ui.playlistName.value = name;
+    ui.playlistDefinition.value = JSON.stringify(definition, null, 2);
+}
+
+export function showPlaylistError(message) {
+    ui.playlistError.textContent = message;
+    ui.playlistError.classList.toggle('hidden', !message);
+}
+
+// formatPatternStatus describes a pattern_status payload, including the playlist position and
+// the time left of a time-limited run.
+function formatPatternStatus(status, remaining) {
+    if (!status || !status.running) return 'Idle';
+    let text = status.running;
+    const pl = status.playlist;
+    if (pl) text += ` — ${pl.displayName || pl.name} ${pl.index + 1}/${pl.count}`;
+    if (remaining !== undefined) text += ` — ${formatCountdown(remaining)} left`;
+    return text;
+}
+
+let patternCountdown = null;
+
+// showPatternStatus shows a pattern_status payload and, for a time-limited run, counts the
+// remaining time down from when the message arrived.
+export function showPatternStatus(status) {
+    clearInterval(patternCountdown);
+    patternCountdown = null;
+    const timer = status && status.running ? status.timer : null;
+    if (!timer) {
+        ui.patternStatus.textContent = formatPatternStatus(status);
+        return;
+    }
+    const endsAt = Date.now() + timer.remaining * 1000;
+    const render = () => {
+        const remaining = Math.max(0, Math.round((endsAt - Date.now()) / 1000));
+        ui.patternStatus.textContent = formatPatternStatus(status, remaining);
+        if (remaining === 0) clearInterval(patternCountdown);
+    };
+    render();
+    patternCountdown = setInterval(render, 1000);
+}
+
+function formatCountdown(seconds) {
+    const h = Math.floor(seconds / 3600);
+    const m = Math.floor((seconds % 3600) / 60);
+    const s = seconds % 60;
+    return h > 0 ? `${h}:${pad(m)}:${pad(s)}` : `${m}:${pad(s)}`;
+}
+
 function formatRunTime(value) {
     const date = new Date(value);
     return isNaN(date.getTime()) ? value : date.toLocaleString();
@@ -522,6 +1205,7 @@ function getCommandType(command) {
     if (cmd.startsWith('power on')) return 'Power On';
     if (cmd.startsWith('power off')) return 'Power Off';
     if (cmd.startsWith('pattern')) return 'Pattern';
+    if (cmd.startsWith('playlist')) return 'Playlist';
     if (cmd.startsWith('lua')) return 'Lua';
     return 'Command';
 }